@@ -0,0 +1,243 @@
+package zh07
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+)
+
+// maxFrameLength is the longest frame the scanner accepts, a longer length
+// is taken for noise.
+const maxFrameLength = 64
+
+// unitKind classifies what is found in the bytes exchanged with a sensor.
+type unitKind int
+
+const (
+	unitStray      unitKind = iota // bytes that do not start anything known
+	unitCommand                    // a command sent to the sensor
+	unitAnswer                     // a 9-byte answer to a query
+	unitFrame                      // a 0x42 0x4d frame, data or acknowledgement
+	unitIncomplete                 // the start of a unit cut short
+)
+
+// unit is a command, an answer, a frame or a run of stray bytes.
+type unit struct {
+	kind   unitKind
+	dir    Direction
+	offset time.Duration // time its first byte was exchanged
+	data   []byte
+}
+
+// scanner splits the bytes exchanged in one direction into units, however
+// they were chunked by the transport.
+type scanner struct {
+	dir     Direction
+	buf     []byte
+	offsets []time.Duration // time each byte of buf was exchanged
+}
+
+// push appends the bytes b exchanged at offset.
+func (s *scanner) push(offset time.Duration, b []byte) {
+	s.buf = append(s.buf, b...)
+	for range b {
+		s.offsets = append(s.offsets, offset)
+	}
+}
+
+// next returns the next complete unit, or false if more bytes are needed.
+func (s *scanner) next() (unit, bool) {
+	n, kind := s.length()
+	if n == 0 {
+		return unit{}, false
+	}
+	return s.take(n, kind), true
+}
+
+// rest returns whatever is left as an incomplete unit, or false if nothing is.
+func (s *scanner) rest() (unit, bool) {
+	if len(s.buf) == 0 {
+		return unit{}, false
+	}
+	return s.take(len(s.buf), unitIncomplete), true
+}
+
+// length returns the length and kind of the unit at the start of the buffer,
+// or a length of 0 if more bytes are needed to tell.
+func (s *scanner) length() (int, unitKind) {
+	b := s.buf
+	if len(b) == 0 {
+		return 0, unitStray
+	}
+
+	switch b[0] {
+	case 0xFF: // Winsen command or answer
+		if len(b) < 2 {
+			return 0, unitStray
+		}
+		if s.dir == TX && b[1] == 0x01 {
+			return need(b, 9, unitCommand)
+		}
+		if s.dir == RX && b[1] == 0x86 {
+			return need(b, 9, unitAnswer)
+		}
+	case 0x42: // Plantower command or frame
+		if len(b) < 2 {
+			return 0, unitStray
+		}
+		if b[1] != 0x4D {
+			break
+		}
+		if s.dir == TX {
+			return need(b, 7, unitCommand)
+		}
+		if len(b) < 4 {
+			return 0, unitFrame
+		}
+		// frame length counts the bytes after the length itself
+		if n := byteToInt(b[2:4]) + 4; n >= 8 && n <= maxFrameLength {
+			return need(b, n, unitFrame)
+		}
+	}
+
+	// stray bytes, up to the next byte that may start a unit
+	n := 1
+	for n < len(b) && b[n] != 0xFF && b[n] != 0x42 {
+		n++
+	}
+	return n, unitStray
+}
+
+// need returns n and k if b holds n bytes, otherwise 0 to ask for more.
+func need(b []byte, n int, k unitKind) (int, unitKind) {
+	if len(b) < n {
+		return 0, k
+	}
+	return n, k
+}
+
+// take removes the first n bytes from the buffer and returns them as a unit.
+func (s *scanner) take(n int, kind unitKind) unit {
+	u := unit{
+		kind:   kind,
+		dir:    s.dir,
+		offset: s.offsets[0],
+		data:   append([]byte(nil), s.buf[:n]...),
+	}
+	s.buf, s.offsets = s.buf[n:], s.offsets[n:]
+
+	return u
+}
+
+// commandName returns the name of command c, or "" if p has no such command.
+func (p *profile) commandName(c []byte) string {
+	for _, n := range []struct {
+		cmd  []byte
+		name string
+	}{
+		{p.cmdInitiative, "set initiative upload mode"},
+		{p.cmdQA, "set question and answer mode"},
+		{p.cmdQuery, "query"},
+		{p.cmdSleep, "enter dormant mode"},
+		{p.cmdWake, "quit dormant mode"},
+	} {
+		if n.cmd != nil && bytes.Equal(c, n.cmd) {
+			return n.name
+		}
+	}
+	return ""
+}
+
+// describe labels u with its meaning and checksum result.
+func (p *profile) describe(u unit) string {
+	switch u.kind {
+	case unitCommand:
+		if name := p.commandName(u.data); name != "" {
+			return name
+		}
+		return "unknown command"
+
+	case unitAnswer:
+		return fmt.Sprintf("answer: %s, %s", readingText(p.decode(u.data), false), checksumText(u.data))
+
+	case unitFrame:
+		switch n := len(u.data); {
+		case n == p.frameLength:
+			return fmt.Sprintf("frame: %s, %s", readingText(p.decodeFrame(u.data), p.counts > 0), checksumText(u.data))
+		case n == 8:
+			return "acknowledgement, " + checksumText(u.data)
+		default:
+			return fmt.Sprintf("frame of %d bytes, expected %d, %s", n, p.frameLength, checksumText(u.data))
+		}
+
+	case unitIncomplete:
+		return fmt.Sprintf("incomplete, %d bytes", len(u.data))
+	}
+
+	if len(u.data) == 1 {
+		return "stray byte"
+	}
+	return fmt.Sprintf("%d stray bytes", len(u.data))
+}
+
+// readingText formats the concentrations of r, and its particle counts.
+func readingText(r Reading, counts bool) string {
+	s := fmt.Sprintf("PM1.0=%d PM2.5=%d PM10=%d", r.PM1, r.PM25, r.PM10)
+	if counts {
+		c := r.Counts
+		s += fmt.Sprintf(" gt03=%d gt05=%d gt10=%d gt25=%d gt50=%d gt100=%d", c.Gt03, c.Gt05, c.Gt10, c.Gt25, c.Gt50, c.Gt100)
+	}
+	return s
+}
+
+// checksumText reports whether the checksum of an answer or a frame matches.
+func checksumText(d []byte) string {
+	if received, calculated := receivedChecksumOf(d), checksumOf(d); received != calculated {
+		return fmt.Sprintf("checksum mismatch: received=%X, calculated=%X", received, calculated)
+	}
+	return "checksum ok"
+}
+
+// Annotate writes records as a hexdump of the commands, answers and frames
+// of model, labelled with their meaning and checksum results. Units split
+// across records are put back together and shown at the time of their first
+// byte.
+func Annotate(w io.Writer, records []CaptureRecord, model Model) error {
+	var (
+		p        = profileFor(model)
+		bw       = bufio.NewWriter(w)
+		scanners = map[Direction]*scanner{TX: {dir: TX}, RX: {dir: RX}}
+	)
+
+	for _, r := range records {
+		s, ok := scanners[r.Direction]
+		if !ok {
+			continue
+		}
+		s.push(r.Offset, r.Data)
+		for u, ok := s.next(); ok; u, ok = s.next() {
+			writeUnit(bw, p, u)
+		}
+	}
+	for _, d := range []Direction{TX, RX} {
+		if u, ok := scanners[d].rest(); ok {
+			writeUnit(bw, p, u)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// writeUnit writes u as lines of up to 16 bytes, the first one labelled.
+func writeUnit(w io.Writer, p *profile, u unit) {
+	for i := 0; i < len(u.data); i += 16 {
+		chunk := u.data[i:min(i+16, len(u.data))]
+		if i == 0 {
+			fmt.Fprintf(w, "%12.6f %s  %-47s  %s\n", u.offset.Seconds(), u.dir, fmt.Sprintf("% X", chunk), p.describe(u))
+		} else {
+			fmt.Fprintf(w, "%17s% X\n", "", chunk)
+		}
+	}
+}
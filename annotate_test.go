@@ -0,0 +1,95 @@
+package zh07
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnnotate(t *testing.T) {
+	ms := time.Millisecond
+
+	tests := []struct {
+		name    string
+		model   Model
+		records []CaptureRecord
+		want    string
+	}{
+		{
+			name:  "qa",
+			model: ModelZH07,
+			records: []CaptureRecord{
+				{Offset: 0, Direction: TX, Data: commandSetQAMode},
+				{Offset: 250 * ms, Direction: TX, Data: commandQuery},
+				{Offset: 500 * ms, Direction: RX, Data: sampleQAPayload[:4]},
+				{Offset: 502 * ms, Direction: RX, Data: sampleQAPayload[4:]},
+				{Offset: 1500 * ms, Direction: TX, Data: commandQuery},
+				{Offset: 1750 * ms, Direction: RX, Data: sampleQABadChecksum},
+			},
+			want: "" +
+				"    0.000000 TX  FF 01 78 41 00 00 00 00 46                       set question and answer mode\n" +
+				"    0.250000 TX  FF 01 86 00 00 00 00 00 79                       query\n" +
+				"    0.500000 RX  FF 86 00 85 00 96 00 65 FA                       answer: PM1.0=101 PM2.5=133 PM10=150, checksum ok\n" +
+				"    1.500000 TX  FF 01 86 00 00 00 00 00 79                       query\n" +
+				"    1.750000 RX  FF 86 00 85 00 96 00 65 FB                       answer: PM1.0=101 PM2.5=133 PM10=150, checksum mismatch: received=FB, calculated=FA\n",
+		},
+		{
+			name:  "initiative",
+			model: ModelZH07,
+			records: []CaptureRecord{
+				{Offset: 0, Direction: RX, Data: []byte{0x27, 0x00, 0x42}},
+				{Offset: 10 * ms, Direction: RX, Data: sampleInitiativePayload[:20]},
+				{Offset: 20 * ms, Direction: RX, Data: sampleInitiativePayload[20:]},
+				{Offset: 1000 * ms, Direction: RX, Data: sampleInitiativeBadChecksum},
+				{Offset: 2000 * ms, Direction: RX, Data: sampleInitiativePayload[:6]},
+			},
+			want: "" +
+				"    0.000000 RX  27 00                                            2 stray bytes\n" +
+				"    0.000000 RX  42                                               stray byte\n" +
+				"    0.010000 RX  42 4D 00 1C 00 54 00 6E 00 7C 00 54 00 6E 00 7C  frame: PM1.0=84 PM2.5=110 PM10=124, checksum ok\n" +
+				"                 00 00 00 00 00 00 00 00 00 00 00 00 00 00 03 27\n" +
+				"    1.000000 RX  42 4D 00 1C 00 54 00 6E 00 7C 00 54 00 6E 00 7C  frame: PM1.0=84 PM2.5=110 PM10=124, checksum mismatch: received=328, calculated=327\n" +
+				"                 00 00 00 00 00 00 00 00 00 00 00 00 00 00 03 28\n" +
+				"    2.000000 RX  42 4D 00 1C 00 54                                incomplete, 6 bytes\n",
+		},
+		{
+			name:  "plantower",
+			model: ModelPMS5003,
+			records: []CaptureRecord{
+				{Offset: 0, Direction: TX, Data: plantowerCommandPassive},
+				{Offset: 5 * ms, Direction: RX, Data: []byte{0x42, 0x4D, 0x00, 0x04, 0xE1, 0x00, 0x01, 0x74}},
+				{Offset: 250 * ms, Direction: TX, Data: append(append([]byte{}, plantowerCommandRead...), 0x00, 0x01)},
+				{Offset: 260 * ms, Direction: RX, Data: plantowerFrame(5, 8, 11, ParticleCounts{Gt03: 900, Gt05: 250})},
+			},
+			want: "" +
+				"    0.000000 TX  42 4D E1 00 00 01 70                             set question and answer mode\n" +
+				"    0.005000 RX  42 4D 00 04 E1 00 01 74                          acknowledgement, checksum ok\n" +
+				"    0.250000 TX  42 4D E2 00 00 01 71                             query\n" +
+				"    0.250000 TX  00 01                                            2 stray bytes\n" +
+				"    0.260000 RX  42 4D 00 1C 00 05 00 08 00 0B 00 05 00 08 00 0B  frame: PM1.0=5 PM2.5=8 PM10=11 gt03=900 gt05=250 gt10=0 gt25=0 gt50=0 gt100=0, checksum ok\n" +
+				"                 03 84 00 FA 00 00 00 00 00 00 00 00 00 00 02 5C\n",
+		},
+		{
+			name:  "unknown",
+			model: ModelZH07,
+			records: []CaptureRecord{
+				{Offset: 0, Direction: TX, Data: []byte{0xFF, 0x01, 0x99, 0x00, 0x00, 0x00, 0x00, 0x00, 0x66}},
+				{Offset: 0, Direction: RX, Data: []byte{0x42, 0x4D, 0x00, 0x10}},
+				{Offset: 0, Direction: RX, Data: make([]byte, 16)},
+			},
+			want: "" +
+				"    0.000000 TX  FF 01 99 00 00 00 00 00 66                       unknown command\n" +
+				"    0.000000 RX  42 4D 00 10 00 00 00 00 00 00 00 00 00 00 00 00  frame of 20 bytes, expected 32, checksum mismatch: received=0, calculated=9F\n" +
+				"                 00 00 00 00\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			assert.NoError(t, Annotate(&b, tt.records, tt.model))
+			assert.Equal(t, tt.want, b.String())
+		})
+	}
+}
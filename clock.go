@@ -0,0 +1,214 @@
+package zh07
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultPostWriteDelay is how long to wait for a command to be executed
+	defaultPostWriteDelay = 250 * time.Millisecond
+	// defaultFrameInterval is how often the sensor updates its readings
+	defaultFrameInterval = time.Second
+)
+
+// Clock tells the time and waits. Drivers use it for every delay, so that
+// time-dependent behaviour can be tested with a FakeClock.
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+	// Sleep pauses for d
+	Sleep(d time.Duration)
+	// After sends the current time on the returned channel once d has elapsed
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the Clock of the time package.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// FakeClock is a Clock that only moves when told to. Sleep advances it right
+// away, so the code under test never blocks, while After waits for someone
+// else to advance it.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	slept   time.Duration
+	waiters []fakeWaiter
+}
+
+// fakeWaiter is a pending call to FakeClock.After.
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// NewFakeClock creates a FakeClock set to start.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+// Now implements Clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Sleep implements Clock by advancing the clock by d.
+func (c *FakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	c.slept += d
+	c.mu.Unlock()
+
+	c.Advance(d)
+}
+
+// After implements Clock. The channel receives once the clock has been
+// advanced by d.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), ch: ch})
+
+	return ch
+}
+
+// Advance moves the clock forward by d, firing the channels of After calls
+// that are due.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	sort.SliceStable(c.waiters, func(i, j int) bool { return c.waiters[i].at.Before(c.waiters[j].at) })
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = pending
+}
+
+// Waiters returns the number of pending After calls, which lets a test wait
+// for the code under test to block before advancing the clock.
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.waiters)
+}
+
+// Slept returns the total time passed to Sleep.
+func (c *FakeClock) Slept() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.slept
+}
+
+// timing holds the per-instance timing settings of a driver, see Config.
+type timing struct {
+	clock          Clock
+	postWriteDelay time.Duration
+	readTimeout    time.Duration
+	frameInterval  time.Duration
+}
+
+// newTiming applies the defaults to the timing settings of config.
+func newTiming(config *Config) timing {
+	t := timing{
+		clock:          config.Clock,
+		postWriteDelay: config.PostWriteDelay,
+		readTimeout:    config.ReadTimeout,
+		frameInterval:  config.FrameInterval,
+	}
+
+	if t.clock == nil {
+		t.clock = SystemClock
+	}
+	switch {
+	case t.postWriteDelay == 0:
+		t.postWriteDelay = defaultPostWriteDelay
+	case t.postWriteDelay < 0:
+		t.postWriteDelay = 0
+	}
+	switch {
+	case t.frameInterval == 0:
+		t.frameInterval = defaultFrameInterval
+	case t.frameInterval < 0:
+		t.frameInterval = 0
+	}
+
+	return t
+}
+
+// now returns the current time, from the system clock if none was set.
+func (t *timing) now() time.Time {
+	return t.clk().Now()
+}
+
+// clk returns the clock, the system clock if none was set.
+func (t *timing) clk() Clock {
+	if t.clock == nil {
+		return SystemClock
+	}
+	return t.clock
+}
+
+// afterWrite waits for a command to be executed.
+func (t *timing) afterWrite() {
+	if t.postWriteDelay > 0 {
+		t.clk().Sleep(t.postWriteDelay)
+	}
+}
+
+// sleepContext pauses for d on clock or until ctx is done, whichever happens
+// first.
+func sleepContext(ctx context.Context, clock Clock, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-clock.After(d):
+		return nil
+	}
+}
+
+// pace returns read, waiting out the frame interval since the previous call
+// whenever active reports true, so that queries are not sent back to back.
+func (t *timing) pace(read func() (*Reading, error), active func() bool) func(ctx context.Context) (*Reading, error) {
+	var last time.Time
+
+	return func(ctx context.Context) (*Reading, error) {
+		if active() && !last.IsZero() {
+			if err := sleepContext(ctx, t.clk(), last.Add(t.frameInterval).Sub(t.now())); err != nil {
+				return nil, err
+			}
+		}
+		last = t.now()
+
+		return read()
+	}
+}
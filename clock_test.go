@@ -0,0 +1,193 @@
+package zh07
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeClock(t *testing.T) {
+	c := NewFakeClock(epoch)
+	assert.Equal(t, epoch, c.Now())
+
+	c.Sleep(time.Second)
+	assert.Equal(t, epoch.Add(time.Second), c.Now(), "sleeping advances the clock")
+	assert.Equal(t, time.Second, c.Slept())
+
+	select {
+	case <-c.After(0):
+	default:
+		t.Fatal("After(0) fires right away")
+	}
+
+	late, early := c.After(3*time.Second), c.After(2*time.Second)
+	assert.Equal(t, 2, c.Waiters())
+
+	c.Advance(2 * time.Second)
+	assert.Equal(t, epoch.Add(3*time.Second), <-early)
+	assert.Equal(t, 1, c.Waiters())
+	select {
+	case <-late:
+		t.Fatal("fired too soon")
+	default:
+	}
+
+	c.Advance(time.Hour)
+	assert.Equal(t, epoch.Add(time.Hour+3*time.Second), <-late)
+	assert.Zero(t, c.Waiters())
+	assert.Equal(t, time.Second, c.Slept(), "advancing is not sleeping")
+}
+
+func Test_newTiming(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   timing
+	}{
+		{
+			name:   "defaults",
+			config: Config{},
+			want:   timing{clock: SystemClock, postWriteDelay: defaultPostWriteDelay, frameInterval: defaultFrameInterval},
+		},
+		{
+			name:   "disabled",
+			config: Config{PostWriteDelay: -1, FrameInterval: -1},
+			want:   timing{clock: SystemClock},
+		},
+		{
+			name:   "custom",
+			config: Config{PostWriteDelay: time.Millisecond, ReadTimeout: time.Second, FrameInterval: 2 * time.Second},
+			want:   timing{clock: SystemClock, postWriteDelay: time.Millisecond, readTimeout: time.Second, frameInterval: 2 * time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, newTiming(&tt.config))
+		})
+	}
+}
+
+// tickingReader advances a FakeClock on every read.
+type tickingReader struct {
+	io.Reader
+	clock *FakeClock
+	tick  time.Duration
+}
+
+func (r *tickingReader) Read(p []byte) (int, error) {
+	r.clock.Advance(r.tick)
+	return r.Reader.Read(p)
+}
+
+func TestZH07i_ReadTimeout(t *testing.T) {
+	garbage := bytes.Repeat([]byte{0x42, 0x00}, 100)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		timeout time.Duration
+		checks  []checkFn
+		wantErr error
+	}{
+		{
+			name: "no-timeout",
+			data: garbage,
+			checks: check(
+				hasError(false),
+				isNil,
+			),
+		},
+		{
+			name:    "resynchronises",
+			data:    append(append([]byte{}, garbage[:20]...), sampleInitiativePayload...),
+			timeout: time.Second,
+			checks: check(
+				hasError(false),
+				pm(0x6E, 0x7C, 0x54),
+			),
+		},
+		{
+			name:    "fail-timeout",
+			data:    garbage,
+			timeout: time.Second,
+			checks: check(
+				hasError(true),
+				isNil,
+			),
+			wantErr: ErrTimeout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := NewFakeClock(epoch)
+			z := NewZH07i(&Config{
+				RW:          bufio.NewReadWriter(bufio.NewReaderSize(&tickingReader{bytes.NewReader(tt.data), clock, 100 * time.Millisecond}, 16), nil),
+				Clock:       clock,
+				ReadTimeout: tt.timeout,
+				WarmUp:      -1,
+			})
+
+			got, err := z.Read()
+			for _, c := range tt.checks {
+				c(t, got, err)
+			}
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// advancing calls f, advancing clock by step whenever f waits on it, and
+// returns its result.
+func advancing(clock *FakeClock, step time.Duration, f func() error) error {
+	done := make(chan error, 1)
+	go func() { done <- f() }()
+
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(time.Millisecond):
+			if clock.Waiters() > 0 {
+				clock.Advance(step)
+			}
+		}
+	}
+}
+
+func TestZH07q_StreamFrameInterval(t *testing.T) {
+	var (
+		clock = NewFakeClock(epoch)
+		z     = NewZH07q(&Config{Clock: clock, FrameInterval: 5 * time.Second, WarmUp: -1})
+		times []time.Time
+	)
+	z.writeAndRead = func(_ *bufio.ReadWriter, _ []byte) ([]byte, error) {
+		times = append(times, clock.Now())
+		return sampleQAPayload, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := z.Stream(ctx)
+
+	for i := 0; i < 3; i++ {
+		r := <-ch
+		assert.NoError(t, r.Err)
+
+		// wait for the stream to wait for the next query
+		for clock.Waiters() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		clock.Advance(5 * time.Second)
+	}
+	cancel()
+	for range ch {
+	}
+
+	assert.Equal(t, []time.Time{epoch, epoch.Add(5 * time.Second), epoch.Add(10 * time.Second)}, times[:3])
+}
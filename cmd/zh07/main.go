@@ -0,0 +1,534 @@
+// Command zh07 reads and controls Winsen ZH06/ZH07 and compatible laser dust
+// sensors connected to a serial port.
+//
+// Usage:
+//
+//	zh07 [flags] <command> [arguments]
+//
+// Commands:
+//
+//	read                 take a single reading
+//	stream               print readings until interrupted
+//	mode initiative|qa   switch the communication mode
+//	sleep                enter dormant mode, turning off the laser and the fan
+//	wake                 leave dormant mode
+//	raw <hex> [n]        send a command as is and print the n bytes answered
+//	doctor               run a self-test and report the problems found
+//	decode [file]        print a capture, or stdin, as an annotated hexdump
+//	sniff <tx> <rx>      print the readings exchanged by another microcontroller
+//
+// Readings are printed as text, JSON, CSV or InfluxDB line protocol, see -format.
+// With -capture, every byte exchanged with the sensor is recorded to a file
+// that decode explains and -replay serves back in place of the sensor.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/padiazg/go-zh07"
+)
+
+// errUsage is returned for invalid command lines.
+var errUsage = errors.New("usage")
+
+// env holds what run needs from the outside world.
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	open   func(device string, timeout time.Duration) (io.ReadWriteCloser, error)
+	clock  zh07.Clock
+}
+
+// options holds the global flags.
+type options struct {
+	device   string
+	model    string
+	mode     string
+	format   string
+	init     bool
+	count    int
+	interval time.Duration
+	timeout  time.Duration
+	warmUp   time.Duration
+	capture  string
+	replay   string
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], env{
+		stdin:  os.Stdin,
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+		open:   openSerial,
+		clock:  zh07.SystemClock,
+	}))
+}
+
+// run executes the command line in args and returns the exit code.
+func run(ctx context.Context, args []string, e env) int {
+	var (
+		o  options
+		fs = flag.NewFlagSet("zh07", flag.ContinueOnError)
+	)
+
+	fs.SetOutput(e.stderr)
+	fs.StringVar(&o.device, "device", envOr("ZH07_DEVICE", "/dev/serial0"), "serial `port` the sensor is connected to, $ZH07_DEVICE")
+	fs.StringVar(&o.model, "model", "ZH07", "sensor `model`: ZH06, ZH07, ZH03B, PMS5003 or PMS7003")
+	fs.StringVar(&o.mode, "mode", "qa", "communication `mode` used to read: initiative or qa")
+	fs.StringVar(&o.format, "format", "text", "output `format`: text, json, csv or line")
+	fs.BoolVar(&o.init, "init", true, "switch the sensor to -mode before reading")
+	fs.IntVar(&o.count, "count", 0, "stop streaming after `n` readings, 0 for no limit; queries sent by doctor")
+	fs.DurationVar(&o.interval, "interval", time.Second, "time between queries when streaming in qa mode")
+	fs.DurationVar(&o.timeout, "timeout", 5*time.Second, "how long to wait for the sensor")
+	fs.DurationVar(&o.warmUp, "warmup", -1, "flag readings taken within this time of the mode switch, disabled if negative")
+	fs.StringVar(&o.capture, "capture", "", "record the bytes exchanged with the sensor to `file`, see decode")
+	fs.StringVar(&o.replay, "replay", "", "serve the sensor from a capture `file` instead of -device")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), `Usage: zh07 [flags] <command> [arguments]
+
+Commands:
+  read                 take a single reading
+  stream               print readings until interrupted
+  mode initiative|qa   switch the communication mode
+  sleep                enter dormant mode, turning off the laser and the fan
+  wake                 leave dormant mode
+  raw <hex> [n]        send a command as is and print the n bytes answered
+  doctor               run a self-test and report the problems found
+  decode [file]        print a capture, or stdin, as an annotated hexdump
+  sniff <tx> <rx>      print the readings exchanged by another microcontroller
+
+Flags:
+`)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	if err := execute(ctx, fs.Arg(0), fs.Args()[1:], &o, e); err != nil {
+		fmt.Fprintf(e.stderr, "zh07: %v\n", err)
+		if errors.Is(err, errUsage) {
+			return 2
+		}
+		return 1
+	}
+
+	return 0
+}
+
+// execute runs command cmd with its arguments.
+func execute(ctx context.Context, cmd string, args []string, o *options, e env) error {
+	model, err := parseModel(o.model)
+	if err != nil {
+		return err
+	}
+	mode, err := parseMode(o.mode)
+	if err != nil {
+		return err
+	}
+	f, err := newFormatter(o.format, model.Capabilities().ParticleCounts, map[string]string{
+		"device": o.device,
+		"model":  model.String(),
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+
+	switch cmd {
+	case "read", "stream", "sleep", "wake", "doctor":
+		if len(args) != 0 {
+			return fmt.Errorf("%w: %s takes no arguments", errUsage, cmd)
+		}
+	case "mode":
+		if len(args) != 1 {
+			return fmt.Errorf("%w: mode takes initiative or qa", errUsage)
+		}
+	case "raw":
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("%w: raw takes a command in hex and the length of the answer", errUsage)
+		}
+	case "decode":
+		if len(args) > 1 {
+			return fmt.Errorf("%w: decode takes a capture file or reads stdin", errUsage)
+		}
+		return decode(args, model, e)
+	case "sniff":
+		if len(args) != 2 {
+			return fmt.Errorf("%w: sniff takes the ports tapping the TX and the RX lines", errUsage)
+		}
+		return sniff(ctx, args, model, f, o, e)
+	default:
+		return fmt.Errorf("%w: unknown command %q", errUsage, cmd)
+	}
+
+	if cmd == "doctor" {
+		return doctor(ctx, model, o, e)
+	}
+
+	port, err := openPort(o, e)
+	if err != nil {
+		return err
+	}
+
+	config := &zh07.Config{
+		RW:            bufio.NewReadWriter(bufio.NewReader(port), bufio.NewWriter(port)),
+		Model:         model,
+		WarmUp:        o.warmUp,
+		Closer:        port,
+		Clock:         e.clock,
+		ReadTimeout:   o.timeout,
+		FrameInterval: o.interval,
+	}
+
+	var s zh07.Sensor
+	if mode == zh07.ModeQA {
+		s = zh07.NewZH07q(config)
+	} else {
+		s = zh07.NewZH07i(config)
+	}
+	defer s.Close(context.Background())
+
+	switch cmd {
+	case "read":
+		if err = initialize(s, o); err != nil {
+			return err
+		}
+		return read(s, f, e)
+
+	case "stream":
+		if err = initialize(s, o); err != nil {
+			return err
+		}
+		return stream(ctx, s, f, o.count, e)
+
+	case "mode":
+		m, err := parseMode(args[0])
+		if err != nil {
+			return err
+		}
+		ms, err := capability[zh07.ModeSwitcher](s, "mode")
+		if err != nil {
+			return err
+		}
+		return ms.SetMode(m)
+
+	case "sleep":
+		sl, err := capability[zh07.Sleeper](s, "sleep")
+		if err != nil {
+			return err
+		}
+		return sl.Sleep()
+
+	case "wake":
+		sl, err := capability[zh07.Sleeper](s, "wake")
+		if err != nil {
+			return err
+		}
+		return sl.Wake()
+
+	case "raw":
+		return raw(s, args, e)
+	}
+
+	return nil
+}
+
+// initialize switches the sensor to the selected mode, unless -init=false.
+func initialize(s zh07.Sensor, o *options) error {
+	if !o.init {
+		return nil
+	}
+	ms, err := capability[zh07.ModeSwitcher](s, "init")
+	if err != nil {
+		return err
+	}
+	return ms.SetMode(s.Info().Mode)
+}
+
+// read prints a single reading, skipping anything received before a frame.
+// A reading with a bad checksum is not printed but fails.
+func read(s zh07.Sensor, f formatter, e env) error {
+	for {
+		r, err := s.Read()
+		if err != nil {
+			return err
+		}
+		if r != nil {
+			return f.Write(e.stdout, e.clock.Now(), r)
+		}
+	}
+}
+
+// stream prints readings until ctx is done or count readings were printed.
+// Bad readings are reported and skipped.
+func stream(ctx context.Context, s zh07.Sensor, f formatter, count int, e env) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	st, err := capability[zh07.Streamer](s, "stream")
+	if err != nil {
+		return err
+	}
+
+	var (
+		n       int
+		lastErr error
+	)
+	for r := range st.Stream(ctx) {
+		if lastErr = r.Err; r.Err != nil {
+			fmt.Fprintf(e.stderr, "zh07: %v\n", r.Err)
+			continue
+		}
+		if err := f.Write(e.stdout, e.clock.Now(), r.Reading); err != nil {
+			return err
+		}
+		if n++; count > 0 && n >= count {
+			return nil
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil // interrupted
+	}
+	return lastErr
+}
+
+// raw sends a command as is and prints the answer in hex.
+func raw(s zh07.Sensor, args []string, e env) error {
+	c, err := parseHex(args[0])
+	if err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+
+	var n int
+	if len(args) > 1 {
+		if n, err = strconv.Atoi(args[1]); err != nil || n < 0 {
+			return fmt.Errorf("%w: invalid answer length %q", errUsage, args[1])
+		}
+	}
+
+	rc, err := capability[zh07.RawCommander](s, "raw")
+	if err != nil {
+		return err
+	}
+	answer, err := rc.Command(c, n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		_, err = fmt.Fprintf(e.stdout, "% X\n", answer)
+	}
+
+	return err
+}
+
+// doctor diagnoses the sensor and prints the report, failing if any check failed.
+func doctor(ctx context.Context, model zh07.Model, o *options, e env) error {
+	r := zh07.Diagnose(ctx, &zh07.DoctorConfig{
+		Open:        func() (io.ReadWriteCloser, error) { return openPort(o, e) },
+		Model:       model,
+		Queries:     o.count,
+		Clock:       e.clock,
+		ReadTimeout: o.timeout,
+	})
+
+	if o.format == "json" {
+		if err := json.NewEncoder(e.stdout).Encode(r); err != nil {
+			return err
+		}
+	} else {
+		for _, c := range r.Checks {
+			fmt.Fprintf(e.stdout, "%-4s  %-10s  %s\n", strings.ToUpper(c.Status.String()), c.Name, c.Detail)
+			if c.Hint != "" {
+				fmt.Fprintf(e.stdout, "%18s%s\n", "", c.Hint)
+			}
+		}
+	}
+
+	var failed int
+	for _, c := range r.Checks {
+		if c.Status == zh07.CheckFailed {
+			failed++
+		}
+	}
+	switch {
+	case failed == 1:
+		return errors.New("1 check failed")
+	case failed > 1:
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	return nil
+}
+
+// decode prints a capture as an annotated hexdump.
+func decode(args []string, model zh07.Model, e env) error {
+	r := e.stdin
+	if len(args) > 0 {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	records, err := zh07.ReadCapture(r)
+	if err != nil {
+		return err
+	}
+	return zh07.Annotate(e.stdout, records, model)
+}
+
+// sniff decodes the traffic between a microcontroller and a sensor, tapped
+// on two serial ports, and prints the readings until ctx is done or count
+// readings were printed.
+func sniff(ctx context.Context, ports []string, model zh07.Model, f formatter, o *options, e env) error {
+	var lines [2]io.ReadWriteCloser
+	for i, p := range ports {
+		l, err := e.open(p, 0) // block until the microcontroller or the sensor talks
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+		lines[i] = l
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var n int
+	for ev := range zh07.Sniff(ctx, lines[0], lines[1], &zh07.SnifferConfig{Model: model, Clock: e.clock}) {
+		switch {
+		case ev.Reading != nil:
+			if err := f.Write(e.stdout, ev.Time, ev.Reading); err != nil {
+				return err
+			}
+			if n++; o.count > 0 && n >= o.count {
+				return nil
+			}
+		case ev.Err != nil:
+			fmt.Fprintf(e.stderr, "zh07: %v\n", ev.Err)
+		}
+	}
+
+	return nil
+}
+
+// openPort opens the serial port, or the capture to -replay, recording the
+// bytes exchanged to -capture if set.
+func openPort(o *options, e env) (io.ReadWriteCloser, error) {
+	var (
+		port io.ReadWriteCloser
+		err  error
+	)
+	if o.replay != "" {
+		port, err = openReplay(o.replay, e.clock)
+	} else {
+		port, err = e.open(o.device, o.timeout)
+	}
+	if err != nil || o.capture == "" {
+		return port, err
+	}
+
+	f, err := os.Create(o.capture)
+	if err != nil {
+		port.Close()
+		return nil, err
+	}
+	return &capturedPort{Tap: zh07.NewTap(port, f, &zh07.TapConfig{Clock: e.clock}), file: f}, nil
+}
+
+// openReplay returns a transport serving the capture in path in real time.
+func openReplay(path string, clock zh07.Clock) (io.ReadWriteCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records, err := zh07.ReadCapture(f)
+	if err != nil {
+		return nil, err
+	}
+	return zh07.NewReplay(records, &zh07.ReplayConfig{Realtime: true, Clock: clock}), nil
+}
+
+// capturedPort is a serial port recorded to a capture file.
+type capturedPort struct {
+	*zh07.Tap
+	file *os.File
+}
+
+// Close closes the port and the capture file.
+func (p *capturedPort) Close() error {
+	return errors.Join(p.Tap.Close(), p.Tap.Err(), p.file.Close())
+}
+
+// capability returns s as a T, or an error wrapping zh07.ErrNotSupported
+// naming command cmd when s does not implement T.
+func capability[T any](s zh07.Sensor, cmd string) (T, error) {
+	c, ok := s.(T)
+	if !ok {
+		return c, fmt.Errorf("%w: %s: %T does not implement %v", zh07.ErrNotSupported, cmd, s, reflect.TypeFor[T]())
+	}
+	return c, nil
+}
+
+// parseModel returns the model named name, ignoring case.
+func parseModel(name string) (zh07.Model, error) {
+	for _, m := range []zh07.Model{zh07.ModelZH06, zh07.ModelZH07, zh07.ModelZH03B, zh07.ModelPMS5003, zh07.ModelPMS7003} {
+		if strings.EqualFold(m.String(), name) {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: unknown model %q", errUsage, name)
+}
+
+// parseMode returns the serial communication mode named name.
+func parseMode(name string) (zh07.Mode, error) {
+	switch strings.ToLower(name) {
+	case "initiative":
+		return zh07.ModeInitiative, nil
+	case "qa":
+		return zh07.ModeQA, nil
+	}
+	return 0, fmt.Errorf("%w: unknown mode %q, expected initiative or qa", errUsage, name)
+}
+
+// parseHex decodes bytes written in hex, such as "FF 01 86 00 00 00 00 00 79",
+// "0xFF,0x01,..." or "ff0186...".
+func parseHex(s string) ([]byte, error) {
+	s = strings.NewReplacer("0x", "", "0X", "", " ", "", ",", "", ":", "").Replace(s)
+	return hex.DecodeString(s)
+}
+
+// envOr returns the environment variable key, or def if unset.
+func envOr(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
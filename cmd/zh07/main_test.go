@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/padiazg/go-zh07"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	epoch = time.Date(2025, 6, 17, 12, 0, 0, 0, time.UTC)
+
+	qaAnswer = []byte{0xFF, 0x86, 0x00, 0x85, 0x00, 0x96, 0x00, 0x65, 0xFA}
+
+	initiativeFrame = []byte{
+		0x42, 0x4D, 0x00, 0x1C,
+		0x00, 0x54, 0x00, 0x6E, 0x00, 0x7C,
+		0x00, 0x54, 0x00, 0x6E, 0x00, 0x7C,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x03, 0x27,
+	}
+
+	initiativeBadChecksum = []byte{
+		0x42, 0x4D, 0x00, 0x1C,
+		0x00, 0x54, 0x00, 0x6E, 0x00, 0x7C,
+		0x00, 0x54, 0x00, 0x6E, 0x00, 0x7C,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x03, 0x28,
+	}
+)
+
+// fakePort is a serial port answering known commands.
+type fakePort struct {
+	answers map[string][]byte // answer by command, in hex
+	rx, tx  bytes.Buffer
+	closed  bool
+}
+
+func (p *fakePort) Write(b []byte) (int, error) {
+	p.tx.Write(b)
+	if a, ok := p.answers[hex.EncodeToString(b)]; ok {
+		p.rx.Write(a)
+	}
+	return len(b), nil
+}
+
+func (p *fakePort) Read(b []byte) (int, error) { return p.rx.Read(b) }
+func (p *fakePort) Close() error               { p.closed = true; return nil }
+
+func TestRun(t *testing.T) {
+	query := hex.EncodeToString([]byte{0xFF, 0x01, 0x86, 0x00, 0x00, 0x00, 0x00, 0x00, 0x79})
+
+	tests := []struct {
+		name     string
+		args     []string
+		rx       []byte
+		answers  map[string][]byte
+		want     int
+		wantOut  string
+		wantErr  string
+		wantSent string
+	}{
+		{
+			name:     "read-qa",
+			args:     []string{"read"},
+			answers:  map[string][]byte{query: qaAnswer},
+			wantOut:  "2025-06-17T12:00:00Z PM1.0=101 PM2.5=133 PM10=150\n",
+			wantSent: "ff0178410000000046" + query,
+		},
+		{
+			name:    "read-json",
+			args:    []string{"-format", "json", "-init=false", "read"},
+			answers: map[string][]byte{query: qaAnswer},
+			wantOut: `{"time":"2025-06-17T12:00:00.25Z","pm1":101,"pm25":133,"pm10":150,"flags":"ok"}` + "\n",
+		},
+		{
+			name:    "read-initiative-line",
+			args:    []string{"-mode", "initiative", "-format", "line", "-device", "/dev/tty S0", "read"},
+			rx:      append([]byte{0x00, 0x11}, initiativeFrame...),
+			wantOut: `zh07,device=/dev/tty\ S0,model=ZH07 pm1=84i,pm25=110i,pm10=124i,flags="ok" 1750161600250000000` + "\n",
+		},
+		{
+			name:    "stream-csv",
+			args:    []string{"-mode", "initiative", "-format", "csv", "-count", "2", "stream"},
+			rx:      append(append([]byte{}, initiativeFrame...), initiativeFrame...),
+			wantOut: "time,pm1,pm25,pm10,flags\n2025-06-17T12:00:00Z,84,110,124,ok\n2025-06-17T12:00:00Z,84,110,124,ok\n",
+		},
+		{
+			name:    "stream-skips-checksum-initiative",
+			args:    []string{"-mode", "initiative", "-format", "line", "-count", "1", "stream"},
+			rx:      append(append([]byte{}, initiativeBadChecksum...), initiativeFrame...),
+			wantOut: `zh07,device=/dev/serial0,model=ZH07 pm1=84i,pm25=110i,pm10=124i,flags="ok" 1750161600250000000` + "\n",
+			wantErr: "checksum mismatch",
+		},
+		{
+			name:    "stream-ends-with-port",
+			args:    []string{"-mode", "initiative", "-init=false", "stream"},
+			rx:      initiativeFrame,
+			want:    1,
+			wantOut: "2025-06-17T12:00:00Z PM1.0=84 PM2.5=110 PM10=124\n",
+			wantErr: "sensor communication failed",
+		},
+		{
+			name:     "mode",
+			args:     []string{"mode", "initiative"},
+			wantSent: "ff0178400000000047",
+		},
+		{
+			name:     "sleep",
+			args:     []string{"sleep"},
+			wantSent: "ff01a7010000000057",
+		},
+		{
+			name:     "wake-pms5003",
+			args:     []string{"-model", "pms5003", "wake"},
+			wantSent: "424de400010174",
+		},
+		{
+			name:     "raw",
+			args:     []string{"raw", "0xFF 0x01 0x86 0x00 0x00 0x00 0x00 0x00 0x79", "9"},
+			answers:  map[string][]byte{query: qaAnswer},
+			wantOut:  "FF 86 00 85 00 96 00 65 FA\n",
+			wantSent: query,
+		},
+		{
+			name:    "fail-no-command",
+			args:    []string{},
+			want:    2,
+			wantErr: "Usage: zh07",
+		},
+		{
+			name:    "fail-unknown-command",
+			args:    []string{"explode"},
+			want:    2,
+			wantErr: `unknown command "explode"`,
+		},
+		{
+			name:    "fail-format",
+			args:    []string{"-format", "xml", "read"},
+			want:    2,
+			wantErr: "unknown output format",
+		},
+		{
+			name:    "fail-model",
+			args:    []string{"-model", "sds011", "read"},
+			want:    2,
+			wantErr: "unknown model",
+		},
+		{
+			name:    "fail-mode",
+			args:    []string{"mode", "pwm"},
+			want:    2,
+			wantErr: "unknown mode",
+		},
+		{
+			name:    "fail-raw-hex",
+			args:    []string{"raw", "zz"},
+			want:    2,
+			wantErr: "invalid byte",
+		},
+		{
+			name:    "fail-checksum",
+			args:    []string{"read"},
+			answers: map[string][]byte{query: {0xFF, 0x86, 0x00, 0x85, 0x00, 0x96, 0x00, 0x65, 0xFB}},
+			want:    1,
+			wantErr: "checksum mismatch",
+		},
+		{
+			name:    "fail-checksum-initiative",
+			args:    []string{"-mode", "initiative", "-format", "csv", "read"},
+			rx:      initiativeBadChecksum,
+			want:    1,
+			wantErr: "checksum mismatch",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				stdout, stderr bytes.Buffer
+				port           = &fakePort{answers: tt.answers}
+				opened         bool
+			)
+			port.rx.Write(tt.rx)
+
+			got := run(context.Background(), tt.args, env{
+				stdout: &stdout,
+				stderr: &stderr,
+				open: func(device string, _ time.Duration) (io.ReadWriteCloser, error) {
+					opened = true
+					return port, nil
+				},
+				clock: zh07.NewFakeClock(epoch),
+			})
+
+			assert.Equal(t, tt.want, got, stderr.String())
+			assert.Equal(t, tt.wantOut, stdout.String())
+			if tt.wantErr != "" {
+				assert.Contains(t, stderr.String(), tt.wantErr)
+			}
+			if tt.wantSent != "" {
+				assert.Equal(t, tt.wantSent, hex.EncodeToString(port.tx.Bytes()))
+			}
+			if opened {
+				assert.True(t, port.closed, "the port is closed")
+			}
+		})
+	}
+}
+
+func Test_parseHex(t *testing.T) {
+	for _, s := range []string{"FF 01 86", "0xFF,0x01,0x86", "ff0186", "ff:01:86"} {
+		got, err := parseHex(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, []byte{0xFF, 0x01, 0x86}, got, s)
+	}
+}
+
+// bareSensor only implements zh07.Sensor.
+type bareSensor struct{}
+
+func (bareSensor) Read() (*zh07.Reading, error)    { return nil, nil }
+func (bareSensor) Info() zh07.Info                 { return zh07.Info{} }
+func (bareSensor) Close(ctx context.Context) error { return nil }
+
+func Test_capability(t *testing.T) {
+	_, err := capability[zh07.Sleeper](bareSensor{}, "sleep")
+	assert.ErrorIs(t, err, zh07.ErrNotSupported)
+	assert.EqualError(t, err, "operation not supported: sleep: main.bareSensor does not implement zh07.Sleeper")
+
+	err = stream(context.Background(), bareSensor{}, nil, 0, env{})
+	assert.ErrorIs(t, err, zh07.ErrNotSupported, "reported, not a panic")
+
+	sl, err := capability[zh07.Sleeper](zh07.NewZH07q(nil), "sleep")
+	assert.NoError(t, err)
+	assert.NotNil(t, sl)
+}
+
+func Test_parseModel(t *testing.T) {
+	for _, m := range []zh07.Model{zh07.ModelZH06, zh07.ModelZH07, zh07.ModelZH03B, zh07.ModelPMS5003, zh07.ModelPMS7003} {
+		got, err := parseModel(strings.ToLower(m.String()))
+		assert.NoError(t, err)
+		assert.Equal(t, m, got)
+	}
+}
+
+func TestRun_doctor(t *testing.T) {
+	query := hex.EncodeToString([]byte{0xFF, 0x01, 0x86, 0x00, 0x00, 0x00, 0x00, 0x00, 0x79})
+
+	var (
+		stdout, stderr bytes.Buffer
+		port           = &fakePort{answers: map[string][]byte{query: qaAnswer}}
+	)
+	got := run(context.Background(), []string{"-count", "3", "doctor"}, env{
+		stdout: &stdout,
+		stderr: &stderr,
+		open:   func(string, time.Duration) (io.ReadWriteCloser, error) { return port, nil },
+		clock:  zh07.NewFakeClock(epoch),
+	})
+
+	// the fake port never sends initiative upload frames
+	assert.Equal(t, 1, got)
+	assert.Contains(t, stdout.String(), "PASS  query       3 queries answered\n")
+	assert.Contains(t, stdout.String(), "FAIL  frame rate  0 frames received")
+	assert.Contains(t, stdout.String(), "\n                  no frames after switching")
+	assert.Equal(t, "zh07: 1 check failed\n", stderr.String())
+	assert.True(t, port.closed, "the port is closed")
+
+	stdout.Reset()
+	stderr.Reset()
+	got = run(context.Background(), []string{"-device", "/dev/ttyUSB0", "-format", "json", "doctor"}, env{
+		stdout: &stdout,
+		stderr: &stderr,
+		open: func(device string, _ time.Duration) (io.ReadWriteCloser, error) {
+			return nil, errors.New("open " + device + ": permission denied")
+		},
+		clock: zh07.NewFakeClock(epoch),
+	})
+
+	assert.Equal(t, 1, got)
+	assert.Contains(t, stdout.String(), `{"checks":[{"name":"port","status":"fail","detail":"open /dev/ttyUSB0: permission denied"`)
+	assert.Equal(t, "zh07: 1 check failed\n", stderr.String(), "the other checks are skipped")
+}
+
+func TestRun_capture(t *testing.T) {
+	var (
+		query   = hex.EncodeToString([]byte{0xFF, 0x01, 0x86, 0x00, 0x00, 0x00, 0x00, 0x00, 0x79})
+		capture = filepath.Join(t.TempDir(), "session.cap")
+		port    = &fakePort{answers: map[string][]byte{query: qaAnswer}}
+
+		stdout, stderr bytes.Buffer
+	)
+	e := env{
+		stdin:  strings.NewReader(""),
+		stdout: &stdout,
+		stderr: &stderr,
+		open:   func(string, time.Duration) (io.ReadWriteCloser, error) { return port, nil },
+		clock:  zh07.NewFakeClock(epoch),
+	}
+
+	assert.Equal(t, 0, run(context.Background(), []string{"-capture", capture, "read"}, e), stderr.String())
+	assert.True(t, port.closed, "the port is closed")
+
+	stdout.Reset()
+	assert.Equal(t, 0, run(context.Background(), []string{"decode", capture}, e), stderr.String())
+	assert.Equal(t, ""+
+		"    0.000000 TX  FF 01 78 41 00 00 00 00 46                       set question and answer mode\n"+
+		"    0.250000 TX  FF 01 86 00 00 00 00 00 79                       query\n"+
+		"    0.500000 RX  FF 86 00 85 00 96 00 65 FA                       answer: PM1.0=101 PM2.5=133 PM10=150, checksum ok\n",
+		stdout.String())
+
+	stdout.Reset()
+	e.stdin = strings.NewReader("0 TX FF0186000000000079\n")
+	assert.Equal(t, 0, run(context.Background(), []string{"decode"}, e), stderr.String())
+	assert.Contains(t, stdout.String(), "query")
+
+	stdout.Reset()
+	assert.Equal(t, 0, run(context.Background(), []string{"-replay", capture, "-format", "csv", "read"}, e), stderr.String())
+	assert.Equal(t, "time,pm1,pm25,pm10,flags\n2025-06-17T12:00:01Z,101,133,150,ok\n", stdout.String(),
+		"the replay serves the answer in time")
+
+	assert.Equal(t, 1, run(context.Background(), []string{"-replay", capture, "mode", "initiative"}, e))
+	assert.Contains(t, stderr.String(), "zh07: replay diverged: wrote FF0178400000000047, expected FF0178410000000046")
+
+	e.stdin = strings.NewReader("0 TX FF01860\n")
+	assert.Equal(t, 1, run(context.Background(), []string{"decode"}, e))
+	assert.Contains(t, stderr.String(), "invalid capture: line 1")
+}
+
+func TestRun_sniff(t *testing.T) {
+	var (
+		stdout, stderr bytes.Buffer
+		ports          = map[string]*fakePort{"/dev/ttyUSB0": {}, "/dev/ttyUSB1": {}}
+		timeouts       []time.Duration
+	)
+	ports["/dev/ttyUSB0"].rx.Write([]byte{0xFF, 0x01, 0x78, 0x40, 0x00, 0x00, 0x00, 0x00, 0x47})
+	ports["/dev/ttyUSB1"].rx.Write(append(append([]byte{}, initiativeFrame...), 0x13))
+
+	got := run(context.Background(), []string{"-format", "csv", "sniff", "/dev/ttyUSB0", "/dev/ttyUSB1"}, env{
+		stdout: &stdout,
+		stderr: &stderr,
+		open: func(device string, timeout time.Duration) (io.ReadWriteCloser, error) {
+			timeouts = append(timeouts, timeout)
+			return ports[device], nil
+		},
+		clock: zh07.NewFakeClock(epoch),
+	})
+
+	assert.Equal(t, 0, got, stderr.String())
+	assert.Equal(t, "time,pm1,pm25,pm10,flags\n2025-06-17T12:00:00Z,84,110,124,ok\n", stdout.String())
+	assert.Equal(t, "zh07: invalid data frame: stray byte\n", stderr.String())
+	assert.Equal(t, []time.Duration{0, 0}, timeouts, "reads block")
+	for _, p := range ports {
+		assert.True(t, p.closed, "the ports are closed")
+	}
+
+	got = run(context.Background(), []string{"sniff", "/dev/ttyUSB0"}, env{stderr: &stderr})
+	assert.Equal(t, 2, got)
+}
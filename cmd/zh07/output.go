@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/padiazg/go-zh07"
+)
+
+// formatter writes readings in one of the output formats.
+type formatter interface {
+	Write(w io.Writer, at time.Time, r *zh07.Reading) error
+}
+
+// newFormatter returns the formatter for name: text, json, csv or line.
+// The line protocol uses tags to identify the sensor.
+func newFormatter(name string, counts bool, tags map[string]string) (formatter, error) {
+	switch name {
+	case "text":
+		return &textFormatter{counts: counts}, nil
+	case "json":
+		return &jsonFormatter{counts: counts}, nil
+	case "csv":
+		return &csvFormatter{counts: counts}, nil
+	case "line":
+		return &lineFormatter{counts: counts, tags: tags}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q, expected text, json, csv or line", name)
+}
+
+// countFields returns the names and values of the particle counts.
+func countFields(c zh07.ParticleCounts) ([]string, []int) {
+	return []string{"gt03", "gt05", "gt10", "gt25", "gt50", "gt100"},
+		[]int{c.Gt03, c.Gt05, c.Gt10, c.Gt25, c.Gt50, c.Gt100}
+}
+
+// textFormatter writes readings for humans.
+type textFormatter struct {
+	counts bool
+}
+
+func (f *textFormatter) Write(w io.Writer, at time.Time, r *zh07.Reading) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s PM1.0=%d PM2.5=%d PM10=%d", at.Format(time.RFC3339), r.PM1, r.PM25, r.PM10)
+	if f.counts {
+		names, values := countFields(r.Counts)
+		for i := range names {
+			fmt.Fprintf(&b, " %s=%d", names[i], values[i])
+		}
+	}
+	if r.Flags != 0 {
+		fmt.Fprintf(&b, " [%s]", r.Flags)
+	}
+
+	_, err := fmt.Fprintln(w, b.String())
+	return err
+}
+
+// jsonReading is the JSON representation of a reading.
+type jsonReading struct {
+	Time   time.Time      `json:"time"`
+	PM1    int            `json:"pm1"`
+	PM25   int            `json:"pm25"`
+	PM10   int            `json:"pm10"`
+	Counts map[string]int `json:"counts,omitempty"`
+	Flags  string         `json:"flags"`
+}
+
+// jsonFormatter writes a JSON object per line.
+type jsonFormatter struct {
+	counts bool
+}
+
+func (f *jsonFormatter) Write(w io.Writer, at time.Time, r *zh07.Reading) error {
+	j := jsonReading{Time: at, PM1: r.PM1, PM25: r.PM25, PM10: r.PM10, Flags: r.Flags.String()}
+	if f.counts {
+		names, values := countFields(r.Counts)
+		j.Counts = make(map[string]int, len(names))
+		for i := range names {
+			j.Counts[names[i]] = values[i]
+		}
+	}
+
+	return json.NewEncoder(w).Encode(j)
+}
+
+// csvFormatter writes a header followed by a row per reading.
+type csvFormatter struct {
+	counts bool
+	header bool
+}
+
+func (f *csvFormatter) Write(w io.Writer, at time.Time, r *zh07.Reading) error {
+	names, values := countFields(r.Counts)
+
+	if !f.header {
+		f.header = true
+		h := "time,pm1,pm25,pm10"
+		if f.counts {
+			h += "," + strings.Join(names, ",")
+		}
+		if _, err := fmt.Fprintln(w, h+",flags"); err != nil {
+			return err
+		}
+	}
+
+	row := fmt.Sprintf("%s,%d,%d,%d", at.Format(time.RFC3339), r.PM1, r.PM25, r.PM10)
+	if f.counts {
+		for _, v := range values {
+			row += fmt.Sprintf(",%d", v)
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "%s,%s\n", row, r.Flags)
+	return err
+}
+
+// lineFormatter writes the InfluxDB line protocol.
+type lineFormatter struct {
+	counts bool
+	tags   map[string]string
+}
+
+func (f *lineFormatter) Write(w io.Writer, at time.Time, r *zh07.Reading) error {
+	var b strings.Builder
+
+	b.WriteString("zh07")
+	for _, k := range []string{"device", "model"} {
+		if v, ok := f.tags[k]; ok && v != "" {
+			fmt.Fprintf(&b, ",%s=%s", k, lineEscaper.Replace(v))
+		}
+	}
+
+	fmt.Fprintf(&b, " pm1=%di,pm25=%di,pm10=%di", r.PM1, r.PM25, r.PM10)
+	if f.counts {
+		names, values := countFields(r.Counts)
+		for i := range names {
+			fmt.Fprintf(&b, ",%s=%di", names[i], values[i])
+		}
+	}
+	fmt.Fprintf(&b, ",flags=%q %d", r.Flags.String(), at.UnixNano())
+
+	_, err := fmt.Fprintln(w, b.String())
+	return err
+}
+
+// lineEscaper escapes tag values for the line protocol.
+var lineEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/padiazg/go-zh07"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatters(t *testing.T) {
+	var (
+		r = &zh07.Reading{
+			PM1: 5, PM25: 8, PM10: 11,
+			Counts: zh07.ParticleCounts{Gt03: 900, Gt05: 250, Gt10: 40, Gt25: 6, Gt50: 2, Gt100: 1},
+			Flags:  zh07.FlagWarmingUp,
+		}
+		tags = map[string]string{"device": "/dev/ttyAMA0", "model": "PMS5003"}
+	)
+
+	tests := []struct {
+		format string
+		counts bool
+		twice  bool
+		want   string
+	}{
+		{
+			format: "text",
+			want:   "2025-06-17T12:00:00Z PM1.0=5 PM2.5=8 PM10=11 [warming-up]\n",
+		},
+		{
+			format: "text",
+			counts: true,
+			want:   "2025-06-17T12:00:00Z PM1.0=5 PM2.5=8 PM10=11 gt03=900 gt05=250 gt10=40 gt25=6 gt50=2 gt100=1 [warming-up]\n",
+		},
+		{
+			format: "json",
+			counts: true,
+			want: `{"time":"2025-06-17T12:00:00Z","pm1":5,"pm25":8,"pm10":11,` +
+				`"counts":{"gt03":900,"gt05":250,"gt10":40,"gt100":1,"gt25":6,"gt50":2},"flags":"warming-up"}` + "\n",
+		},
+		{
+			format: "csv",
+			counts: true,
+			twice:  true,
+			want: "time,pm1,pm25,pm10,gt03,gt05,gt10,gt25,gt50,gt100,flags\n" +
+				"2025-06-17T12:00:00Z,5,8,11,900,250,40,6,2,1,warming-up\n" +
+				"2025-06-17T12:00:00Z,5,8,11,900,250,40,6,2,1,warming-up\n",
+		},
+		{
+			format: "line",
+			want:   `zh07,device=/dev/ttyAMA0,model=PMS5003 pm1=5i,pm25=8i,pm10=11i,flags="warming-up" 1750161600000000000` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			f, err := newFormatter(tt.format, tt.counts, tags)
+			assert.NoError(t, err)
+
+			var b bytes.Buffer
+			assert.NoError(t, f.Write(&b, epoch, r))
+			if tt.twice {
+				assert.NoError(t, f.Write(&b, epoch, r), "the header is written once")
+			}
+			assert.Equal(t, tt.want, b.String())
+		})
+	}
+
+	_, err := newFormatter("yaml", false, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,66 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// cbaud masks the speed bits of c_cflag: every speed code only uses bits of
+// the highest one.
+const cbaud = syscall.B4000000
+
+// openSerial opens a tty in raw mode at 9600 8N1, as required by the sensor.
+// Reads return after timeout without data, rounded to tenths of a second, or
+// block until data arrives if timeout is zero.
+func openSerial(path string, timeout time.Duration) (io.ReadWriteCloser, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var t syscall.Termios
+	if err = ioctl(f, syscall.TCGETS, &t); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s is not a tty: %w", path, err)
+	}
+
+	// raw mode, see cfmakeraw(3)
+	t.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON | syscall.IXOFF
+	t.Oflag &^= syscall.OPOST
+	t.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	t.Cflag &^= syscall.CSIZE | syscall.PARENB | syscall.CSTOPB | cbaud
+	t.Cflag |= syscall.CS8 | syscall.CREAD | syscall.CLOCAL | syscall.B9600
+	t.Ispeed, t.Ospeed = syscall.B9600, syscall.B9600
+
+	if timeout > 0 {
+		// block until at least one byte arrives or the timeout expires
+		t.Cc[syscall.VMIN] = 0
+		t.Cc[syscall.VTIME] = uint8(min(255, max(1, timeout/(100*time.Millisecond))))
+	} else {
+		// block until at least one byte arrives
+		t.Cc[syscall.VMIN] = 1
+		t.Cc[syscall.VTIME] = 0
+	}
+
+	if err = ioctl(f, syscall.TCSETS, &t); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("configuring %s: %w", path, err)
+	}
+
+	return f, nil
+}
+
+// ioctl gets or sets the terminal attributes of f.
+func ioctl(f *os.File, req uintptr, t *syscall.Termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, uintptr(unsafe.Pointer(t))); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/padiazg/go-zh07"
+)
+
+// openSerial always fails outside Linux.
+func openSerial(path string, timeout time.Duration) (io.ReadWriteCloser, error) {
+	return nil, fmt.Errorf("%w: serial ports require Linux", zh07.ErrNotSupported)
+}
@@ -7,6 +7,9 @@
 //   - Initiative upload mode: The sensor continuously broadcasts readings
 //   - Question and answer mode: Readings are requested on demand
 //
+// Boards without a spare UART can decode the PWM output (pin 8) instead, which
+// only carries the PM2.5 concentration.
+//
 // Example usage:
 //
 //	// Create a sensor instance for Q&A mode
@@ -27,6 +30,7 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"time"
 )
 
@@ -37,12 +41,62 @@ var (
 	ErrInvalidFrame = errors.New("invalid data frame")
 	// ErrSensorCommunication is returned when communication with the sensor fails
 	ErrSensorCommunication = errors.New("sensor communication failed")
+	// ErrOutlier is returned when a filter rejects a reading as an outlier
+	ErrOutlier = errors.New("outlier rejected")
+	// ErrNoSamples is returned when no valid reading could be collected
+	ErrNoSamples = errors.New("no valid samples")
+	// ErrNotSupported is returned when an operation is not supported by the sensor or platform
+	ErrNotSupported = errors.New("operation not supported")
+	// ErrRateLimited is returned when an operation is attempted again too soon
+	ErrRateLimited = errors.New("rate limited")
+	// ErrClosed is returned when a sensor is used after Close
+	ErrClosed = errors.New("sensor closed")
+	// ErrTimeout is returned when no frame could be found within Config.ReadTimeout
+	ErrTimeout = errors.New("timeout")
+	// ErrInvalidCapture is returned when a capture file cannot be parsed
+	ErrInvalidCapture = errors.New("invalid capture")
+	// ErrDivergence is returned when a driver does not behave as in the capture being replayed
+	ErrDivergence = errors.New("replay diverged")
 )
 
 // Config holds configuration options for sensor instances.
 type Config struct {
 	// RW is the ReadWriter interface for communicating with the sensor
 	RW *bufio.ReadWriter
+	// Model selects the frame layout and the command set, ModelZH07 if zero
+	Model Model
+	// PWM is the source of edges of the PWM output, used by ZH07p
+	PWM EdgeSource
+	// WarmUp is how long readings are considered unstable after power-up,
+	// waking up or a mode change, 30s if zero. A negative value disables it.
+	WarmUp time.Duration
+	// Closer is closed by Close, set it when the sensor owns the transport,
+	// such as the serial port behind RW
+	Closer io.Closer
+	// SleepOnClose puts the sensor into dormant mode on Close
+	SleepOnClose bool
+
+	// Clock is used for every delay, SystemClock if nil
+	Clock Clock
+	// PostWriteDelay is how long to wait for a command to be executed,
+	// 250ms if zero. A negative value disables it.
+	PostWriteDelay time.Duration
+	// ReadTimeout is how long a read in initiative upload mode keeps looking
+	// for a frame before failing with ErrTimeout. If zero, the read returns
+	// nil as soon as the bytes received do not start a frame. It does not
+	// interrupt a blocked read, set a timeout on the port for that.
+	ReadTimeout time.Duration
+	// FrameInterval is the time between queries when streaming in question
+	// and answer mode, 1s if zero. A negative value disables it.
+	FrameInterval time.Duration
+	// FrameEvents is called by ZH07i and ZH07q when frames are lost,
+	// backlogged or resynchronised in initiative upload mode. It is called
+	// from Read and should not block.
+	FrameEvents func(e FrameEvent)
+	// Metrics receives the frames read, the checksum failures, the
+	// resynchronisations and the round trip time of the commands of ZH07i and
+	// ZH07q, nothing is measured if nil
+	Metrics Metrics
 }
 
 // Reading represents a sensor reading with particulate matter concentrations.
@@ -50,6 +104,10 @@ type Reading struct {
 	PM1  int // Mass Concentration PM1.0 [μg/m³]
 	PM25 int // Mass Concentration PM2.5 [μg/m³]
 	PM10 int // Mass Concentration PM10 [μg/m³]
+
+	Counts ParticleCounts // Particle counts per 0.1L, Plantower models only
+
+	Flags QualityFlag // Quality-control flags, set by a QualityChecker
 }
 
 var (
@@ -89,31 +147,29 @@ var (
 		0x79,
 	}
 
-	// commandDormantEnter = []byte{ // enter dormant mode
-	// 	0xFF,
-	// 	0x01,
-	// 	0xA7,
-	// 	0x01,
-	// 	0x00,
-	// 	0x00,
-	// 	0x00,
-	// 	0x00,
-	// 	0x57,
-	// }
-
-	// commandDormantQuit = []byte{ // quit dormant mode
-	// 	0xFF,
-	// 	0x01,
-	// 	0xA7,
-	// 	0x00,
-	// 	0x00,
-	// 	0x00,
-	// 	0x00,
-	// 	0x00,
-	// 	0x58,
-	// }
-
-	sleepAfterWrite = 250 * time.Millisecond
+	commandDormantEnter = []byte{ // enter dormant mode
+		0xFF,
+		0x01,
+		0xA7,
+		0x01,
+		0x00,
+		0x00,
+		0x00,
+		0x00,
+		0x57,
+	}
+
+	commandDormantQuit = []byte{ // quit dormant mode
+		0xFF,
+		0x01,
+		0xA7,
+		0x00,
+		0x00,
+		0x00,
+		0x00,
+		0x00,
+		0x58,
+	}
 )
 
 // calculateChecksum computes the checksum for sensor data validation.
@@ -141,16 +197,19 @@ func toHex(data []byte) string {
 	return result
 }
 
-// writeAndRead writes a command to the sensor and returns the response.
-func writeAndRead(rw *bufio.ReadWriter, c []byte) ([]byte, error) {
+// writeAndRead writes a command to the sensor, calls wait and reads the
+// response into r.
+// Bytes left over from an earlier response, such as a byte received twice,
+// are discarded first so that they are not taken for the start of this one.
+func writeAndRead(rw *bufio.ReadWriter, c, r []byte, wait func()) ([]byte, error) {
+	rw.Reader.Discard(rw.Reader.Buffered())
 	if err := write(rw, c); err != nil {
 		return nil, err
 	}
-	time.Sleep(sleepAfterWrite) // wait for the response
+	wait() // wait for the response
 
-	r := make([]byte, 9)                  // buffer to receive response
-	if _, err := rw.Read(r); err != nil { // read response from tty
-		return nil, err
+	if _, err := io.ReadFull(rw, r); err != nil { // read response from tty, even if split across reads
+		return nil, fmt.Errorf("%w: %v", ErrSensorCommunication, err)
 	}
 
 	return r, nil
@@ -164,3 +223,30 @@ func write(rw *bufio.ReadWriter, c []byte) error {
 
 	return rw.Writer.Flush() // flush write buffer
 }
+
+// command writes c, calls wait and reads the n bytes answered, if any.
+func command(rw *bufio.ReadWriter, write func(rw *bufio.ReadWriter, c []byte) error, c []byte, n int, wait func()) ([]byte, error) {
+	if err := write(rw, c); err != nil {
+		return nil, err
+	}
+	wait() // wait for the response
+
+	if n <= 0 {
+		return nil, nil
+	}
+
+	r := make([]byte, n)
+	if _, err := io.ReadFull(rw, r); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSensorCommunication, err)
+	}
+
+	return r, nil
+}
+
+// flush writes any buffered data to the sensor.
+func flush(rw *bufio.ReadWriter) error {
+	if rw == nil || rw.Writer == nil {
+		return nil
+	}
+	return rw.Writer.Flush()
+}
@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"bytes"
 	"testing"
-	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -36,42 +35,82 @@ var (
 	isNil = func(t *testing.T, r *Reading, err error) {
 		assert.Empty(t, r)
 	}
+
+	isChecksumMismatch = func(t *testing.T, _ *Reading, err error) {
+		t.Helper()
+		assert.ErrorIs(t, err, ErrChecksumMismatch)
+	}
 )
 
-func dummyCommandResponder(t *testing.T, r0 *bufio.ReadWriter, c, r []byte) {
-	b := make([]byte, 9) // buffer to receive response
-	for {
-		if _, e := r0.Read(b); e != nil { // read response from tty
-			// command received?
-			if b[0] == c[0] && b[1] == c[1] && b[8] == c[8] {
-				// write response
-				_, e := r0.Write(r)
-				if e != nil { // write commant to tty
-					t.Error(e)
-				}
-				r0.Writer.Flush()
-				break
-			}
-		}
-		time.Sleep(sleepAfterWrite)
+// scriptedSensor is a SensorInterface that replays a fixed list of results.
+type scriptedSensor struct {
+	readings []*Reading
+	errs     []error
+	calls    int
+	inits    int
+	initErr  error
+}
+
+func (s *scriptedSensor) Init() error             { s.inits++; return s.initErr }
+func (s *scriptedSensor) CalculateChecksum() int  { return 0 }
+func (s *scriptedSensor) IsReadingValid() bool    { return true }
+func (s *scriptedSensor) Read() (*Reading, error) { return s.next() }
+
+func (s *scriptedSensor) next() (*Reading, error) {
+	i := s.calls
+	s.calls++
+
+	var (
+		r   *Reading
+		err error
+	)
+	if i < len(s.readings) {
+		r = s.readings[i]
+	}
+	if i < len(s.errs) {
+		err = s.errs[i]
+	}
+
+	return r, err
+}
+
+// same returns a reading with the same value on every channel.
+func same(v int) *Reading {
+	return &Reading{PM1: v, PM25: v, PM10: v}
+}
+
+// responder is a fake serial port answering a command with a response.
+type responder struct {
+	command, response []byte
+	tx, rx            bytes.Buffer
+}
+
+func (p *responder) Write(b []byte) (int, error) {
+	p.tx.Write(b)
+	if bytes.HasSuffix(p.tx.Bytes(), p.command) {
+		p.rx.Write(p.response)
 	}
+	return len(b), nil
+}
+
+func (p *responder) Read(b []byte) (int, error) { return p.rx.Read(b) }
+
+// newResponder returns a ReadWriter over a fake serial port answering c with r.
+func newResponder(c, r []byte) *bufio.ReadWriter {
+	p := &responder{command: c, response: r}
+	return bufio.NewReadWriter(bufio.NewReader(p), bufio.NewWriter(p))
 }
 
 func Test_writeAndRead(t *testing.T) {
 	var (
 		command  = []byte{0xFF, 0x86, 0x00, 0x47, 0x00, 0xC7, 0x03, 0x0F, 0x5A}
 		response = []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09}
-		b        = &bytes.Buffer{}
-		// buffer to simulate tty
-		rw = bufio.NewReadWriter(
-			bufio.NewReader(b),
-			bufio.NewWriter(b),
-		)
+		// fake tty
+		rw     = newResponder(command, response)
+		waited bool
 	)
 
-	go dummyCommandResponder(t, rw, command, response)
-
-	res, e0 := writeAndRead(rw, command)
+	res, e0 := writeAndRead(rw, command, make([]byte, 9), func() { waited = true })
 	if e0 != nil {
 		t.Errorf("Test_writeAndRead | Sending command: %v", e0)
 	}
@@ -81,6 +120,9 @@ func Test_writeAndRead(t *testing.T) {
 			t.Errorf("Test_writeAndRead | At response index %d. Got %X, expected %X", i, v, response[i])
 		}
 	}
+	if !waited {
+		t.Errorf("Test_writeAndRead | did not wait for the response")
+	}
 }
 
 func Test_calculateChecksum(t *testing.T) {
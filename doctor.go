@@ -0,0 +1,517 @@
+package zh07
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	defaultDoctorQueries         = 10
+	defaultDoctorFrames          = 5
+	defaultDoctorMaxLatency      = 500 * time.Millisecond
+	defaultDoctorMaxChecksumRate = 0.1
+	defaultDoctorFrameInterval   = time.Second
+	defaultDoctorReadTimeout     = 3 * time.Second
+)
+
+// Remediation hints attached to the checks that did not pass.
+const (
+	hintPort      = "check the device path and its permissions (membership of the dialout group, for instance) and that no other process holds the port"
+	hintGarbage   = "bytes arrive but never form a frame: check the port runs at 9600 8N1, the model matches the sensor and the sensor TX pin is wired to the RX of the adapter with a common ground"
+	hintNoAnswer  = "the sensor does not answer: check the sensor RX pin is wired to the TX of the adapter, that it is powered with 5V and its fan spins; a 3.3V UART may need level shifting"
+	hintLatency   = "answers are slow: another process may be reading from the port, or the adapter buffers data (lower the latency timer of USB adapters)"
+	hintChecksum  = "bytes are corrupted on the line: shorten the cable, check the common ground and the level shifting, and keep the wiring away from motors and power supplies"
+	hintDormant   = "the sensor did not answer after leaving dormant mode: power-cycle it; if it keeps happening its firmware may not support dormant mode"
+	hintNoFrames  = "no frames after switching to initiative upload mode: the sensor may not have received the mode command, check the wiring of its RX pin"
+	hintFrameRate = "frames arrive slower than expected: some may be lost to corruption, or the sensor is in a low-power mode"
+	hintRestore   = "the sensor may be left in another mode, switch it back with SetMode or `zh07 mode`"
+)
+
+// CheckStatus is the outcome of a diagnostic check.
+type CheckStatus int
+
+const (
+	// CheckPassed means nothing wrong was found
+	CheckPassed CheckStatus = iota
+	// CheckWarning means the sensor works but something looks wrong
+	CheckWarning
+	// CheckFailed means the sensor does not work as expected
+	CheckFailed
+	// CheckSkipped means the check could not run, see the detail
+	CheckSkipped
+)
+
+// String returns the name of the status.
+func (s CheckStatus) String() string {
+	switch s {
+	case CheckPassed:
+		return "pass"
+	case CheckWarning:
+		return "warn"
+	case CheckFailed:
+		return "fail"
+	case CheckSkipped:
+		return "skip"
+	default:
+		return fmt.Sprintf("CheckStatus(%d)", int(s))
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler so the status is rendered by
+// name in JSON documents.
+func (s CheckStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// DoctorCheck is the outcome of one of the checks run by Diagnose.
+type DoctorCheck struct {
+	Name   string      `json:"name"`
+	Status CheckStatus `json:"status"`
+	Detail string      `json:"detail,omitempty"` // what was found
+	Hint   string      `json:"hint,omitempty"`   // how to fix it, if the check did not pass
+}
+
+// DoctorReport is the outcome of Diagnose.
+type DoctorReport struct {
+	Checks []DoctorCheck `json:"checks"`
+
+	Initiative     bool          `json:"initiative"`               // the sensor was sending initiative upload frames
+	Queries        int           `json:"queries"`                  // queries answered
+	ChecksumErrors int           `json:"checksum_errors"`          // answers and frames with a bad checksum
+	MeanLatency    time.Duration `json:"mean_latency"`             // mean time to the first byte of an answer
+	MaxLatency     time.Duration `json:"max_latency"`              // longest time to the first byte of an answer
+	FrameInterval  time.Duration `json:"frame_interval,omitempty"` // mean time between initiative upload frames
+}
+
+// Passed reports whether no check failed. Warnings do not fail the report.
+func (r *DoctorReport) Passed() bool {
+	for _, c := range r.Checks {
+		if c.Status == CheckFailed {
+			return false
+		}
+	}
+	return true
+}
+
+// add appends a check to the report.
+func (r *DoctorReport) add(name string, status CheckStatus, detail, hint string) {
+	if status == CheckPassed || status == CheckSkipped {
+		hint = ""
+	}
+	r.Checks = append(r.Checks, DoctorCheck{Name: name, Status: status, Detail: detail, Hint: hint})
+}
+
+// DoctorConfig holds configuration options for Diagnose.
+type DoctorConfig struct {
+	// Open opens the transport to the sensor, which is closed when the
+	// diagnosis ends. Reads must time out, as they do on the serial ports
+	// opened by cmd/zh07, or a silent sensor stalls the diagnosis.
+	Open func() (io.ReadWriteCloser, error)
+	// Model selects the frame layout and the command set, ModelZH07 if zero
+	Model Model
+	// Queries is the number of queries used for the latency and checksum
+	// statistics, 10 if zero
+	Queries int
+	// Frames is the number of initiative upload frames timed, 5 if zero
+	Frames int
+	// MaxLatency is the time to the first byte of an answer above which a
+	// warning is reported, 500ms if zero
+	MaxLatency time.Duration
+	// MaxChecksumRate is the fraction of bad checksums above which the check
+	// fails, 0.1 if zero. Any bad checksum below it is reported as a warning.
+	MaxChecksumRate float64
+	// FrameInterval is the expected time between initiative upload frames,
+	// 1s if zero. A warning is reported when frames are three times slower.
+	FrameInterval time.Duration
+
+	// Clock is used for every delay and measurement, SystemClock if nil
+	Clock Clock
+	// PostWriteDelay is how long to wait for a command to be executed, see Config
+	PostWriteDelay time.Duration
+	// ReadTimeout is how long to wait for initiative upload frames, 3s if zero
+	ReadTimeout time.Duration
+}
+
+// doctor holds the state of a diagnosis.
+type doctor struct {
+	config DoctorConfig
+	report *DoctorReport
+	z      *ZH07q
+	rx     *countingReader
+}
+
+// Diagnose runs a series of checks against a sensor and reports which ones
+// passed, with remediation hints for the others:
+//
+//   - port: the transport opens
+//   - mode: the current mode, initiative upload if frames are arriving
+//   - query: the sensor answers a query after switching to question and answer mode
+//   - latency: the time to the first byte of the answers
+//   - checksum: the rate of answers with a bad checksum over several queries
+//   - dormant: the sensor answers again after entering and leaving dormant mode
+//   - frame rate: the time between frames in initiative upload mode
+//   - restore: the sensor is switched back to the mode it was found in
+//
+// Checks depending on one that failed, or on an operation the model does not
+// support, are skipped. Once ctx is done the remaining checks are skipped too.
+func Diagnose(ctx context.Context, config *DoctorConfig) *DoctorReport {
+	if config == nil {
+		config = &DoctorConfig{}
+	}
+
+	if config.Queries <= 0 {
+		config.Queries = defaultDoctorQueries
+	}
+
+	if config.Frames <= 0 {
+		config.Frames = defaultDoctorFrames
+	}
+
+	if config.MaxLatency <= 0 {
+		config.MaxLatency = defaultDoctorMaxLatency
+	}
+
+	if config.MaxChecksumRate <= 0 {
+		config.MaxChecksumRate = defaultDoctorMaxChecksumRate
+	}
+
+	if config.FrameInterval <= 0 {
+		config.FrameInterval = defaultDoctorFrameInterval
+	}
+
+	if config.ReadTimeout <= 0 {
+		config.ReadTimeout = defaultDoctorReadTimeout
+	}
+
+	d := &doctor{config: *config, report: &DoctorReport{}}
+	d.run(ctx)
+
+	return d.report
+}
+
+// run runs the checks in order.
+func (d *doctor) run(ctx context.Context) {
+	if !d.checkPort() {
+		d.skip("port not open", "mode", "query", "latency", "checksum", "dormant", "frame rate", "restore")
+		return
+	}
+	defer d.z.Close(context.Background())
+
+	steps := []struct {
+		names []string
+		run   func()
+	}{
+		{[]string{"mode"}, d.checkMode},
+		{[]string{"query", "latency", "checksum", "dormant"}, d.checkQueries},
+		{[]string{"frame rate"}, d.checkFrameRate},
+	}
+	for i, s := range steps {
+		if ctx.Err() != nil {
+			for _, s := range steps[i:] {
+				d.skip(ctx.Err().Error(), s.names...)
+			}
+			break
+		}
+		s.run()
+	}
+
+	d.checkRestore()
+}
+
+// skip reports the named checks as skipped.
+func (d *doctor) skip(detail string, names ...string) {
+	for _, n := range names {
+		d.report.add(n, CheckSkipped, detail, "")
+	}
+}
+
+// checkPort opens the transport.
+func (d *doctor) checkPort() bool {
+	if d.config.Open == nil {
+		d.report.add("port", CheckFailed, "no transport to open", hintPort)
+		return false
+	}
+
+	port, err := d.config.Open()
+	if err != nil {
+		d.report.add("port", CheckFailed, err.Error(), hintPort)
+		return false
+	}
+
+	d.rx = &countingReader{r: port}
+	d.z = NewZH07q(&Config{
+		RW:             bufio.NewReadWriter(bufio.NewReader(d.rx), bufio.NewWriter(port)),
+		Model:          d.config.Model,
+		WarmUp:         -1,
+		Closer:         port,
+		Clock:          d.config.Clock,
+		PostWriteDelay: d.config.PostWriteDelay,
+		ReadTimeout:    d.config.ReadTimeout,
+	})
+	d.report.add("port", CheckPassed, "opened", "")
+
+	return true
+}
+
+// checkMode listens for initiative upload frames without sending anything.
+func (d *doctor) checkMode() {
+	f, err := d.z.readFrame(d.z.model())
+	switch {
+	case f != nil && frameChecksum(f) != frameReceivedChecksum(f):
+		d.report.Initiative = true
+		d.report.ChecksumErrors++
+		d.report.add("mode", CheckWarning, "initiative upload, first frame with a bad checksum", hintChecksum)
+	case f != nil:
+		d.report.Initiative = true
+		d.report.add("mode", CheckPassed, "initiative upload, frames arriving", "")
+	case d.rx.n == 0:
+		d.report.add("mode", CheckPassed, "silent, question and answer mode or dormant", "")
+	default:
+		d.report.add("mode", CheckWarning, fmt.Sprintf("%d bytes received but no frame: %v", d.rx.n, err), hintGarbage)
+	}
+}
+
+// checkQueries switches to question and answer mode and runs the query,
+// latency, checksum and dormant checks.
+func (d *doctor) checkQueries() {
+	if !d.z.Capabilities().QA {
+		d.skip("question and answer mode not supported", "query", "latency", "checksum", "dormant")
+		return
+	}
+
+	if err := d.z.SetMode(ModeQA); err != nil {
+		d.report.add("query", CheckFailed, "switching to question and answer mode: "+err.Error(), hintNoAnswer)
+		d.skip("no answer", "latency", "checksum", "dormant")
+		return
+	}
+	d.z.rw.Reader.Discard(d.z.rw.Reader.Buffered()) // frames sent before the switch
+
+	var (
+		latencies []time.Duration
+		checksums int
+		lastErr   error
+	)
+	for i := 0; i < d.config.Queries; i++ {
+		r, latency, err := d.query()
+		switch {
+		case errors.Is(err, ErrChecksumMismatch):
+			checksums++
+			latencies = append(latencies, latency)
+		case err != nil:
+			lastErr = err
+		case r != nil:
+			latencies = append(latencies, latency)
+		}
+	}
+
+	if len(latencies) == 0 {
+		d.report.add("query", CheckFailed, fmt.Sprintf("no answer to %d queries: %v", d.config.Queries, lastErr), hintNoAnswer)
+		d.skip("no answer", "latency", "checksum", "dormant")
+		return
+	}
+
+	answered := len(latencies)
+	d.report.Queries = answered
+	d.report.ChecksumErrors += checksums
+	if answered < d.config.Queries {
+		d.report.add("query", CheckWarning, fmt.Sprintf("%d of %d queries answered, last error: %v", answered, d.config.Queries, lastErr), hintNoAnswer)
+	} else {
+		d.report.add("query", CheckPassed, fmt.Sprintf("%d queries answered", answered), "")
+	}
+
+	var total time.Duration
+	for _, l := range latencies {
+		total += l
+		d.report.MaxLatency = max(d.report.MaxLatency, l)
+	}
+	d.report.MeanLatency = total / time.Duration(answered)
+	latency := fmt.Sprintf("mean %v, max %v", d.report.MeanLatency.Round(time.Millisecond), d.report.MaxLatency.Round(time.Millisecond))
+	if d.report.MaxLatency > d.config.MaxLatency {
+		d.report.add("latency", CheckWarning, latency, hintLatency)
+	} else {
+		d.report.add("latency", CheckPassed, latency, "")
+	}
+
+	rate := float64(checksums) / float64(answered)
+	checksum := fmt.Sprintf("%d of %d answers with a bad checksum", checksums, answered)
+	switch {
+	case rate > d.config.MaxChecksumRate:
+		d.report.add("checksum", CheckFailed, checksum, hintChecksum)
+	case checksums > 0:
+		d.report.add("checksum", CheckWarning, checksum, hintChecksum)
+	default:
+		d.report.add("checksum", CheckPassed, checksum, "")
+	}
+
+	d.checkDormant()
+}
+
+// checkDormant enters and leaves dormant mode, then queries the sensor.
+func (d *doctor) checkDormant() {
+	if !d.z.Capabilities().Dormant {
+		d.skip("dormant mode not supported", "dormant")
+		return
+	}
+
+	if err := d.z.Sleep(); err != nil {
+		d.report.add("dormant", CheckFailed, "entering dormant mode: "+err.Error(), hintDormant)
+		return
+	}
+	if err := d.z.Wake(); err != nil {
+		d.report.add("dormant", CheckFailed, "leaving dormant mode: "+err.Error(), hintDormant)
+		return
+	}
+	if _, _, err := d.query(); err != nil && !errors.Is(err, ErrChecksumMismatch) {
+		d.report.add("dormant", CheckFailed, "no answer after waking up: "+err.Error(), hintDormant)
+		return
+	}
+
+	d.report.add("dormant", CheckPassed, "answers after waking up", "")
+}
+
+// checkFrameRate switches to initiative upload mode and times the frames.
+func (d *doctor) checkFrameRate() {
+	if !d.z.Capabilities().Initiative {
+		d.skip("initiative upload mode not supported", "frame rate")
+		return
+	}
+
+	if err := d.z.SetMode(ModeInitiative); err != nil {
+		d.report.add("frame rate", CheckFailed, "switching to initiative upload mode: "+err.Error(), hintNoFrames)
+		return
+	}
+
+	var (
+		first, last time.Time
+		frames      int
+		checksums   int
+		lastErr     error
+	)
+	for frames < d.config.Frames {
+		f, err := d.z.readFrame(d.z.model())
+		if f == nil {
+			lastErr = err
+			break
+		}
+		if frameChecksum(f) != frameReceivedChecksum(f) {
+			checksums++
+		}
+		if last = d.z.timing.now(); frames == 0 {
+			first = last
+		}
+		frames++
+	}
+	d.report.ChecksumErrors += checksums
+
+	if frames < 2 {
+		d.report.add("frame rate", CheckFailed, fmt.Sprintf("%d frames received: %v", frames, lastErr), hintNoFrames)
+		return
+	}
+
+	d.report.FrameInterval = last.Sub(first) / time.Duration(frames-1)
+	detail := fmt.Sprintf("%d frames, one every %v", frames, d.report.FrameInterval.Round(time.Millisecond))
+	switch {
+	case frames < d.config.Frames:
+		d.report.add("frame rate", CheckWarning, fmt.Sprintf("%s, then: %v", detail, lastErr), hintFrameRate)
+	case d.report.FrameInterval > 3*d.config.FrameInterval:
+		d.report.add("frame rate", CheckWarning, detail, hintFrameRate)
+	case checksums > 0:
+		d.report.add("frame rate", CheckWarning, fmt.Sprintf("%s, %d with a bad checksum", detail, checksums), hintChecksum)
+	default:
+		d.report.add("frame rate", CheckPassed, detail, "")
+	}
+}
+
+// checkRestore switches the sensor back to the mode it was found in.
+func (d *doctor) checkRestore() {
+	m := ModeQA
+	if d.report.Initiative {
+		m = ModeInitiative
+	}
+
+	if err := d.z.SetMode(m); err != nil {
+		d.report.add("restore", CheckWarning, fmt.Sprintf("switching back to %v mode: %v", m, err), hintRestore)
+		return
+	}
+	d.report.add("restore", CheckPassed, fmt.Sprintf("back to %v mode", m), "")
+}
+
+// query sends a query and reads the answer, returning the time to its first
+// byte. Unlike ZH07q.Read it does not wait for the answer before reading it,
+// and skips anything received before it.
+func (d *doctor) query() (*Reading, time.Duration, error) {
+	p := d.z.model()
+	c, err := p.command(p.cmdQuery, "question and answer mode")
+	if err != nil {
+		return nil, 0, err
+	}
+	if err = d.z.write(d.z.rw, c); err != nil {
+		return nil, 0, err
+	}
+
+	start := d.z.timing.now()
+	if _, err = d.z.rw.Peek(1); err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrSensorCommunication, err)
+	}
+	latency := d.z.timing.now().Sub(start)
+
+	a, err := d.answer(p)
+	if err != nil {
+		return nil, latency, err
+	}
+	if checksumOf(a) != receivedChecksumOf(a) {
+		return nil, latency, fmt.Errorf("%w: received=%X, calculated=%X", ErrChecksumMismatch, receivedChecksumOf(a), checksumOf(a))
+	}
+
+	r := p.decode(a)
+	return &r, latency, nil
+}
+
+// answer reads the answer to a query, a 9-byte answer or a frame for the
+// models answering with one.
+func (d *doctor) answer(p *profile) ([]byte, error) {
+	rw := d.z.rw
+
+	for i := 0; i < maxFrameAttempts; i++ {
+		if p.qaFrame {
+			f, err := p.readFrame(rw, make([]byte, p.frameLength))
+			if f != nil || err != nil {
+				return f, err
+			}
+			continue
+		}
+
+		h, err := rw.Peek(2)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSensorCommunication, err)
+		}
+		if h[0] != 0xFF || h[1] != 0x86 {
+			rw.Discard(1)
+			continue
+		}
+
+		a := make([]byte, 9)
+		if _, err = io.ReadFull(rw, a); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSensorCommunication, err)
+		}
+		return a, nil
+	}
+
+	return nil, fmt.Errorf("%w: no answer", ErrInvalidFrame)
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += n
+	return n, err
+}
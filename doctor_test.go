@@ -0,0 +1,243 @@
+package zh07
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sensorPort emulates a ZH07 on a serial port whose reads time out with
+// io.EOF when nothing was received.
+type sensorPort struct {
+	clock      *FakeClock
+	initiative bool
+	dormant    bool
+	mute       bool          // never answer nor send frames
+	garbage    bool          // send noise instead of frames
+	latency    time.Duration // time to the first byte of an answer
+	corrupt    int           // corrupt every corrupt-th answer
+	frameEvery time.Duration // time between initiative upload frames
+
+	answers int
+	pending bool // an answer is on its way
+	rx, tx  bytes.Buffer
+	closed  bool
+}
+
+func (p *sensorPort) Write(b []byte) (int, error) {
+	p.tx.Write(b)
+
+	switch {
+	case bytes.Equal(b, commandSetInitiativeUploadMode):
+		p.initiative = true
+	case bytes.Equal(b, commandSetQAMode):
+		p.initiative = false
+	case bytes.Equal(b, commandDormantEnter):
+		p.dormant = true
+	case bytes.Equal(b, commandDormantQuit):
+		p.dormant = false
+	case bytes.Equal(b, commandQuery) && !p.initiative && !p.dormant && !p.mute:
+		a := append([]byte{}, sampleQAPayload...)
+		if p.answers++; p.corrupt > 0 && p.answers%p.corrupt == 0 {
+			a[8]++
+		}
+		p.rx.Write(a)
+		p.pending = true
+	}
+
+	return len(b), nil
+}
+
+func (p *sensorPort) Read(b []byte) (int, error) {
+	switch {
+	case p.pending:
+		p.pending = false
+		p.clock.Advance(p.latency)
+	case p.rx.Len() > 0 || p.mute:
+	case p.garbage:
+		p.clock.Advance(100 * time.Millisecond)
+		p.rx.Write([]byte{0x00, 0x13, 0x37})
+	case p.initiative && !p.dormant:
+		p.clock.Advance(p.frameEvery)
+		p.rx.Write(sampleInitiativePayload)
+	}
+
+	return p.rx.Read(b)
+}
+
+func (p *sensorPort) Close() error { p.closed = true; return nil }
+
+func TestDiagnose(t *testing.T) {
+	tests := []struct {
+		name   string
+		port   *sensorPort
+		ctx    func() context.Context
+		open   error
+		passed bool
+		want   map[string]CheckStatus
+		check  func(t *testing.T, r *DoctorReport, p *sensorPort)
+	}{
+		{
+			name:   "qa",
+			port:   &sensorPort{latency: 20 * time.Millisecond, frameEvery: time.Second},
+			passed: true,
+			want: map[string]CheckStatus{
+				"port": CheckPassed, "mode": CheckPassed, "query": CheckPassed, "latency": CheckPassed,
+				"checksum": CheckPassed, "dormant": CheckPassed, "frame rate": CheckPassed, "restore": CheckPassed,
+			},
+			check: func(t *testing.T, r *DoctorReport, p *sensorPort) {
+				assert.False(t, r.Initiative)
+				assert.Equal(t, 10, r.Queries)
+				assert.Equal(t, 20*time.Millisecond, r.MeanLatency)
+				assert.Equal(t, 20*time.Millisecond, r.MaxLatency)
+				assert.Equal(t, time.Second, r.FrameInterval)
+				assert.False(t, p.initiative, "back to question and answer mode")
+			},
+		},
+		{
+			name:   "initiative",
+			port:   &sensorPort{initiative: true, frameEvery: time.Second},
+			passed: true,
+			want: map[string]CheckStatus{
+				"mode": CheckPassed, "query": CheckPassed, "frame rate": CheckPassed, "restore": CheckPassed,
+			},
+			check: func(t *testing.T, r *DoctorReport, p *sensorPort) {
+				assert.True(t, r.Initiative)
+				assert.Equal(t, "back to initiative mode", r.Checks[len(r.Checks)-1].Detail)
+				assert.True(t, p.initiative, "back to initiative upload mode")
+			},
+		},
+		{
+			name:   "port",
+			open:   errors.New("open /dev/ttyS9: no such file or directory"),
+			passed: false,
+			want: map[string]CheckStatus{
+				"port": CheckFailed, "mode": CheckSkipped, "query": CheckSkipped, "restore": CheckSkipped,
+			},
+			check: func(t *testing.T, r *DoctorReport, p *sensorPort) {
+				assert.Contains(t, r.Checks[0].Detail, "no such file")
+				assert.Equal(t, hintPort, r.Checks[0].Hint)
+				assert.Empty(t, r.Checks[1].Hint, "no hint for skipped checks")
+			},
+		},
+		{
+			name:   "mute",
+			port:   &sensorPort{mute: true},
+			passed: false,
+			want: map[string]CheckStatus{
+				"mode": CheckPassed, "query": CheckFailed, "latency": CheckSkipped, "checksum": CheckSkipped,
+				"dormant": CheckSkipped, "frame rate": CheckFailed, "restore": CheckPassed,
+			},
+			check: func(t *testing.T, r *DoctorReport, p *sensorPort) {
+				assert.Equal(t, "silent, question and answer mode or dormant", r.Checks[1].Detail)
+				assert.Equal(t, hintNoAnswer, r.Checks[2].Hint)
+			},
+		},
+		{
+			name:   "checksum-warning",
+			port:   &sensorPort{corrupt: 10, frameEvery: time.Second},
+			passed: true,
+			want:   map[string]CheckStatus{"query": CheckPassed, "checksum": CheckWarning},
+			check: func(t *testing.T, r *DoctorReport, p *sensorPort) {
+				assert.Equal(t, 1, r.ChecksumErrors)
+			},
+		},
+		{
+			name:   "checksum-failure",
+			port:   &sensorPort{corrupt: 2, frameEvery: time.Second},
+			passed: false,
+			want:   map[string]CheckStatus{"query": CheckPassed, "checksum": CheckFailed, "dormant": CheckPassed},
+			check: func(t *testing.T, r *DoctorReport, p *sensorPort) {
+				assert.Equal(t, 5, r.ChecksumErrors)
+				assert.Equal(t, hintChecksum, r.Checks[4].Hint)
+			},
+		},
+		{
+			name:   "latency",
+			port:   &sensorPort{latency: 800 * time.Millisecond, frameEvery: time.Second},
+			passed: true,
+			want:   map[string]CheckStatus{"latency": CheckWarning},
+		},
+		{
+			name:   "garbage",
+			port:   &sensorPort{garbage: true},
+			passed: false,
+			want:   map[string]CheckStatus{"mode": CheckWarning, "frame rate": CheckFailed},
+			check: func(t *testing.T, r *DoctorReport, p *sensorPort) {
+				assert.Equal(t, hintGarbage, r.Checks[1].Hint)
+			},
+		},
+		{
+			name:   "slow-frames",
+			port:   &sensorPort{frameEvery: 5 * time.Second},
+			passed: true,
+			want:   map[string]CheckStatus{"frame rate": CheckWarning},
+		},
+		{
+			name: "cancelled",
+			port: &sensorPort{frameEvery: time.Second},
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx
+			},
+			passed: true,
+			want: map[string]CheckStatus{
+				"port": CheckPassed, "mode": CheckSkipped, "query": CheckSkipped, "frame rate": CheckSkipped, "restore": CheckPassed,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				clock = NewFakeClock(epoch)
+				ctx   = context.Background()
+			)
+			if tt.port != nil {
+				tt.port.clock = clock
+			}
+			if tt.ctx != nil {
+				ctx = tt.ctx()
+			}
+
+			r := Diagnose(ctx, &DoctorConfig{
+				Open: func() (io.ReadWriteCloser, error) {
+					if tt.open != nil {
+						return nil, tt.open
+					}
+					return tt.port, nil
+				},
+				Clock: clock,
+			})
+
+			got := make(map[string]CheckStatus, len(r.Checks))
+			for _, c := range r.Checks {
+				got[c.Name] = c.Status
+			}
+			assert.Len(t, r.Checks, 8, "every check is reported")
+			for name, want := range tt.want {
+				assert.Equal(t, want, got[name], name)
+			}
+			assert.Equal(t, tt.passed, r.Passed())
+			if tt.port != nil {
+				assert.True(t, tt.port.closed, "the port is closed")
+			}
+			if tt.check != nil {
+				tt.check(t, r, tt.port)
+			}
+		})
+	}
+}
+
+func TestCheckStatus_String(t *testing.T) {
+	assert.Equal(t, "pass", CheckPassed.String())
+	assert.Equal(t, "warn", CheckWarning.String())
+	assert.Equal(t, "fail", CheckFailed.String())
+	assert.Equal(t, "skip", CheckSkipped.String())
+	assert.Equal(t, "CheckStatus(7)", CheckStatus(7).String())
+}
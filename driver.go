@@ -0,0 +1,318 @@
+package zh07
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+)
+
+// driver talks to a sensor over a serial port. It is embedded by ZH07i and
+// ZH07q, which only differ by the communication mode they start in, and its
+// exported methods are part of their API.
+// It is safe for concurrent use, the exchanges with the sensor are serialised.
+type driver struct {
+	warmup
+	lifecycle
+	port         sync.Mutex // serialises the exchanges with the sensor
+	timing       timing
+	metrics      instruments
+	frames       frameMonitor
+	profile      *profile
+	mode         Mode   // current communication mode, see SetMode
+	data         []byte // last payload
+	buf          []byte // receive buffer, reused by every read
+	rw           *bufio.ReadWriter
+	write        func(rw *bufio.ReadWriter, c []byte) error
+	writeAndRead func(rw *bufio.ReadWriter, c []byte) ([]byte, error)
+}
+
+// configure sets the driver up from config, to start in mode m.
+// config.Model selects the frame layout and the command set.
+func (z *driver) configure(config *Config, m Mode) {
+	if config == nil {
+		config = &Config{}
+	}
+
+	if config.RW == nil {
+		config.RW = bufio.NewReadWriter(bufio.NewReader(bytes.NewReader([]byte{})), nil)
+	}
+
+	p := profileFor(config.Model)
+	z.profile = p
+	z.mode = m
+	z.data = make([]byte, p.frameLength)
+	z.buf = make([]byte, p.frameLength)
+	z.rw = config.RW
+	z.timing = newTiming(config)
+	z.frames = frameMonitor{notify: config.FrameEvents, airtime: p.airtime()}
+	z.write = write
+	z.writeAndRead = func(rw *bufio.ReadWriter, c []byte) ([]byte, error) {
+		return writeAndRead(rw, c, z.buf[:9], z.timing.afterWrite)
+	}
+	z.metrics = instruments{metrics: config.Metrics, clock: z.timing.clk()}
+	z.clk = z.timing.clock
+	z.setup(config.WarmUp)
+	z.manage(config.Closer, config.SleepOnClose)
+}
+
+// Init initializes the sensor for the mode it was created for, or for the
+// mode selected with SetMode.
+func (z *driver) Init() error {
+	return z.SetMode(z.Mode())
+}
+
+// Mode returns the current communication mode.
+func (z *driver) Mode() Mode {
+	z.port.Lock()
+	defer z.port.Unlock()
+
+	return z.mode
+}
+
+// SetMode switches the sensor to initiative upload or question and answer mode.
+func (z *driver) SetMode(m Mode) error {
+	z.port.Lock()
+	defer z.port.Unlock()
+
+	if err := z.check(); err != nil {
+		return err
+	}
+	c, err := z.model().modeCommand(m)
+	if err != nil {
+		return err
+	}
+	if err = z.send(CommandMode, c); err != nil {
+		return err
+	}
+	z.mode = m
+	z.restart() // changing the mode restarts the stabilisation period
+	z.frames.restart()
+
+	return nil
+}
+
+// Sleep puts the sensor into dormant mode, turning off the laser and the fan.
+func (z *driver) Sleep() error {
+	z.port.Lock()
+	defer z.port.Unlock()
+
+	if err := z.check(); err != nil {
+		return err
+	}
+	c, err := z.model().command(z.model().cmdSleep, "dormant mode")
+	if err != nil {
+		return err
+	}
+
+	return z.send(CommandSleep, c)
+}
+
+// Wake brings the sensor out of dormant mode and starts a new stabilisation period.
+func (z *driver) Wake() error {
+	z.port.Lock()
+	defer z.port.Unlock()
+
+	if err := z.check(); err != nil {
+		return err
+	}
+	c, err := z.model().command(z.model().cmdWake, "dormant mode")
+	if err != nil {
+		return err
+	}
+	if err = z.send(CommandWake, c); err != nil {
+		return err
+	}
+	z.restart()
+	z.frames.restart()
+
+	return nil
+}
+
+// Command sends c as is and returns the n bytes answered, if any.
+func (z *driver) Command(c []byte, n int) ([]byte, error) {
+	z.port.Lock()
+	defer z.port.Unlock()
+
+	if err := z.check(); err != nil {
+		return nil, err
+	}
+	start := z.metrics.start()
+	a, err := command(z.rw, z.write, c, n, z.timing.afterWrite)
+	z.metrics.command(CommandRaw, start, err)
+
+	return a, err
+}
+
+// Info describes the sensor.
+func (z *driver) Info() Info {
+	return Info{Model: z.model().model, Mode: z.Mode(), Capabilities: z.Capabilities()}
+}
+
+// Capabilities reports what the configured model supports.
+func (z *driver) Capabilities() Capabilities {
+	return z.model().model.Capabilities()
+}
+
+// FrameStats returns the statistics of the frames received in initiative
+// upload mode: their rate, and how many were lost, backlogged or had to be
+// searched for.
+func (z *driver) FrameStats() FrameStats {
+	return z.frames.snapshot()
+}
+
+// Stream sends readings as the sensor broadcasts them in initiative upload
+// mode, or queries the sensor every Config.FrameInterval in question and
+// answer mode, see Streamer.
+func (z *driver) Stream(ctx context.Context) <-chan Result {
+	return z.lifecycle.stream(ctx, z.timing.pace(z.Read, func() bool { return z.Mode() == ModeQA }))
+}
+
+// Close stops the streams, puts the sensor into dormant mode if
+// Config.SleepOnClose is set, flushes pending writes and closes Config.Closer.
+// Any later call returns ErrClosed.
+func (z *driver) Close(ctx context.Context) error {
+	return z.shutdown(ctx, z.release)
+}
+
+// release sends the dormant command if requested and flushes pending writes,
+// once any exchange in progress is over, unless ctx is done by then.
+func (z *driver) release(ctx context.Context) error {
+	z.port.Lock()
+	defer z.port.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if p := z.model(); z.sleepOnClose && p.cmdSleep != nil {
+		if err := z.write(z.rw, p.cmdSleep); err != nil {
+			return err
+		}
+		z.timing.afterWrite() // wait command to be executed
+	}
+	return flush(z.rw)
+}
+
+// CalculateChecksum calculates the checksum from the payload, either an
+// initiative upload frame or a 9-byte answer.
+// The checksum of a frame is calculated by adding all the bytes of the data
+// received but the last 2, which are the checksum.
+func (z *driver) CalculateChecksum() int {
+	z.port.Lock()
+	defer z.port.Unlock()
+
+	return checksumOf(z.data)
+}
+
+// IsReadingValid checks if the calculated checksum matches the payload checksum.
+func (z *driver) IsReadingValid() bool {
+	z.port.Lock()
+	defer z.port.Unlock()
+
+	return checksumOf(z.data) == z.getChecksum()
+}
+
+// Read reads particulate matter data from the sensor. In initiative upload
+// mode it reads the next frame, returning nil and no error when the bytes read
+// do not start a frame. In question and answer mode it sends a query command
+// and reads the answer. Either way, a payload with a bad checksum fails with
+// ErrChecksumMismatch.
+func (z *driver) Read() (*Reading, error) {
+	var r Reading
+	if ok, err := z.ReadInto(&r); !ok {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ReadInto is Read storing the reading into r instead of allocating one, so
+// that polling many sensors does not churn the garbage collector. It returns
+// false, and no error, when the bytes read do not start a frame.
+func (z *driver) ReadInto(r *Reading) (bool, error) {
+	z.port.Lock()
+	defer z.port.Unlock()
+
+	if err := z.check(); err != nil {
+		return false, err
+	}
+	p := z.model()
+
+	var (
+		d   []byte
+		err error
+	)
+	if z.mode == ModeQA {
+		start := z.metrics.start()
+		d, err = p.query(z.rw, z.buf, z.write, z.writeAndRead, z.timing.afterWrite)
+		z.metrics.command(CommandQuery, start, err)
+		if err != nil {
+			return false, err
+		}
+	} else if d, err = z.readFrame(p); d == nil {
+		return false, err
+	}
+	z.data = append(z.data[:0], d...) // keep the payload, buf is reused by the next read
+
+	valid := checksumOf(z.data) == z.getChecksum()
+	z.metrics.frame(z.mode, valid)
+	if z.mode != ModeQA {
+		z.frames.frame(z.timing.now(), valid)
+	}
+	if !valid {
+		return false, fmt.Errorf("%w: received=%X, calculated=%X", ErrChecksumMismatch, z.getChecksum(), checksumOf(z.data))
+	}
+
+	*r = p.decode(z.data)
+	z.flag(r)
+
+	return true, nil
+}
+
+// send writes command c, reported to the metrics as name, and waits for it to
+// be executed. The caller must hold z.port.
+func (z *driver) send(name string, c []byte) error {
+	start := z.metrics.start()
+	if err := z.write(z.rw, c); err != nil {
+		z.metrics.command(name, start, err)
+		return err
+	}
+	z.timing.afterWrite() // wait command to be executed
+	z.metrics.command(name, start, nil)
+
+	return nil
+}
+
+// getChecksum recovers the checksum received in the payload.
+func (z *driver) getChecksum() int {
+	return receivedChecksumOf(z.data)
+}
+
+// model returns the profile of the sensor, the ZH07's if none was configured.
+func (z *driver) model() *profile {
+	if z.profile == nil {
+		return profileFor(ModelZH07)
+	}
+	return z.profile
+}
+
+// readFrame reads an initiative upload frame. Without a read timeout it
+// returns nil and no error when the bytes read do not start a frame, otherwise
+// it keeps trying until the timeout expires.
+func (z *driver) readFrame(p *profile) ([]byte, error) {
+	deadline := z.timing.now().Add(z.timing.readTimeout)
+	for {
+		d, skipped, err := p.scanFrame(z.rw, z.buf)
+		if skipped > 0 {
+			z.frames.skip(skipped)
+			z.metrics.skip(skipped)
+		}
+		if d != nil || err != nil || z.timing.readTimeout <= 0 {
+			return d, err
+		}
+		if !z.timing.now().Before(deadline) {
+			return nil, fmt.Errorf("%w: no frame within %v", ErrTimeout, z.timing.readTimeout)
+		}
+	}
+}
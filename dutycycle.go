@@ -0,0 +1,191 @@
+package zh07
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	defaultDutyCyclePeriod         = 5 * time.Minute
+	defaultDutyCycleSamples        = 10
+	defaultDutyCycleSampleInterval = time.Second
+)
+
+var (
+	_ DutyCycleSensor = (*ZH07i)(nil)
+	_ DutyCycleSensor = (*ZH07q)(nil)
+)
+
+// DutyCycleSensor is a sensor that can be put into dormant mode and woken up.
+// Both ZH07i and ZH07q implement it.
+type DutyCycleSensor interface {
+	SensorInterface
+	// Sleep puts the sensor into dormant mode
+	Sleep() error
+	// Wake brings the sensor out of dormant mode
+	Wake() error
+	// WaitReady blocks until the sensor has stabilised after waking up
+	WaitReady(ctx context.Context) error
+}
+
+// CycleResult is the outcome of a single duty cycle.
+type CycleResult struct {
+	Start   time.Time
+	End     time.Time
+	Reading *Reading // median of the samples, nil when none was collected
+	PM1     Stats
+	PM25    Stats
+	PM10    Stats
+	Errors  int   // number of failed reads
+	Err     error // why the cycle produced no reading, or failed to put the sensor back to sleep
+}
+
+// DutyCycleConfig holds configuration options for a DutyCycle.
+type DutyCycleConfig struct {
+	// Period is the time between the start of consecutive cycles, 5m if zero
+	Period time.Duration
+	// Samples is the number of valid readings taken every cycle, 10 if zero
+	Samples int
+	// SampleInterval is the pause between reads, 1s if zero. A negative value
+	// removes the pause, which suits ZH07i where Read blocks until the next
+	// frame arrives.
+	SampleInterval time.Duration
+	// MaxAttempts bounds the number of reads per cycle, including failed and
+	// skipped ones, three times Samples if zero
+	MaxAttempts int
+	// Percentiles lists the percentiles reported for every channel
+	Percentiles []float64
+	// OnCycle is called with the result of every cycle
+	OnCycle func(CycleResult)
+	// Clock times the cycles and the pauses between reads, SystemClock if nil
+	Clock Clock
+}
+
+// DutyCycle runs the sensor only while taking samples, to extend the life of
+// its laser and fan. Every cycle it wakes the sensor up, waits for it to
+// stabilise, collects a number of samples, puts it back into dormant mode and
+// reports their aggregate.
+//
+// The sensor must have been initialized, which selects how samples are taken.
+type DutyCycle struct {
+	sensor DutyCycleSensor
+	config DutyCycleConfig
+}
+
+// NewDutyCycle creates a new DutyCycle controller for sensor.
+func NewDutyCycle(sensor DutyCycleSensor, config *DutyCycleConfig) *DutyCycle {
+	if config == nil {
+		config = &DutyCycleConfig{}
+	}
+
+	if config.Period <= 0 {
+		config.Period = defaultDutyCyclePeriod
+	}
+
+	if config.Samples <= 0 {
+		config.Samples = defaultDutyCycleSamples
+	}
+
+	switch {
+	case config.SampleInterval == 0:
+		config.SampleInterval = defaultDutyCycleSampleInterval
+	case config.SampleInterval < 0:
+		config.SampleInterval = 0
+	}
+
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = config.Samples * 3
+	}
+
+	if config.Clock == nil {
+		config.Clock = SystemClock
+	}
+
+	return &DutyCycle{
+		sensor: sensor,
+		config: *config,
+	}
+}
+
+// Run executes a cycle every Period until ctx is done, and then returns the
+// context's error. Errors within a cycle are reported through OnCycle and
+// never stop the loop.
+func (d *DutyCycle) Run(ctx context.Context) error {
+	for {
+		start := d.config.Clock.Now()
+
+		r := d.Cycle(ctx)
+		if d.config.OnCycle != nil {
+			d.config.OnCycle(r)
+		}
+
+		if err := sleepContext(ctx, d.config.Clock, start.Add(d.config.Period).Sub(d.config.Clock.Now())); err != nil {
+			return err
+		}
+	}
+}
+
+// Cycle wakes the sensor up, collects samples, and puts it back to sleep.
+// The sensor is put back to sleep even when the cycle fails or ctx is done.
+func (d *DutyCycle) Cycle(ctx context.Context) CycleResult {
+	var (
+		result   = CycleResult{Start: d.config.Clock.Now()}
+		values   [3][]float64
+		readErrs []error
+		errs     []error
+	)
+
+	err := d.sensor.Wake()
+	if err == nil {
+		err = d.sensor.WaitReady(ctx)
+	}
+
+	for attempt := 0; err == nil && attempt < d.config.MaxAttempts && len(values[0]) < d.config.Samples; attempt++ {
+		if attempt > 0 {
+			if err = sleepContext(ctx, d.config.Clock, d.config.SampleInterval); err != nil {
+				break
+			}
+		}
+
+		r, e := d.sensor.Read()
+		switch {
+		case e != nil:
+			result.Errors++
+			readErrs = append(readErrs, e)
+		case r != nil:
+			values[0] = append(values[0], float64(r.PM1))
+			values[1] = append(values[1], float64(r.PM25))
+			values[2] = append(values[2], float64(r.PM10))
+		}
+	}
+
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if e := d.sensor.Sleep(); e != nil {
+		errs = append(errs, fmt.Errorf("entering dormant mode: %w", e))
+	}
+
+	result.PM1 = computeStats(values[0], d.config.Percentiles)
+	result.PM25 = computeStats(values[1], d.config.Percentiles)
+	result.PM10 = computeStats(values[2], d.config.Percentiles)
+
+	if result.PM25.Count > 0 {
+		result.Reading = &Reading{
+			PM1:  int(math.Round(result.PM1.Median)),
+			PM25: int(math.Round(result.PM25.Median)),
+			PM10: int(math.Round(result.PM10.Median)),
+		}
+		// read errors are not a failure as long as samples were collected
+		result.Err = errors.Join(errs...)
+	} else {
+		result.Err = errors.Join(append(append([]error{ErrNoSamples}, errs...), readErrs...)...)
+	}
+	result.End = d.config.Clock.Now()
+
+	return result
+}
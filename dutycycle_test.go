@@ -0,0 +1,140 @@
+package zh07
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// dormantSensor is a scripted DutyCycleSensor that records power transitions.
+type dormantSensor struct {
+	scriptedSensor
+	mu      sync.Mutex
+	events  []string
+	wakeErr error
+}
+
+func (s *dormantSensor) log(e string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+}
+
+func (s *dormantSensor) Read() (*Reading, error) { s.log("read"); return s.next() }
+func (s *dormantSensor) Sleep() error            { s.log("sleep"); return nil }
+func (s *dormantSensor) Wake() error             { s.log("wake"); return s.wakeErr }
+func (s *dormantSensor) WaitReady(ctx context.Context) error {
+	s.log("ready")
+	return ctx.Err()
+}
+
+func TestDutyCycle_Cycle(t *testing.T) {
+	commErr := fmt.Errorf("%w: test", ErrSensorCommunication)
+
+	tests := []struct {
+		name    string
+		sensor  *dormantSensor
+		config  *DutyCycleConfig
+		want    *Reading
+		errors  int
+		errIs   []error
+		events  []string
+		timeout bool
+	}{
+		{
+			name: "success",
+			sensor: &dormantSensor{scriptedSensor: scriptedSensor{
+				readings: []*Reading{same(10), nil, same(30), same(20)},
+				errs:     []error{nil, nil, commErr},
+			}},
+			config: &DutyCycleConfig{Samples: 2, SampleInterval: -1},
+			want:   same(15),
+			errors: 1,
+			events: []string{"wake", "ready", "read", "read", "read", "read", "sleep"},
+		},
+		{
+			name: "too-many-attempts",
+			sensor: &dormantSensor{scriptedSensor: scriptedSensor{
+				errs: []error{commErr, commErr},
+			}},
+			config: &DutyCycleConfig{Samples: 1, MaxAttempts: 2, SampleInterval: time.Millisecond},
+			errors: 2,
+			errIs:  []error{ErrNoSamples, ErrSensorCommunication},
+			events: []string{"wake", "ready", "read", "read", "sleep"},
+		},
+		{
+			name:   "wake-fails",
+			sensor: &dormantSensor{wakeErr: commErr},
+			errIs:  []error{ErrNoSamples, ErrSensorCommunication},
+			events: []string{"wake", "sleep"},
+		},
+		{
+			name:    "cancelled",
+			sensor:  &dormantSensor{},
+			timeout: true,
+			errIs:   []error{ErrNoSamples, context.Canceled},
+			events:  []string{"wake", "ready", "sleep"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				d           = NewDutyCycle(tt.sensor, tt.config)
+				ctx, cancel = context.WithCancel(context.Background())
+			)
+			defer cancel()
+
+			if tt.timeout {
+				cancel()
+			}
+
+			r := d.Cycle(ctx)
+			assert.Equal(t, tt.want, r.Reading)
+			assert.Equal(t, tt.errors, r.Errors)
+			assert.Equal(t, tt.events, tt.sensor.events)
+			if tt.errIs == nil {
+				assert.NoError(t, r.Err)
+			}
+			for _, e := range tt.errIs {
+				assert.ErrorIs(t, r.Err, e)
+			}
+			assert.False(t, r.End.Before(r.Start))
+		})
+	}
+}
+
+func TestDutyCycle_Run(t *testing.T) {
+	var (
+		s = &dormantSensor{scriptedSensor: scriptedSensor{
+			readings: []*Reading{same(1), same(2), same(3), same(4)},
+		}}
+		results     []CycleResult
+		clock       = NewFakeClock(epoch)
+		ctx, cancel = context.WithCancel(context.Background())
+		d           = NewDutyCycle(s, &DutyCycleConfig{
+			Period:         time.Minute,
+			Samples:        1,
+			SampleInterval: -1,
+			OnCycle: func(r CycleResult) {
+				results = append(results, r)
+				if len(results) == 3 {
+					cancel()
+				}
+			},
+			Clock: clock,
+		})
+	)
+	defer cancel()
+
+	assert.ErrorIs(t, advancing(clock, time.Minute, func() error { return d.Run(ctx) }), context.Canceled)
+	if assert.Len(t, results, 3) {
+		assert.Equal(t, same(3), results[2].Reading)
+		for i, r := range results {
+			assert.Equal(t, epoch.Add(time.Duration(i)*time.Minute), r.Start, "a cycle every period")
+		}
+	}
+}
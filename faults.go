@@ -0,0 +1,215 @@
+package zh07
+
+import (
+	"io"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFaultLatency       = 100 * time.Millisecond
+	defaultFaultStallDuration = time.Second
+)
+
+// FaultConfig holds configuration options for a FaultInjector. Probabilities
+// range from 0, never, to 1, always.
+type FaultConfig struct {
+	// Seed seeds the random number generator: the same seed injects the same
+	// faults into the same traffic
+	Seed uint64
+	// BitFlip is the probability of a byte read having one of its bits flipped
+	BitFlip float64
+	// Drop is the probability of a byte read being lost
+	Drop float64
+	// Duplicate is the probability of a byte read being received twice
+	Duplicate float64
+	// Fragment is the probability of a read returning only part of the bytes
+	// available, as when a frame is split across reads
+	Fragment float64
+	// Delay is the probability of a read being delayed by up to Latency
+	Delay float64
+	// Latency is the longest delay added to a read, 100ms if zero
+	Latency time.Duration
+	// Stall is the probability of a read returning no bytes and io.EOF after
+	// StallDuration, as a serial port whose read times out on a silent line
+	Stall float64
+	// StallDuration is how long a stalled read lasts, 1s if zero
+	StallDuration time.Duration
+	// Writes applies the bit flips, drops and duplicates to the bytes written
+	// as well
+	Writes bool
+	// Clock is used for delays and stalls, SystemClock if nil
+	Clock Clock
+}
+
+// FaultStats counts the faults injected by a FaultInjector.
+type FaultStats struct {
+	BitFlips   int // bytes with a bit flipped
+	Drops      int // bytes lost
+	Duplicates int // bytes received twice
+	Fragments  int // reads returning part of the bytes available
+	Delays     int // reads delayed
+	Stalls     int // reads stalled
+}
+
+// FaultInjector wraps the transport to a sensor and injects line noise into
+// it: bit flips, dropped and duplicated bytes, fragmented, delayed and stalled
+// reads, each at the probability set in FaultConfig. It is meant to check
+// that frame resynchronisation, checksum validation and recovery behave
+// under adverse conditions, against an emulated sensor or a replay.
+type FaultInjector struct {
+	rw     io.ReadWriter
+	config FaultConfig
+
+	pending []byte // bytes read and mangled, not returned yet
+	err     error  // error of the read pending came from, returned once they are
+
+	mu    sync.Mutex
+	rng   *rand.Rand
+	stats FaultStats
+}
+
+// NewFaultInjector creates a new FaultInjector around rw.
+func NewFaultInjector(rw io.ReadWriter, config *FaultConfig) *FaultInjector {
+	if config == nil {
+		config = &FaultConfig{}
+	}
+
+	if config.Latency <= 0 {
+		config.Latency = defaultFaultLatency
+	}
+
+	if config.StallDuration <= 0 {
+		config.StallDuration = defaultFaultStallDuration
+	}
+
+	if config.Clock == nil {
+		config.Clock = SystemClock
+	}
+
+	return &FaultInjector{
+		rw:     rw,
+		config: *config,
+		rng:    rand.New(rand.NewPCG(config.Seed, config.Seed)),
+	}
+}
+
+// Read reads from the transport and injects faults into the bytes read. It
+// must not be called concurrently.
+func (f *FaultInjector) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	if f.chance(f.config.Stall, &f.stats.Stalls) {
+		f.config.Clock.Sleep(f.config.StallDuration)
+		return 0, io.EOF
+	}
+	if f.chance(f.config.Delay, &f.stats.Delays) {
+		f.config.Clock.Sleep(f.duration(f.config.Latency))
+	}
+
+	// read until some bytes survive the drops, or the transport fails
+	for len(f.pending) == 0 && f.err == nil {
+		buf := make([]byte, len(b))
+		n, err := f.rw.Read(buf)
+		f.pending, f.err = f.mangle(buf[:n]), err
+	}
+
+	if len(f.pending) == 0 {
+		err := f.err
+		f.err = nil
+		return 0, err
+	}
+
+	n := min(len(b), len(f.pending))
+	if n > 1 && f.chance(f.config.Fragment, &f.stats.Fragments) {
+		n = 1 + f.intN(n-1)
+	}
+	copy(b, f.pending[:n])
+	f.pending = f.pending[n:]
+
+	return n, nil
+}
+
+// Write writes to the transport, injecting faults into the bytes written if
+// FaultConfig.Writes is set. It reports every byte of b as written when the
+// transport accepts what is left of them.
+func (f *FaultInjector) Write(b []byte) (int, error) {
+	if !f.config.Writes {
+		return f.rw.Write(b)
+	}
+
+	if _, err := f.rw.Write(f.mangle(b)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close closes the transport if it is an io.Closer.
+func (f *FaultInjector) Close() error {
+	if c, ok := f.rw.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Stats returns the number of faults injected so far.
+func (f *FaultInjector) Stats() FaultStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.stats
+}
+
+// mangle returns a copy of b with bits flipped and bytes dropped or
+// duplicated.
+func (f *FaultInjector) mangle(b []byte) []byte {
+	r := make([]byte, 0, len(b))
+	for _, c := range b {
+		if f.chance(f.config.Drop, &f.stats.Drops) {
+			continue
+		}
+		if f.chance(f.config.BitFlip, &f.stats.BitFlips) {
+			c ^= 1 << f.intN(8)
+		}
+		r = append(r, c)
+		if f.chance(f.config.Duplicate, &f.stats.Duplicates) {
+			r = append(r, c)
+		}
+	}
+	return r
+}
+
+// chance draws whether a fault of probability p happens, counting it in n.
+func (f *FaultInjector) chance(p float64, n *int) bool {
+	if p <= 0 {
+		return false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.rng.Float64() >= p {
+		return false
+	}
+	*n++
+	return true
+}
+
+// intN returns a random number in [0, n).
+func (f *FaultInjector) intN(n int) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.rng.IntN(n)
+}
+
+// duration returns a random duration in [0, d].
+func (f *FaultInjector) duration(d time.Duration) time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return time.Duration(f.rng.Int64N(int64(d) + 1))
+}
@@ -0,0 +1,242 @@
+package zh07
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// frameSource sends n initiative upload frames, then fails with io.EOF.
+type frameSource struct {
+	n   int
+	buf bytes.Buffer
+}
+
+func (s *frameSource) Read(b []byte) (int, error) {
+	if s.buf.Len() == 0 && s.n > 0 {
+		s.n--
+		s.buf.Write(sampleInitiativePayload)
+	}
+	return s.buf.Read(b)
+}
+
+func (s *frameSource) Write(b []byte) (int, error) { return len(b), nil }
+
+func TestFaultInjector(t *testing.T) {
+	data := []byte{0x42, 0x4D, 0x00, 0x1C}
+
+	tests := []struct {
+		name   string
+		config FaultConfig
+		read   int // bytes read at once
+		want   []byte
+		check  func(t *testing.T, got []byte, slept time.Duration)
+		stats  FaultStats
+	}{
+		{
+			name: "none",
+			read: 16,
+			want: data,
+		},
+		{
+			name:   "bit flips",
+			config: FaultConfig{BitFlip: 1},
+			read:   16,
+			check: func(t *testing.T, got []byte, _ time.Duration) {
+				assert.Len(t, got, len(data))
+				for i := range got {
+					d := got[i] ^ data[i]
+					assert.True(t, d != 0 && d&(d-1) == 0, "one bit flipped in %X", got[i])
+				}
+			},
+			stats: FaultStats{BitFlips: 4},
+		},
+		{
+			name:   "drops",
+			config: FaultConfig{Drop: 1},
+			read:   16,
+			want:   []byte{},
+			stats:  FaultStats{Drops: 4},
+		},
+		{
+			name:   "duplicates",
+			config: FaultConfig{Duplicate: 1},
+			read:   16,
+			want:   []byte{0x42, 0x42, 0x4D, 0x4D, 0x00, 0x00, 0x1C, 0x1C},
+			stats:  FaultStats{Duplicates: 4},
+		},
+		{
+			name:   "fragments",
+			config: FaultConfig{Fragment: 1},
+			read:   16,
+			want:   data,
+			stats:  FaultStats{Fragments: 1}, // then a single byte is left
+		},
+		{
+			name:   "delays",
+			config: FaultConfig{Delay: 1, Latency: 50 * time.Millisecond},
+			read:   4,
+			want:   data,
+			check: func(t *testing.T, _ []byte, slept time.Duration) {
+				assert.LessOrEqual(t, slept, 2*50*time.Millisecond)
+			},
+			stats: FaultStats{Delays: 2}, // the read returning the bytes, then io.EOF
+		},
+		{
+			name:   "stalls",
+			config: FaultConfig{Stall: 1},
+			read:   16,
+			want:   []byte{},
+			check: func(t *testing.T, _ []byte, slept time.Duration) {
+				assert.Equal(t, time.Second, slept)
+			},
+			stats: FaultStats{Stalls: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := NewFakeClock(epoch)
+			tt.config.Clock = clock
+			f := NewFaultInjector(&frameSource{buf: *bytes.NewBuffer(append([]byte{}, data...))}, &tt.config)
+
+			got := []byte{}
+			b := make([]byte, tt.read)
+			for {
+				n, err := f.Read(b)
+				got = append(got, b[:n]...)
+				if err != nil {
+					assert.Equal(t, io.EOF, err)
+					break
+				}
+				assert.NotZero(t, n, "no empty reads")
+			}
+
+			if tt.want != nil {
+				assert.Equal(t, tt.want, got)
+			}
+			if tt.check != nil {
+				tt.check(t, got, clock.Slept())
+			}
+			assert.Equal(t, tt.stats, f.Stats())
+		})
+	}
+}
+
+func TestFaultInjector_Writes(t *testing.T) {
+	var port bytes.Buffer
+
+	f := NewFaultInjector(&port, &FaultConfig{Duplicate: 1})
+	n, err := f.Write(commandQuery)
+	assert.NoError(t, err)
+	assert.Equal(t, 9, n)
+	assert.Equal(t, commandQuery, port.Bytes(), "writes are left alone by default")
+
+	port.Reset()
+	f = NewFaultInjector(&port, &FaultConfig{Drop: 1, Writes: true})
+	n, err = f.Write(commandQuery)
+	assert.NoError(t, err)
+	assert.Equal(t, 9, n, "dropped bytes count as written")
+	assert.Empty(t, port.Bytes())
+	assert.Equal(t, FaultStats{Drops: 9}, f.Stats())
+}
+
+func TestFaultInjector_Seed(t *testing.T) {
+	noise := func(seed uint64) []byte {
+		f := NewFaultInjector(&frameSource{n: 10}, &FaultConfig{Seed: seed, BitFlip: 0.1, Drop: 0.1, Duplicate: 0.1})
+		b, err := io.ReadAll(f)
+		assert.NoError(t, err)
+		return b
+	}
+
+	assert.Equal(t, noise(1), noise(1), "the same seed injects the same faults")
+	assert.NotEqual(t, noise(1), noise(2))
+}
+
+// noisyLine injects a bit of everything, each seed making a different run.
+func noisyLine(seed uint64, clock Clock) *FaultConfig {
+	return &FaultConfig{
+		Seed:      seed,
+		BitFlip:   0.002,
+		Drop:      0.002,
+		Duplicate: 0.002,
+		Fragment:  0.3,
+		Delay:     0.1,
+		Stall:     0.01,
+		Clock:     clock,
+	}
+}
+
+func TestFaultInjector_ZH07i(t *testing.T) {
+	// a byte duplicated and another dropped in the same frame can shift its
+	// fields without changing the sum of its bytes: no checksum catches that,
+	// every other corruption must fail the read
+	var valid, corrupted, undetected int
+	for seed := uint64(1); seed <= 20; seed++ {
+		var (
+			clock = NewFakeClock(epoch)
+			src   = &frameSource{n: 100}
+			f     = NewFaultInjector(src, noisyLine(seed, clock))
+			z     = NewZH07i(&Config{RW: bufio.NewReadWriter(bufio.NewReader(f), bufio.NewWriter(f)), WarmUp: -1, Clock: clock})
+			n     int
+		)
+
+		for src.n > 0 || src.buf.Len() > 0 {
+			r, err := z.Read()
+			switch {
+			case errors.Is(err, ErrChecksumMismatch):
+				corrupted++
+				assert.Nil(t, r)
+				assert.NotEqual(t, sampleInitiativePayload, z.data, "seed %d: only corrupted frames fail", seed)
+			case err != nil:
+				assert.ErrorIs(t, err, ErrSensorCommunication, "seed %d: stalled", seed)
+			case r == nil:
+				// resynchronising
+			case bytes.Equal(z.data, sampleInitiativePayload):
+				n++
+				assert.Equal(t, &Reading{PM1: 0x54, PM25: 0x6E, PM10: 0x7C}, r, "seed %d", seed)
+			default:
+				undetected++
+				assert.Equal(t, receivedChecksumOf(z.data), checksumOf(z.data), "seed %d: a frame failing the checksum was read", seed)
+			}
+		}
+
+		assert.Greater(t, n, 60, "seed %d: most frames get through, stats %+v", seed, f.Stats())
+		valid += n
+	}
+
+	assert.Greater(t, corrupted, 20*undetected, "out of %d frames read", valid)
+}
+
+func TestFaultInjector_ZH07q(t *testing.T) {
+	for seed := uint64(1); seed <= 20; seed++ {
+		var (
+			clock   = NewFakeClock(epoch)
+			f       = NewFaultInjector(&sensorPort{clock: clock}, noisyLine(seed, clock))
+			z       = NewZH07q(&Config{RW: bufio.NewReadWriter(bufio.NewReader(f), bufio.NewWriter(f)), WarmUp: -1, Clock: clock})
+			valid   int
+			invalid int // checksum mismatches and incomplete answers
+		)
+
+		assert.NoError(t, z.Init())
+		for i := 0; i < 100; i++ {
+			r, err := z.Read()
+			switch {
+			case err == nil:
+				valid++
+				assert.Equal(t, &Reading{PM1: 0x65, PM25: 0x85, PM10: 0x96}, r, "seed %d", seed)
+			case errors.Is(err, ErrChecksumMismatch), errors.Is(err, ErrSensorCommunication):
+				invalid++
+			default:
+				assert.NoError(t, err)
+			}
+		}
+
+		assert.Greater(t, valid, 80, "seed %d: most answers get through, stats %+v", seed, f.Stats())
+		assert.Equal(t, 100, valid+invalid)
+	}
+}
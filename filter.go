@@ -0,0 +1,473 @@
+package zh07
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	defaultFilterWindow    = 5
+	defaultHampelThreshold = 3
+	defaultRateResetAfter  = 3
+
+	// madScale makes the median absolute deviation a consistent estimator of
+	// the standard deviation for normally distributed data.
+	madScale = 1.4826
+)
+
+var _ SensorInterface = (*FilteredSensor)(nil)
+
+// OutlierAction selects what a filter does with a reading it considers an outlier.
+type OutlierAction int
+
+const (
+	// OutlierFlag passes the reading through unchanged along with an error
+	OutlierFlag OutlierAction = iota
+	// OutlierSuppress drops the reading, returning nil along with an error
+	OutlierSuppress
+	// OutlierReplace replaces the offending values with the filter's estimate
+	OutlierReplace
+)
+
+// OutlierError describes why a filter rejected a value. It wraps ErrOutlier.
+type OutlierError struct {
+	Filter   string  // name of the filter that rejected the value
+	Channel  string  // PM channel, one of "PM1.0", "PM2.5" or "PM10"
+	Value    int     // value received [μg/m³]
+	Expected float64 // value estimated by the filter [μg/m³]
+	Reason   string  // human readable explanation
+}
+
+// Error implements the error interface.
+func (e *OutlierError) Error() string {
+	return fmt.Sprintf("%v: %s: %s=%d, expected %.1f: %s", ErrOutlier, e.Filter, e.Channel, e.Value, e.Expected, e.Reason)
+}
+
+// Unwrap allows errors.Is(err, ErrOutlier).
+func (e *OutlierError) Unwrap() error {
+	return ErrOutlier
+}
+
+// Filter inspects readings one at a time, in the order they were taken.
+type Filter interface {
+	// Apply returns the reading to pass on and, when r was considered an
+	// outlier, an error wrapping ErrOutlier. The returned reading is nil when
+	// r was suppressed. Apply never modifies r.
+	Apply(r *Reading) (*Reading, error)
+}
+
+// ApplyFilters runs r through filters in order, which makes it suitable for
+// filtering a stream of readings. It stops early when a filter suppresses the
+// reading. Errors from every filter are joined together.
+func ApplyFilters(r *Reading, filters ...Filter) (*Reading, error) {
+	var errs []error
+	for _, f := range filters {
+		if r == nil {
+			break
+		}
+
+		var err error
+		if r, err = f.Apply(r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return r, errors.Join(errs...)
+}
+
+// FilteredSensor wraps a sensor and runs every reading through a set of filters.
+type FilteredSensor struct {
+	sensor  SensorInterface
+	filters []Filter
+}
+
+// NewFilteredSensor creates a sensor whose readings go through filters, in order.
+func NewFilteredSensor(sensor SensorInterface, filters ...Filter) *FilteredSensor {
+	return &FilteredSensor{
+		sensor:  sensor,
+		filters: filters,
+	}
+}
+
+// Init initializes the wrapped sensor.
+func (f *FilteredSensor) Init() error {
+	return f.sensor.Init()
+}
+
+// CalculateChecksum calculates the checksum of the wrapped sensor's last payload.
+func (f *FilteredSensor) CalculateChecksum() int {
+	return f.sensor.CalculateChecksum()
+}
+
+// IsReadingValid checks the wrapped sensor's last payload.
+func (f *FilteredSensor) IsReadingValid() bool {
+	return f.sensor.IsReadingValid()
+}
+
+// Read reads from the wrapped sensor and applies the filters. Errors wrapping
+// ErrOutlier may come with a non-nil reading, depending on the OutlierAction.
+func (f *FilteredSensor) Read() (*Reading, error) {
+	r, err := f.sensor.Read()
+	if err != nil || r == nil {
+		return r, err
+	}
+
+	return ApplyFilters(r, f.filters...)
+}
+
+// MedianFilterConfig holds configuration options for a MedianFilter.
+type MedianFilterConfig struct {
+	// Window is the number of samples, including the current one, the median
+	// is taken over, 5 if zero
+	Window int
+	// MaxDeviation is the largest distance from the median a value may have
+	// before it is considered an outlier [μg/m³]. Zero disables detection, so
+	// the filter only smooths readings when Action is OutlierReplace.
+	MaxDeviation float64
+	// Action is what to do with outliers
+	Action OutlierAction
+}
+
+// MedianFilter compares every value with the running median of the last samples.
+// With OutlierReplace and no MaxDeviation it acts as a plain running median
+// smoother.
+type MedianFilter struct {
+	config  MedianFilterConfig
+	history [3]*series
+}
+
+// NewMedianFilter creates a new running median filter.
+func NewMedianFilter(config *MedianFilterConfig) *MedianFilter {
+	if config == nil {
+		config = &MedianFilterConfig{}
+	}
+
+	if config.Window <= 0 {
+		config.Window = defaultFilterWindow
+	}
+
+	return &MedianFilter{
+		config:  *config,
+		history: newHistory(config.Window),
+	}
+}
+
+// Apply implements Filter.
+func (f *MedianFilter) Apply(r *Reading) (*Reading, error) {
+	var (
+		out  = *r
+		errs []error
+	)
+
+	for i, c := range pmChannels {
+		var (
+			v = c.value(&out)
+			h = f.history[i]
+		)
+
+		h.push(float64(*v))
+		m := h.median()
+		d := math.Abs(float64(*v) - m)
+
+		switch {
+		case f.config.MaxDeviation > 0 && d > f.config.MaxDeviation:
+			errs = append(errs, &OutlierError{
+				Filter:   "median",
+				Channel:  c.name,
+				Value:    *v,
+				Expected: m,
+				Reason:   fmt.Sprintf("deviation %.1f exceeds %.1f", d, f.config.MaxDeviation),
+			})
+			if f.config.Action == OutlierReplace {
+				*v = int(math.Round(m))
+			}
+		case f.config.MaxDeviation <= 0 && f.config.Action == OutlierReplace:
+			*v = int(math.Round(m))
+		}
+	}
+
+	return outlierResult(r, &out, f.config.Action, errs)
+}
+
+// HampelFilterConfig holds configuration options for a HampelFilter.
+type HampelFilterConfig struct {
+	// Window is the number of previous samples used as reference, 5 if zero
+	Window int
+	// Threshold is the number of scaled median absolute deviations a value
+	// may be away from the median before it is considered an outlier, 3 if zero
+	Threshold float64
+	// MinDeviation is a floor for the allowed deviation [μg/m³], so that small
+	// changes after a run of identical values are not reported as outliers
+	MinDeviation float64
+	// Action is what to do with outliers
+	Action OutlierAction
+}
+
+// HampelFilter implements the Hampel identifier: a value is an outlier when it
+// is further from the median of the previous samples than Threshold times
+// their scaled median absolute deviation (MAD).
+type HampelFilter struct {
+	config  HampelFilterConfig
+	history [3]*series
+}
+
+// NewHampelFilter creates a new Hampel identifier.
+func NewHampelFilter(config *HampelFilterConfig) *HampelFilter {
+	if config == nil {
+		config = &HampelFilterConfig{}
+	}
+
+	if config.Window <= 0 {
+		config.Window = defaultFilterWindow
+	}
+
+	if config.Threshold <= 0 {
+		config.Threshold = defaultHampelThreshold
+	}
+
+	return &HampelFilter{
+		config:  *config,
+		history: newHistory(config.Window),
+	}
+}
+
+// Apply implements Filter. Values pass untouched until the window has filled up.
+func (f *HampelFilter) Apply(r *Reading) (*Reading, error) {
+	var (
+		out  = *r
+		errs []error
+	)
+
+	for i, c := range pmChannels {
+		var (
+			v = c.value(&out)
+			h = f.history[i]
+			x = float64(*v)
+		)
+
+		if h.len() == f.config.Window {
+			var (
+				m     = h.median()
+				limit = math.Max(f.config.Threshold*madScale*h.mad(m), f.config.MinDeviation)
+				d     = math.Abs(x - m)
+			)
+
+			if d > limit {
+				errs = append(errs, &OutlierError{
+					Filter:   "hampel",
+					Channel:  c.name,
+					Value:    *v,
+					Expected: m,
+					Reason:   fmt.Sprintf("deviation %.1f exceeds %.1f", d, limit),
+				})
+				if f.config.Action == OutlierReplace {
+					*v = int(math.Round(m))
+				}
+			}
+		}
+
+		// the raw value always goes into the history; a single spike barely
+		// moves the median, and a genuine step change is accepted after a few
+		// samples
+		h.push(x)
+	}
+
+	return outlierResult(r, &out, f.config.Action, errs)
+}
+
+// RateFilterConfig holds configuration options for a RateFilter.
+type RateFilterConfig struct {
+	// MaxDelta is the largest change allowed between consecutive samples [μg/m³]
+	MaxDelta int
+	// ResetAfter is the number of consecutive rejections after which the new
+	// level is accepted as genuine, 3 if zero
+	ResetAfter int
+	// Action is what to do with outliers. OutlierReplace clamps the value to
+	// the allowed range.
+	Action OutlierAction
+}
+
+// RateFilter limits how fast a value may change from one sample to the next.
+type RateFilter struct {
+	config   RateFilterConfig
+	last     [3]int
+	rejected [3]int
+	primed   bool
+}
+
+// NewRateFilter creates a new rate-of-change limiter.
+func NewRateFilter(config *RateFilterConfig) *RateFilter {
+	if config == nil {
+		config = &RateFilterConfig{}
+	}
+
+	if config.ResetAfter <= 0 {
+		config.ResetAfter = defaultRateResetAfter
+	}
+
+	return &RateFilter{config: *config}
+}
+
+// Apply implements Filter.
+func (f *RateFilter) Apply(r *Reading) (*Reading, error) {
+	var (
+		out  = *r
+		errs []error
+	)
+
+	for i, c := range pmChannels {
+		v := c.value(&out)
+
+		if !f.primed || f.config.MaxDelta <= 0 {
+			f.last[i] = *v
+			continue
+		}
+
+		d := *v - f.last[i]
+		if d >= -f.config.MaxDelta && d <= f.config.MaxDelta {
+			f.last[i], f.rejected[i] = *v, 0
+			continue
+		}
+
+		f.rejected[i]++
+		if f.rejected[i] > f.config.ResetAfter {
+			f.last[i], f.rejected[i] = *v, 0
+			continue
+		}
+
+		errs = append(errs, &OutlierError{
+			Filter:   "rate",
+			Channel:  c.name,
+			Value:    *v,
+			Expected: float64(f.last[i]),
+			Reason:   fmt.Sprintf("change %+d exceeds ±%d", d, f.config.MaxDelta),
+		})
+
+		if f.config.Action == OutlierReplace {
+			if d > 0 {
+				*v = f.last[i] + f.config.MaxDelta
+			} else {
+				*v = f.last[i] - f.config.MaxDelta
+			}
+			f.last[i] = *v
+		}
+	}
+	f.primed = true
+
+	return outlierResult(r, &out, f.config.Action, errs)
+}
+
+// pmChannels gives filters uniform access to every PM channel of a reading.
+var pmChannels = [3]struct {
+	name  string
+	value func(r *Reading) *int
+}{
+	{name: "PM1.0", value: func(r *Reading) *int { return &r.PM1 }},
+	{name: "PM2.5", value: func(r *Reading) *int { return &r.PM25 }},
+	{name: "PM10", value: func(r *Reading) *int { return &r.PM10 }},
+}
+
+// outlierResult picks the reading a filter returns according to action.
+func outlierResult(in, out *Reading, action OutlierAction, errs []error) (*Reading, error) {
+	if len(errs) == 0 {
+		if action == OutlierReplace {
+			return out, nil
+		}
+		return in, nil
+	}
+
+	err := errors.Join(errs...)
+	switch action {
+	case OutlierSuppress:
+		return nil, err
+	case OutlierReplace:
+		return out, err
+	default:
+		return in, err
+	}
+}
+
+// series is a fixed size ring of the most recent values of a channel.
+type series struct {
+	values  []float64
+	next    int
+	n       int
+	scratch []float64
+}
+
+// newHistory creates one series per PM channel.
+func newHistory(size int) [3]*series {
+	return [3]*series{newSeries(size), newSeries(size), newSeries(size)}
+}
+
+// newSeries creates an empty series holding up to size values.
+func newSeries(size int) *series {
+	return &series{
+		values:  make([]float64, size),
+		scratch: make([]float64, 0, size),
+	}
+}
+
+// push adds v, discarding the oldest value when the series is full.
+func (s *series) push(v float64) {
+	s.values[s.next] = v
+	s.next = (s.next + 1) % len(s.values)
+	if s.n < len(s.values) {
+		s.n++
+	}
+}
+
+// len returns the number of values held.
+func (s *series) len() int {
+	return s.n
+}
+
+// median returns the median of the values held.
+func (s *series) median() float64 {
+	s.scratch = append(s.scratch[:0], s.values[:s.n]...)
+	sort.Float64s(s.scratch)
+	return percentile(s.scratch, 50)
+}
+
+// mad returns the median absolute deviation of the values held around m.
+func (s *series) mad(m float64) float64 {
+	s.scratch = s.scratch[:0]
+	for _, v := range s.values[:s.n] {
+		s.scratch = append(s.scratch, math.Abs(v-m))
+	}
+	sort.Float64s(s.scratch)
+	return percentile(s.scratch, 50)
+}
+
+// mean returns the arithmetic mean of the values held.
+func (s *series) mean() float64 {
+	if s.n == 0 {
+		return 0
+	}
+
+	var sum float64
+	for _, v := range s.values[:s.n] {
+		sum += v
+	}
+
+	return sum / float64(s.n)
+}
+
+// stddev returns the population standard deviation of the values held.
+func (s *series) stddev() float64 {
+	if s.n == 0 {
+		return 0
+	}
+
+	var (
+		m  = s.mean()
+		sq float64
+	)
+	for _, v := range s.values[:s.n] {
+		sq += (v - m) * (v - m)
+	}
+
+	return math.Sqrt(sq / float64(s.n))
+}
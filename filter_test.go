@@ -0,0 +1,176 @@
+package zh07
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHampelFilter_Apply(t *testing.T) {
+	tests := []struct {
+		name   string
+		action OutlierAction
+		want   *Reading
+	}{
+		{name: "flag", action: OutlierFlag, want: same(200)},
+		{name: "suppress", action: OutlierSuppress, want: nil},
+		{name: "replace", action: OutlierReplace, want: same(11)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewHampelFilter(&HampelFilterConfig{Action: tt.action})
+
+			for _, v := range []int{10, 11, 10, 12, 11} {
+				got, err := f.Apply(same(v))
+				assert.NoError(t, err)
+				assert.Equal(t, same(v), got)
+			}
+
+			got, err := f.Apply(same(200))
+			assert.ErrorIs(t, err, ErrOutlier)
+			assert.Equal(t, tt.want, got)
+
+			var oe *OutlierError
+			if assert.ErrorAs(t, err, &oe) {
+				assert.Equal(t, "hampel", oe.Filter)
+				assert.Equal(t, "PM1.0", oe.Channel)
+				assert.Equal(t, 200, oe.Value)
+				assert.Equal(t, 11.0, oe.Expected)
+			}
+
+			_, err = f.Apply(same(12))
+			assert.NoError(t, err, "the spike must not disturb the following samples")
+		})
+	}
+}
+
+func TestHampelFilter_MinDeviation(t *testing.T) {
+	f := NewHampelFilter(&HampelFilterConfig{Window: 3, MinDeviation: 2})
+
+	for _, v := range []int{5, 5, 5, 6} {
+		_, err := f.Apply(same(v))
+		assert.NoErrorf(t, err, "value %d", v)
+	}
+
+	_, err := f.Apply(same(8))
+	assert.ErrorIs(t, err, ErrOutlier)
+}
+
+func TestMedianFilter_Apply(t *testing.T) {
+	t.Run("smooth", func(t *testing.T) {
+		f := NewMedianFilter(&MedianFilterConfig{Window: 3, Action: OutlierReplace})
+
+		var got []int
+		for _, v := range []int{10, 50, 12, 14, 13} {
+			r, err := f.Apply(&Reading{PM25: v})
+			assert.NoError(t, err)
+			got = append(got, r.PM25)
+		}
+		assert.Equal(t, []int{10, 30, 12, 14, 13}, got)
+	})
+
+	t.Run("flag", func(t *testing.T) {
+		f := NewMedianFilter(&MedianFilterConfig{Window: 3, MaxDeviation: 20})
+
+		for _, v := range []int{10, 12} {
+			_, err := f.Apply(&Reading{PM10: v})
+			assert.NoError(t, err)
+		}
+
+		in := &Reading{PM10: 90}
+		got, err := f.Apply(in)
+		assert.ErrorIs(t, err, ErrOutlier)
+		assert.Same(t, in, got)
+		assert.Contains(t, err.Error(), "median: PM10=90")
+	})
+}
+
+func TestRateFilter_Apply(t *testing.T) {
+	t.Run("reject-and-reset", func(t *testing.T) {
+		f := NewRateFilter(&RateFilterConfig{MaxDelta: 5, ResetAfter: 2, Action: OutlierSuppress})
+
+		var errs []bool
+		for _, v := range []int{10, 30, 14, 40, 41, 43} {
+			r, err := f.Apply(&Reading{PM1: v})
+			errs = append(errs, err != nil)
+			assert.Equal(t, err != nil, r == nil)
+		}
+		assert.Equal(t, []bool{false, true, false, true, true, false}, errs)
+	})
+
+	t.Run("reset-after", func(t *testing.T) {
+		f := NewRateFilter(&RateFilterConfig{MaxDelta: 5, Action: OutlierSuppress})
+
+		for _, v := range []int{10, 50, 51, 52} {
+			_, err := f.Apply(&Reading{PM10: v})
+			assert.Equal(t, v != 10, err != nil, "PM10=%d", v)
+		}
+		r, err := f.Apply(&Reading{PM10: 53})
+		assert.NoError(t, err, "accepted after 3 rejections")
+		assert.Equal(t, 53, r.PM10)
+	})
+
+	t.Run("clamp", func(t *testing.T) {
+		f := NewRateFilter(&RateFilterConfig{MaxDelta: 5, ResetAfter: 5, Action: OutlierReplace})
+
+		var got []int
+		for _, v := range []int{10, 30, 30, 0} {
+			r, _ := f.Apply(&Reading{PM25: v})
+			got = append(got, r.PM25)
+		}
+		assert.Equal(t, []int{10, 15, 20, 15}, got)
+	})
+}
+
+func TestApplyFilters(t *testing.T) {
+	var (
+		rate   = NewRateFilter(&RateFilterConfig{MaxDelta: 1, Action: OutlierReplace})
+		median = NewMedianFilter(&MedianFilterConfig{Window: 2, MaxDeviation: 0.1, Action: OutlierSuppress})
+	)
+
+	r, err := ApplyFilters(same(10), rate, median)
+	assert.NoError(t, err)
+	assert.Equal(t, same(10), r)
+
+	r, err = ApplyFilters(same(20), rate, median)
+	assert.ErrorIs(t, err, ErrOutlier)
+	assert.Nil(t, r)
+	assert.Contains(t, err.Error(), "rate:")
+	assert.Contains(t, err.Error(), "median:")
+}
+
+func TestFilteredSensor_Read(t *testing.T) {
+	var (
+		commErr = fmt.Errorf("%w: test", ErrSensorCommunication)
+		s       = &scriptedSensor{
+			readings: []*Reading{same(10), nil, nil, same(11), same(50)},
+			errs:     []error{nil, nil, commErr},
+		}
+		f = NewFilteredSensor(s, NewRateFilter(&RateFilterConfig{MaxDelta: 5}))
+	)
+
+	assert.NoError(t, f.Init())
+	assert.Equal(t, 1, s.inits)
+	assert.True(t, f.IsReadingValid())
+	assert.Equal(t, 0, f.CalculateChecksum())
+
+	r, err := f.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, same(10), r)
+
+	r, err = f.Read()
+	assert.NoError(t, err, "skipped frames pass through")
+	assert.Nil(t, r)
+
+	_, err = f.Read()
+	assert.True(t, errors.Is(err, ErrSensorCommunication))
+
+	_, err = f.Read()
+	assert.NoError(t, err)
+
+	r, err = f.Read()
+	assert.ErrorIs(t, err, ErrOutlier)
+	assert.Equal(t, same(50), r)
+}
@@ -0,0 +1,228 @@
+package zh07
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// frameWindow is the number of recent intervals the nominal interval is
+	// estimated from
+	frameWindow = 16
+	// minFrameIntervals is the number of intervals needed for an estimate
+	minFrameIntervals = 3
+)
+
+// FrameStats describes the initiative upload frames received by a ZH07i, or a
+// ZH07q switched to initiative upload mode, to tell whether frames are lost
+// and why.
+type FrameStats struct {
+	Frames          int           // frames received, whatever their checksum
+	ChecksumErrors  int           // frames received with a bad checksum
+	NominalInterval time.Duration // median of the recent intervals between frames, zero until a few were received
+	LastInterval    time.Duration // time between the last two frames
+	LastFrame       time.Time     // time the last frame was read
+	Gaps            int           // intervals longer than 1.5 nominal intervals not made up for by backlogged frames, frames were lost
+	Missed          int           // frames estimated lost in those gaps
+	Backlogged      int           // frames read less than half a nominal interval, or less than their transmission time, after the previous one: queued while the consumer was busy
+	Resyncs         int           // times the start of a frame had to be searched for
+	Discarded       int           // bytes discarded while searching
+}
+
+// Rate returns the estimated number of frames per second, zero until the
+// nominal interval is known.
+func (s FrameStats) Rate() float64 {
+	if s.NominalInterval <= 0 {
+		return 0
+	}
+	return float64(time.Second) / float64(s.NominalInterval)
+}
+
+// FrameEventKind tells what happened to the stream of frames.
+type FrameEventKind int
+
+const (
+	// FrameGap means frames were lost: the sensor skipped them, the line
+	// dropped them, or they overflowed a buffer while the consumer was busy
+	FrameGap FrameEventKind = iota
+	// FrameBacklog means a frame was read right after the previous one, it
+	// was queued while the consumer was busy
+	FrameBacklog
+	// FrameResync means bytes were discarded before the start of a frame
+	FrameResync
+)
+
+// String returns the name of the kind.
+func (k FrameEventKind) String() string {
+	switch k {
+	case FrameGap:
+		return "gap"
+	case FrameBacklog:
+		return "backlog"
+	case FrameResync:
+		return "resync"
+	default:
+		return fmt.Sprintf("FrameEventKind(%d)", int(k))
+	}
+}
+
+// FrameEvent reports a problem with the stream of frames, see Config.FrameEvents.
+// The frames missed in a gap are estimated when it is detected: when
+// backlogged frames follow, they were queued rather than lost, and FrameStats
+// counts them as such.
+type FrameEvent struct {
+	Kind      FrameEventKind
+	Time      time.Time     // time the frame following the problem was read
+	Interval  time.Duration // time since the previous frame, for gaps and backlogs
+	Nominal   time.Duration // nominal interval between frames, for gaps and backlogs
+	Missed    int           // frames estimated lost, for gaps
+	Discarded int           // bytes discarded, for resyncs
+}
+
+// String describes the event.
+func (e FrameEvent) String() string {
+	switch e.Kind {
+	case FrameGap:
+		return fmt.Sprintf("gap: %v since the previous frame, %d missed", e.Interval, e.Missed)
+	case FrameBacklog:
+		return fmt.Sprintf("backlog: %v since the previous frame, %v expected", e.Interval, e.Nominal)
+	case FrameResync:
+		return fmt.Sprintf("resync: %d bytes discarded", e.Discarded)
+	default:
+		return e.Kind.String()
+	}
+}
+
+// frameMonitor keeps the FrameStats of a driver and reports the problems it
+// detects.
+type frameMonitor struct {
+	notify  func(e FrameEvent)
+	airtime time.Duration // time to transmit a frame, a frame read sooner was queued
+
+	mu        sync.Mutex
+	stats     FrameStats
+	intervals [frameWindow]time.Duration // ring of the recent intervals
+	count     int                        // intervals in the ring
+	since     time.Time                  // time of the previous frame, zero after a restart
+	skipped   int                        // bytes discarded since the last frame
+	burst     int                        // frames read since the last one that was not backlogged, itself included
+	span      time.Duration              // time from the frame preceding the burst to the last one
+	gapMissed int                        // frames counted as missed in the gap preceding the burst
+}
+
+// snapshot returns a copy of the statistics.
+func (m *frameMonitor) snapshot() FrameStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.stats
+}
+
+// skip records n bytes discarded while looking for a frame.
+func (m *frameMonitor) skip(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.skipped == 0 {
+		m.stats.Resyncs++
+	}
+	m.skipped += n
+	m.stats.Discarded += n
+}
+
+// restart forgets the time of the previous frame, so that the interval
+// spanning a mode change or dormancy is not taken for a gap.
+func (m *frameMonitor) restart() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.since = time.Time{}
+	m.burst, m.gapMissed = 0, 0
+}
+
+// frame records a frame read at t and sends the resulting events.
+func (m *frameMonitor) frame(t time.Time, valid bool) {
+	var (
+		events [2]FrameEvent
+		n      int
+	)
+
+	m.mu.Lock()
+	s := &m.stats
+	s.Frames++
+	s.LastFrame = t
+	if !valid {
+		s.ChecksumErrors++
+	}
+
+	if m.skipped > 0 {
+		events[n] = FrameEvent{Kind: FrameResync, Time: t, Discarded: m.skipped}
+		n++
+		m.skipped = 0
+	}
+
+	if !m.since.IsZero() {
+		d := t.Sub(m.since)
+		s.LastInterval = d
+
+		nominal := s.NominalInterval
+		if d < m.airtime || 2*d < nominal {
+			// queued while the consumer was busy: it is one of the frames
+			// taken for missed in the gap before it, if any, and it was sent
+			// during the interval preceding the burst, which is spread over
+			// the frames of the burst
+			s.Backlogged++
+			events[n] = FrameEvent{Kind: FrameBacklog, Time: t, Interval: d, Nominal: nominal}
+			n++
+
+			if m.gapMissed > 0 {
+				m.gapMissed--
+				if s.Missed--; m.gapMissed == 0 {
+					s.Gaps--
+				}
+			}
+			if m.burst > 0 {
+				m.burst++
+				m.span += d
+				m.intervals[(m.count-1)%frameWindow] = m.span / time.Duration(m.burst)
+			}
+		} else {
+			m.gapMissed = 0
+			if nominal > 0 && 2*d > 3*nominal {
+				missed := max(int((d+nominal/2)/nominal)-1, 1) // rounded to the nearest frame
+				s.Gaps++
+				s.Missed += missed
+				m.gapMissed = missed
+				events[n] = FrameEvent{Kind: FrameGap, Time: t, Interval: d, Nominal: nominal, Missed: missed}
+				n++
+			}
+
+			m.burst, m.span = 1, d
+			m.intervals[m.count%frameWindow] = d
+			m.count++
+		}
+
+		if m.count >= minFrameIntervals {
+			s.NominalInterval = m.median()
+		}
+	}
+	m.since = t
+	m.mu.Unlock()
+
+	if m.notify != nil {
+		for _, e := range events[:n] {
+			m.notify(e)
+		}
+	}
+}
+
+// median returns the median of the recent intervals. The caller must hold m.mu.
+func (m *frameMonitor) median() time.Duration {
+	var sorted [frameWindow]time.Duration
+	n := copy(sorted[:], m.intervals[:min(m.count, frameWindow)])
+	slices.Sort(sorted[:n])
+
+	return sorted[n/2]
+}
@@ -0,0 +1,219 @@
+package zh07
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameMonitor_frame(t *testing.T) {
+	tests := []struct {
+		name      string
+		intervals []time.Duration
+		stats     FrameStats
+		events    []FrameEventKind
+	}{
+		{
+			name:      "steady",
+			intervals: []time.Duration{time.Second, time.Second, time.Second, time.Second},
+			stats:     FrameStats{Frames: 5, NominalInterval: time.Second, LastInterval: time.Second},
+		},
+		{
+			name:      "too few intervals",
+			intervals: []time.Duration{time.Second, 5 * time.Second},
+			stats:     FrameStats{Frames: 3, LastInterval: 5 * time.Second},
+		},
+		{
+			name:      "gap",
+			intervals: []time.Duration{time.Second, time.Second, time.Second, 4 * time.Second, time.Second},
+			stats:     FrameStats{Frames: 6, NominalInterval: time.Second, LastInterval: time.Second, Gaps: 1, Missed: 3},
+			events:    []FrameEventKind{FrameGap},
+		},
+		{
+			name:      "short gap",
+			intervals: []time.Duration{time.Second, time.Second, time.Second, 1600 * time.Millisecond},
+			stats:     FrameStats{Frames: 5, NominalInterval: time.Second, LastInterval: 1600 * time.Millisecond, Gaps: 1, Missed: 1},
+			events:    []FrameEventKind{FrameGap},
+		},
+		{
+			name:      "jitter",
+			intervals: []time.Duration{time.Second, time.Second, time.Second, 1400 * time.Millisecond, 600 * time.Millisecond},
+			stats:     FrameStats{Frames: 6, NominalInterval: time.Second, LastInterval: 600 * time.Millisecond},
+		},
+		{
+			name:      "backlog",
+			intervals: []time.Duration{time.Second, time.Second, time.Second, 3 * time.Second, 10 * time.Millisecond, 10 * time.Millisecond},
+			stats: FrameStats{
+				Frames: 7, NominalInterval: time.Second, LastInterval: 10 * time.Millisecond,
+				Backlogged: 2,
+			},
+			events: []FrameEventKind{FrameGap, FrameBacklog, FrameBacklog},
+		},
+		{
+			name:      "gap and backlog",
+			intervals: []time.Duration{time.Second, time.Second, time.Second, 4 * time.Second, 10 * time.Millisecond},
+			stats: FrameStats{
+				Frames: 6, NominalInterval: time.Second, LastInterval: 10 * time.Millisecond,
+				Gaps: 1, Missed: 2, Backlogged: 1,
+			},
+			events: []FrameEventKind{FrameGap, FrameBacklog},
+		},
+		{
+			// a frame a second, read three at a time every 3 seconds
+			name: "slow consumer",
+			intervals: []time.Duration{
+				time.Millisecond, time.Millisecond,
+				3 * time.Second, time.Millisecond, time.Millisecond,
+				3 * time.Second, time.Millisecond, time.Millisecond,
+				3 * time.Second, time.Millisecond, time.Millisecond,
+				3 * time.Second, time.Millisecond, time.Millisecond,
+			},
+			stats: FrameStats{
+				Frames: 15, NominalInterval: 3002 * time.Millisecond / 3, LastInterval: time.Millisecond,
+				Backlogged: 10,
+			},
+			events: []FrameEventKind{
+				FrameBacklog, FrameBacklog,
+				FrameBacklog, FrameBacklog,
+				FrameBacklog, FrameBacklog,
+				FrameBacklog, FrameBacklog,
+				FrameGap, FrameBacklog, FrameBacklog, // taken back by the backlog
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				events []FrameEventKind
+				m      = frameMonitor{notify: func(e FrameEvent) { events = append(events, e.Kind) }, airtime: profileFor(ModelZH07).airtime()}
+				now    = epoch
+			)
+
+			m.frame(now, true)
+			for _, d := range tt.intervals {
+				now = now.Add(d)
+				m.frame(now, true)
+			}
+
+			tt.stats.LastFrame = now
+			assert.Equal(t, tt.stats, m.snapshot())
+			assert.Equal(t, tt.events, events)
+		})
+	}
+}
+
+func TestFrameMonitor_skip(t *testing.T) {
+	var (
+		events []FrameEvent
+		m      = frameMonitor{notify: func(e FrameEvent) { events = append(events, e) }}
+	)
+
+	m.skip(1)
+	m.skip(4)
+	m.frame(epoch, false)
+	m.skip(3)
+	m.frame(epoch.Add(time.Second), true)
+
+	s := m.snapshot()
+	assert.Equal(t, 2, s.Frames)
+	assert.Equal(t, 1, s.ChecksumErrors)
+	assert.Equal(t, 2, s.Resyncs)
+	assert.Equal(t, 8, s.Discarded)
+	assert.Equal(t, []FrameEvent{
+		{Kind: FrameResync, Time: epoch, Discarded: 5},
+		{Kind: FrameResync, Time: epoch.Add(time.Second), Discarded: 3},
+	}, events)
+}
+
+func TestFrameMonitor_restart(t *testing.T) {
+	var (
+		events int
+		m      = frameMonitor{notify: func(FrameEvent) { events++ }}
+		now    = epoch
+	)
+
+	for i := 0; i < 5; i++ {
+		m.frame(now, true)
+		now = now.Add(time.Second)
+	}
+	m.restart()
+	m.frame(now.Add(time.Minute), true) // dormant for a minute, not a gap
+
+	s := m.snapshot()
+	assert.Zero(t, s.Gaps)
+	assert.Equal(t, time.Second, s.NominalInterval)
+	assert.Zero(t, events)
+}
+
+func TestFrameStats_Rate(t *testing.T) {
+	assert.Zero(t, FrameStats{}.Rate())
+	assert.Equal(t, 2.0, FrameStats{NominalInterval: 500 * time.Millisecond}.Rate())
+}
+
+func TestFrameEvent_String(t *testing.T) {
+	assert.Equal(t, "gap: 3s since the previous frame, 2 missed",
+		FrameEvent{Kind: FrameGap, Interval: 3 * time.Second, Nominal: time.Second, Missed: 2}.String())
+	assert.Equal(t, "backlog: 10ms since the previous frame, 1s expected",
+		FrameEvent{Kind: FrameBacklog, Interval: 10 * time.Millisecond, Nominal: time.Second}.String())
+	assert.Equal(t, "resync: 4 bytes discarded", FrameEvent{Kind: FrameResync, Discarded: 4}.String())
+	assert.Equal(t, "FrameEventKind(9)", FrameEventKind(9).String())
+}
+
+func TestZH07i_FrameStats(t *testing.T) {
+	var (
+		clock   = NewFakeClock(epoch)
+		corrupt = bytes.Clone(sampleInitiativePayload)
+		line    bytes.Buffer
+		events  []FrameEvent
+	)
+	corrupt[10]++
+
+	line.Write([]byte{0x00, 0x42, 0x4D, 0x00, 0x00}) // the tail of a frame, then a bad length
+	line.Write(sampleInitiativePayload)
+	line.Write(sampleInitiativePayload)
+	line.Write(corrupt)
+	line.Write(sampleInitiativePayload)
+	line.Write(sampleInitiativePayload)
+
+	z := NewZH07i(&Config{
+		RW:             bufio.NewReadWriter(bufio.NewReader(&line), nil),
+		Clock:          clock,
+		WarmUp:         -1,
+		PostWriteDelay: -1,
+		FrameEvents:    func(e FrameEvent) { events = append(events, e) },
+	})
+
+	for i, d := range []time.Duration{0, time.Second, time.Second, time.Second, 3 * time.Second} {
+		clock.Advance(d)
+		for {
+			r, err := z.Read()
+			if i == 2 {
+				assert.ErrorIs(t, err, ErrChecksumMismatch, "the corrupt frame is timed all the same")
+				break
+			}
+			assert.NoError(t, err)
+			if r != nil {
+				break
+			}
+		}
+	}
+
+	s := z.FrameStats()
+	assert.Equal(t, 5, s.Frames)
+	assert.Equal(t, 1, s.ChecksumErrors)
+	assert.Equal(t, time.Second, s.NominalInterval)
+	assert.Equal(t, 3*time.Second, s.LastInterval)
+	assert.Equal(t, clock.Now(), s.LastFrame)
+	assert.Equal(t, 1, s.Gaps)
+	assert.Equal(t, 2, s.Missed)
+	assert.Equal(t, 1, s.Resyncs)
+	assert.Equal(t, 5, s.Discarded)
+	assert.Equal(t, []FrameEvent{
+		{Kind: FrameResync, Time: epoch, Discarded: 5},
+		{Kind: FrameGap, Time: clock.Now(), Interval: 3 * time.Second, Nominal: time.Second, Missed: 2},
+	}, events)
+}
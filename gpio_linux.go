@@ -0,0 +1,194 @@
+//go:build linux
+
+package zh07
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// GPIO character device uAPI v2, see include/uapi/linux/gpio.h
+const (
+	gpioV2LineFlagActiveLow = 1 << 1
+	gpioV2LineFlagInput     = 1 << 2
+	gpioV2LineFlagOutput    = 1 << 3
+	gpioV2LineFlagEdgeRise  = 1 << 4
+	gpioV2LineFlagEdgeFall  = 1 << 5
+
+	gpioV2LineEventRisingEdge = 1
+	gpioV2LineEventSize       = 48 // sizeof(struct gpio_v2_line_event)
+
+	gpioV2LineAttrIDOutputValues = 2
+
+	gpioV2GetLineIoctl       = 0xC250B407 // _IOWR(0xB4, 0x07, struct gpio_v2_line_request)
+	gpioV2LineSetValuesIoctl = 0xC010B40F // _IOWR(0xB4, 0x0F, struct gpio_v2_line_values)
+
+	gpioConsumer = "go-zh07"
+)
+
+// gpioV2LineAttribute mirrors struct gpio_v2_line_attribute.
+type gpioV2LineAttribute struct {
+	id      uint32
+	padding uint32
+	value   uint64 // flags, values or debounce_period_us, depending on id
+}
+
+// gpioV2LineConfigAttribute mirrors struct gpio_v2_line_config_attribute.
+type gpioV2LineConfigAttribute struct {
+	attr gpioV2LineAttribute
+	mask uint64
+}
+
+// gpioV2LineConfig mirrors struct gpio_v2_line_config.
+type gpioV2LineConfig struct {
+	flags    uint64
+	numAttrs uint32
+	padding  [5]uint32
+	attrs    [10]gpioV2LineConfigAttribute
+}
+
+// gpioV2LineRequest mirrors struct gpio_v2_line_request.
+type gpioV2LineRequest struct {
+	offsets         [64]uint32
+	consumer        [32]byte
+	config          gpioV2LineConfig
+	numLines        uint32
+	eventBufferSize uint32
+	padding         [5]uint32
+	fd              int32
+}
+
+// gpioV2LineValues mirrors struct gpio_v2_line_values.
+type gpioV2LineValues struct {
+	bits uint64
+	mask uint64
+}
+
+// the kernel rejects requests whose size does not match the ioctl number
+var _ [592]byte = [unsafe.Sizeof(gpioV2LineRequest{})]byte{}
+
+var (
+	_ EdgeSource  = (*GPIOLine)(nil)
+	_ PowerSwitch = (*GPIOPowerSwitch)(nil)
+)
+
+// GPIOLine is a single line requested from a GPIO character device, such as
+// /dev/gpiochip0.
+type GPIOLine struct {
+	f *os.File
+}
+
+// requestGPIOLine requests line offset of chip with the given flags.
+func requestGPIOLine(chip string, offset int, flags uint64, initial bool) (*GPIOLine, error) {
+	c, err := os.OpenFile(chip, os.O_RDWR|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	req := gpioV2LineRequest{numLines: 1}
+	req.offsets[0] = uint32(offset)
+	copy(req.consumer[:], gpioConsumer)
+	req.config.flags = flags
+
+	if flags&gpioV2LineFlagOutput != 0 {
+		req.config.numAttrs = 1
+		req.config.attrs[0] = gpioV2LineConfigAttribute{
+			attr: gpioV2LineAttribute{id: gpioV2LineAttrIDOutputValues, value: boolBit(initial)},
+			mask: 1,
+		}
+	}
+
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, c.Fd(), gpioV2GetLineIoctl, uintptr(unsafe.Pointer(&req))); errno != 0 {
+		return nil, fmt.Errorf("requesting line %d of %s: %w", offset, chip, errno)
+	}
+
+	return &GPIOLine{f: os.NewFile(uintptr(req.fd), fmt.Sprintf("%s:%d", chip, offset))}, nil
+}
+
+// OpenGPIOOutput requests line offset of chip as an output, driven to initial.
+// With activeLow, true drives the line low.
+func OpenGPIOOutput(chip string, offset int, activeLow, initial bool) (*GPIOLine, error) {
+	var flags uint64 = gpioV2LineFlagOutput
+	if activeLow {
+		flags |= gpioV2LineFlagActiveLow
+	}
+
+	return requestGPIOLine(chip, offset, flags, initial)
+}
+
+// SetValue drives an output line.
+func (l *GPIOLine) SetValue(v bool) error {
+	values := gpioV2LineValues{bits: boolBit(v), mask: 1}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, l.f.Fd(), gpioV2LineSetValuesIoctl, uintptr(unsafe.Pointer(&values))); errno != 0 {
+		return fmt.Errorf("setting %s: %w", l.f.Name(), errno)
+	}
+
+	return nil
+}
+
+// Close releases the line.
+func (l *GPIOLine) Close() error {
+	return l.f.Close()
+}
+
+// OpenGPIOInput requests line offset of chip as an input reporting both edges.
+func OpenGPIOInput(chip string, offset int) (*GPIOLine, error) {
+	return requestGPIOLine(chip, offset, gpioV2LineFlagInput|gpioV2LineFlagEdgeRise|gpioV2LineFlagEdgeFall, false)
+}
+
+// NextEdge implements EdgeSource for an input line, blocking until the kernel
+// reports the next edge. Timestamps come from CLOCK_MONOTONIC.
+func (l *GPIOLine) NextEdge() (Edge, error) {
+	// struct gpio_v2_line_event: timestamp_ns u64, id u32, offset u32,
+	// seqno u32, line_seqno u32, padding [6]u32
+	var b [gpioV2LineEventSize]byte
+	if _, err := io.ReadFull(l.f, b[:]); err != nil {
+		return Edge{}, fmt.Errorf("reading %s: %w", l.f.Name(), err)
+	}
+
+	return Edge{
+		Rising: binary.NativeEndian.Uint32(b[8:12]) == gpioV2LineEventRisingEdge,
+		Time:   time.Duration(binary.NativeEndian.Uint64(b[0:8])),
+	}, nil
+}
+
+// GPIOPowerSwitch is a PowerSwitch driving a GPIO line that switches the
+// sensor's supply, for instance through a MOSFET or a load switch.
+type GPIOPowerSwitch struct {
+	line *GPIOLine
+}
+
+// NewGPIOPowerSwitch requests line offset of chip as an output and turns the
+// supply on. Use activeLow when driving the line low turns the supply on.
+func NewGPIOPowerSwitch(chip string, offset int, activeLow bool) (*GPIOPowerSwitch, error) {
+	l, err := OpenGPIOOutput(chip, offset, activeLow, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GPIOPowerSwitch{line: l}, nil
+}
+
+// SetPower implements PowerSwitch.
+func (g *GPIOPowerSwitch) SetPower(on bool) error {
+	return g.line.SetValue(on)
+}
+
+// Close releases the GPIO line. The kernel leaves it in its last state.
+func (g *GPIOPowerSwitch) Close() error {
+	return g.line.Close()
+}
+
+// boolBit returns 1 for true and 0 for false.
+func boolBit(v bool) uint64 {
+	if v {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,57 @@
+//go:build !linux
+
+package zh07
+
+import "fmt"
+
+var (
+	_ EdgeSource  = (*GPIOLine)(nil)
+	_ PowerSwitch = (*GPIOPowerSwitch)(nil)
+)
+
+// GPIOLine is a single line requested from a GPIO character device. GPIO
+// character devices are only available on Linux.
+type GPIOLine struct{}
+
+// OpenGPIOOutput always fails with ErrNotSupported outside Linux.
+func OpenGPIOOutput(chip string, offset int, activeLow, initial bool) (*GPIOLine, error) {
+	return nil, fmt.Errorf("%w: GPIO character devices require Linux", ErrNotSupported)
+}
+
+// OpenGPIOInput always fails with ErrNotSupported outside Linux.
+func OpenGPIOInput(chip string, offset int) (*GPIOLine, error) {
+	return nil, fmt.Errorf("%w: GPIO character devices require Linux", ErrNotSupported)
+}
+
+// NextEdge always fails with ErrNotSupported outside Linux.
+func (l *GPIOLine) NextEdge() (Edge, error) {
+	return Edge{}, ErrNotSupported
+}
+
+// SetValue always fails with ErrNotSupported outside Linux.
+func (l *GPIOLine) SetValue(v bool) error {
+	return ErrNotSupported
+}
+
+// Close does nothing outside Linux.
+func (l *GPIOLine) Close() error {
+	return nil
+}
+
+// GPIOPowerSwitch is a PowerSwitch driving a GPIO line. It is only available on Linux.
+type GPIOPowerSwitch struct{}
+
+// NewGPIOPowerSwitch always fails with ErrNotSupported outside Linux.
+func NewGPIOPowerSwitch(chip string, offset int, activeLow bool) (*GPIOPowerSwitch, error) {
+	return nil, fmt.Errorf("%w: GPIO character devices require Linux", ErrNotSupported)
+}
+
+// SetPower always fails with ErrNotSupported outside Linux.
+func (g *GPIOPowerSwitch) SetPower(on bool) error {
+	return ErrNotSupported
+}
+
+// Close does nothing outside Linux.
+func (g *GPIOPowerSwitch) Close() error {
+	return nil
+}
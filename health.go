@@ -0,0 +1,320 @@
+package zh07
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHealthMaxSilence          = 10 * time.Second
+	defaultHealthFailedSilence       = time.Minute
+	defaultHealthDegradedAfterErrors = 3
+	defaultHealthFailedAfterErrors   = 10
+	defaultHealthMaxChecksumRate     = 0.1
+	defaultHealthMaxJitter           = 500 * time.Millisecond
+	defaultHealthConstantCount       = 300
+	defaultHealthWindow              = 60
+)
+
+var _ SensorInterface = (*HealthMonitor)(nil)
+
+// HealthStatus summarises the condition of a sensor.
+type HealthStatus int
+
+const (
+	// HealthOK means the sensor is producing valid readings as expected
+	HealthOK HealthStatus = iota
+	// HealthDegraded means the sensor still works but something looks wrong
+	HealthDegraded
+	// HealthFailed means the sensor is not producing valid readings
+	HealthFailed
+)
+
+// String returns the name of the status.
+func (s HealthStatus) String() string {
+	switch s {
+	case HealthOK:
+		return "ok"
+	case HealthDegraded:
+		return "degraded"
+	case HealthFailed:
+		return "failed"
+	default:
+		return fmt.Sprintf("HealthStatus(%d)", int(s))
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler so the status is rendered by
+// name in JSON documents.
+func (s HealthStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Health is a snapshot of the condition of a sensor.
+type Health struct {
+	Status              HealthStatus  `json:"status"`
+	Reasons             []string      `json:"reasons,omitempty"`               // why the status is not ok
+	LastValid           time.Time     `json:"last_valid"`                      // time of the last valid reading
+	LastValidAge        time.Duration `json:"last_valid_age"`                  // time since the last valid reading, or since monitoring started
+	ConsecutiveErrors   int           `json:"consecutive_errors"`              // errors since the last valid reading
+	ChecksumFailureRate float64       `json:"checksum_failure_rate"`           // fraction of recent frames with a bad checksum
+	FrameInterval       time.Duration `json:"frame_interval"`                  // mean time between recent valid readings
+	FrameJitter         time.Duration `json:"frame_jitter"`                    // standard deviation of the time between recent valid readings
+	ConstantOutput      bool          `json:"constant_output"`                 // the sensor keeps returning the very same values
+	ConstantCount       int           `json:"constant_count,omitempty"`        // length of the current run of identical readings
+	TotalReadings       int           `json:"total_readings"`                  // valid readings since monitoring started
+	TotalErrors         int           `json:"total_errors"`                    // errors since monitoring started
+	TotalChecksumErrors int           `json:"total_checksum_errors,omitempty"` // checksum failures since monitoring started
+}
+
+// HealthConfig holds configuration options for a HealthMonitor.
+type HealthConfig struct {
+	// MaxSilence is how long without a valid reading before the sensor is
+	// degraded, 10s if zero
+	MaxSilence time.Duration
+	// FailedSilence is how long without a valid reading before the sensor has
+	// failed, one minute if zero
+	FailedSilence time.Duration
+	// DegradedAfterErrors is the number of consecutive errors that degrades
+	// the sensor, 3 if zero
+	DegradedAfterErrors int
+	// FailedAfterErrors is the number of consecutive errors after which the
+	// sensor has failed, 10 if zero
+	FailedAfterErrors int
+	// MaxChecksumFailureRate is the fraction of recent frames with a bad
+	// checksum above which the sensor is degraded, 0.1 if zero
+	MaxChecksumFailureRate float64
+	// MaxJitter is the standard deviation of the frame interval above which
+	// the sensor is degraded, 500ms if zero. A negative value disables the check.
+	MaxJitter time.Duration
+	// ConstantCount is the number of consecutive identical readings after
+	// which the output is considered stuck, 300 if zero. A negative value
+	// disables the check.
+	ConstantCount int
+	// Window is the number of recent frames used for rates and jitter, 60 if zero
+	Window int
+	// Clock times the readings, SystemClock if nil
+	Clock Clock
+}
+
+// HealthMonitor wraps a sensor and keeps track of its condition.
+//
+// Read may be called from one goroutine while Health is scraped from others.
+type HealthMonitor struct {
+	sensor SensorInterface
+	config HealthConfig
+
+	mu        sync.Mutex
+	started   time.Time
+	health    Health
+	last      Reading
+	checksums *series // 1 for a bad checksum, 0 for a good one
+	intervals *series // seconds between valid readings
+}
+
+// NewHealthMonitor creates a new HealthMonitor around sensor.
+func NewHealthMonitor(sensor SensorInterface, config *HealthConfig) *HealthMonitor {
+	if config == nil {
+		config = &HealthConfig{}
+	}
+
+	if config.MaxSilence <= 0 {
+		config.MaxSilence = defaultHealthMaxSilence
+	}
+
+	if config.FailedSilence <= 0 {
+		config.FailedSilence = defaultHealthFailedSilence
+	}
+
+	if config.DegradedAfterErrors <= 0 {
+		config.DegradedAfterErrors = defaultHealthDegradedAfterErrors
+	}
+
+	if config.FailedAfterErrors <= 0 {
+		config.FailedAfterErrors = defaultHealthFailedAfterErrors
+	}
+
+	if config.MaxChecksumFailureRate <= 0 {
+		config.MaxChecksumFailureRate = defaultHealthMaxChecksumRate
+	}
+
+	if config.MaxJitter == 0 {
+		config.MaxJitter = defaultHealthMaxJitter
+	}
+
+	if config.ConstantCount == 0 {
+		config.ConstantCount = defaultHealthConstantCount
+	}
+
+	if config.Window <= 0 {
+		config.Window = defaultHealthWindow
+	}
+
+	if config.Clock == nil {
+		config.Clock = SystemClock
+	}
+
+	return &HealthMonitor{
+		sensor:    sensor,
+		config:    *config,
+		checksums: newSeries(config.Window),
+		intervals: newSeries(config.Window),
+	}
+}
+
+// Init initializes the wrapped sensor and starts monitoring.
+func (h *HealthMonitor) Init() error {
+	h.mu.Lock()
+	h.start()
+	h.mu.Unlock()
+
+	err := h.sensor.Init()
+	if err != nil {
+		h.record(nil, err)
+	}
+
+	return err
+}
+
+// CalculateChecksum calculates the checksum of the wrapped sensor's last payload.
+func (h *HealthMonitor) CalculateChecksum() int {
+	return h.sensor.CalculateChecksum()
+}
+
+// IsReadingValid checks the wrapped sensor's last payload.
+func (h *HealthMonitor) IsReadingValid() bool {
+	return h.sensor.IsReadingValid()
+}
+
+// Read reads from the wrapped sensor and records the outcome. Readings and
+// errors are returned unchanged.
+func (h *HealthMonitor) Read() (*Reading, error) {
+	r, err := h.sensor.Read()
+	h.record(r, err)
+
+	return r, err
+}
+
+// Health returns a snapshot of the sensor's condition.
+func (h *HealthMonitor) Health() Health {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.start()
+
+	var (
+		s    = h.health
+		base = s.LastValid
+	)
+
+	if base.IsZero() {
+		base = h.started
+	}
+	s.LastValidAge = h.config.Clock.Now().Sub(base)
+
+	if h.checksums.len() > 0 {
+		s.ChecksumFailureRate = h.checksums.mean()
+	}
+
+	if h.intervals.len() > 0 {
+		s.FrameInterval = seconds(h.intervals.mean())
+		s.FrameJitter = seconds(h.intervals.stddev())
+	}
+
+	s.ConstantOutput = h.config.ConstantCount > 0 && s.ConstantCount >= h.config.ConstantCount
+
+	var failed, degraded []string
+	switch {
+	case s.LastValidAge >= h.config.FailedSilence:
+		failed = append(failed, fmt.Sprintf("no valid reading for %v", s.LastValidAge.Round(time.Second)))
+	case s.LastValidAge >= h.config.MaxSilence:
+		degraded = append(degraded, fmt.Sprintf("no valid reading for %v", s.LastValidAge.Round(time.Second)))
+	}
+
+	switch {
+	case s.ConsecutiveErrors >= h.config.FailedAfterErrors:
+		failed = append(failed, fmt.Sprintf("%d consecutive errors", s.ConsecutiveErrors))
+	case s.ConsecutiveErrors >= h.config.DegradedAfterErrors:
+		degraded = append(degraded, fmt.Sprintf("%d consecutive errors", s.ConsecutiveErrors))
+	}
+
+	if s.ChecksumFailureRate > h.config.MaxChecksumFailureRate {
+		degraded = append(degraded, fmt.Sprintf("checksum failure rate %.0f%%", s.ChecksumFailureRate*100))
+	}
+
+	if h.config.MaxJitter > 0 && s.FrameJitter > h.config.MaxJitter {
+		degraded = append(degraded, fmt.Sprintf("frame interval jitter %v", s.FrameJitter.Round(time.Millisecond)))
+	}
+
+	if s.ConstantOutput {
+		degraded = append(degraded, fmt.Sprintf("constant output for %d readings", s.ConstantCount))
+	}
+
+	switch {
+	case len(failed) > 0:
+		s.Status = HealthFailed
+	case len(degraded) > 0:
+		s.Status = HealthDegraded
+	default:
+		s.Status = HealthOK
+	}
+	s.Reasons = append(failed, degraded...)
+
+	return s
+}
+
+// start sets the time monitoring started, if not set already.
+func (h *HealthMonitor) start() {
+	if h.started.IsZero() {
+		h.started = h.config.Clock.Now()
+	}
+}
+
+// record updates the counters with the outcome of a read.
+func (h *HealthMonitor) record(r *Reading, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.start()
+
+	switch {
+	case err != nil:
+		h.health.ConsecutiveErrors++
+		h.health.TotalErrors++
+		if errors.Is(err, ErrChecksumMismatch) {
+			h.health.TotalChecksumErrors++
+			h.checksums.push(1)
+		}
+		return
+	case r == nil: // frame skipped while resynchronising
+		return
+	case !h.sensor.IsReadingValid(): // the sensor leaves validation to the caller
+		h.health.TotalChecksumErrors++
+		h.checksums.push(1)
+		return
+	}
+
+	now := h.config.Clock.Now()
+	h.checksums.push(0)
+	if !h.health.LastValid.IsZero() {
+		h.intervals.push(now.Sub(h.health.LastValid).Seconds())
+	}
+
+	if h.health.ConstantCount > 0 && r.PM1 == h.last.PM1 && r.PM25 == h.last.PM25 && r.PM10 == h.last.PM10 {
+		h.health.ConstantCount++
+	} else {
+		h.last, h.health.ConstantCount = *r, 1
+	}
+
+	h.health.LastValid = now
+	h.health.ConsecutiveErrors = 0
+	h.health.TotalReadings++
+}
+
+// seconds converts a number of seconds into a time.Duration.
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Round(s * float64(time.Second)))
+}
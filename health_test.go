@@ -0,0 +1,183 @@
+package zh07
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// invalidSensor is a sensor whose payload never passes the checksum, like a
+// ZH07i receiving corrupted frames.
+type invalidSensor struct {
+	scriptedSensor
+}
+
+func (s *invalidSensor) IsReadingValid() bool { return false }
+
+func TestHealthMonitor_Health(t *testing.T) {
+	var (
+		checksumErr = fmt.Errorf("%w: test", ErrChecksumMismatch)
+		commErr     = fmt.Errorf("%w: test", ErrSensorCommunication)
+	)
+
+	tests := []struct {
+		name    string
+		sensor  SensorInterface
+		config  *HealthConfig
+		reads   int
+		every   time.Duration
+		after   time.Duration
+		status  HealthStatus
+		reasons []string
+		checks  func(t *testing.T, h Health)
+	}{
+		{
+			name:   "ok",
+			sensor: &scriptedSensor{readings: []*Reading{same(1), same(2), same(3)}},
+			reads:  3,
+			every:  time.Second,
+			status: HealthOK,
+			checks: func(t *testing.T, h Health) {
+				assert.Equal(t, 3, h.TotalReadings)
+				assert.Equal(t, time.Second, h.FrameInterval)
+				assert.Zero(t, h.FrameJitter)
+				assert.Zero(t, h.LastValidAge)
+			},
+		},
+		{
+			name:    "silence",
+			sensor:  &scriptedSensor{readings: []*Reading{same(1)}},
+			reads:   1,
+			after:   15 * time.Second,
+			status:  HealthDegraded,
+			reasons: []string{"no valid reading for 15s"},
+		},
+		{
+			name:    "never-read",
+			sensor:  &scriptedSensor{},
+			after:   2 * time.Minute,
+			status:  HealthFailed,
+			reasons: []string{"no valid reading for 2m0s"},
+		},
+		{
+			name: "consecutive-errors",
+			sensor: &scriptedSensor{
+				readings: []*Reading{same(1)},
+				errs:     []error{nil, commErr, commErr, commErr},
+			},
+			reads:   4,
+			status:  HealthDegraded,
+			reasons: []string{"3 consecutive errors"},
+		},
+		{
+			name: "failed-errors",
+			sensor: &scriptedSensor{
+				errs: []error{commErr, commErr},
+			},
+			config:  &HealthConfig{FailedAfterErrors: 2},
+			reads:   2,
+			status:  HealthFailed,
+			reasons: []string{"2 consecutive errors"},
+		},
+		{
+			name: "checksum-rate",
+			sensor: &scriptedSensor{
+				readings: []*Reading{same(1), nil, same(2), same(3)},
+				errs:     []error{nil, checksumErr},
+			},
+			config:  &HealthConfig{MaxChecksumFailureRate: 0.2},
+			reads:   4,
+			status:  HealthDegraded,
+			reasons: []string{"checksum failure rate 25%"},
+			checks: func(t *testing.T, h Health) {
+				assert.Equal(t, 1, h.TotalChecksumErrors)
+				assert.Equal(t, 0, h.ConsecutiveErrors)
+			},
+		},
+		{
+			name:    "invalid-payload",
+			sensor:  &invalidSensor{scriptedSensor{readings: []*Reading{same(1), same(2)}}},
+			reads:   2,
+			status:  HealthDegraded,
+			reasons: []string{"checksum failure rate 100%"},
+		},
+		{
+			name:    "constant-output",
+			sensor:  &scriptedSensor{readings: []*Reading{same(7), same(7), same(7)}},
+			config:  &HealthConfig{ConstantCount: 3},
+			reads:   3,
+			status:  HealthDegraded,
+			reasons: []string{"constant output for 3 readings"},
+			checks: func(t *testing.T, h Health) {
+				assert.True(t, h.ConstantOutput)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				config = tt.config
+				clock  = NewFakeClock(epoch)
+			)
+			if config == nil {
+				config = &HealthConfig{}
+			}
+			config.Clock = clock
+			m := NewHealthMonitor(tt.sensor, config)
+
+			assert.NoError(t, m.Init())
+			for i := 0; i < tt.reads; i++ {
+				if i > 0 {
+					clock.Advance(tt.every)
+				}
+				_, _ = m.Read()
+			}
+			clock.Advance(tt.after)
+
+			h := m.Health()
+			assert.Equal(t, tt.status, h.Status)
+			assert.Equal(t, tt.reasons, h.Reasons)
+			if tt.checks != nil {
+				tt.checks(t, h)
+			}
+		})
+	}
+}
+
+func TestHealthMonitor_Jitter(t *testing.T) {
+	var (
+		s     = &scriptedSensor{readings: []*Reading{same(1), same(2), same(3), same(4), same(5)}}
+		clock = NewFakeClock(epoch)
+		m     = NewHealthMonitor(s, &HealthConfig{Clock: clock})
+	)
+
+	for _, d := range []time.Duration{0, 100 * time.Millisecond, 2 * time.Second, 100 * time.Millisecond, 2 * time.Second} {
+		clock.Advance(d)
+		_, _ = m.Read()
+	}
+
+	h := m.Health()
+	assert.Equal(t, HealthDegraded, h.Status)
+	assert.Equal(t, 1050*time.Millisecond, h.FrameInterval)
+	assert.Equal(t, 950*time.Millisecond, h.FrameJitter)
+}
+
+func TestHealthMonitor_InitError(t *testing.T) {
+	var (
+		s = &scriptedSensor{initErr: fmt.Errorf("%w: test", ErrSensorCommunication)}
+		m = NewHealthMonitor(s, nil)
+	)
+
+	assert.ErrorIs(t, m.Init(), ErrSensorCommunication)
+	assert.Equal(t, 1, m.Health().ConsecutiveErrors)
+}
+
+func TestHealthStatus_MarshalText(t *testing.T) {
+	b, err := json.Marshal(Health{Status: HealthDegraded})
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"status":"degraded"`)
+	assert.Equal(t, "HealthStatus(7)", HealthStatus(7).String())
+}
@@ -1,6 +1,62 @@
 package zh07
 
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Sensor defines the common interface for every sensor driver. Optional
+// features are exposed through the capability interfaces Sleeper,
+// ModeSwitcher, Streamer and RawCommander, to be detected with a type
+// assertion:
+//
+//	if s, ok := sensor.(zh07.Sleeper); ok {
+//		err = s.Sleep()
+//	}
+type Sensor interface {
+	// Read returns a sensor reading or an error
+	Read() (*Reading, error)
+	// Info describes the sensor
+	Info() Info
+	// Close releases the sensor
+	Close(ctx context.Context) error
+}
+
+// Sleeper is implemented by sensors with a dormant mode.
+type Sleeper interface {
+	// Sleep turns off the laser and the fan
+	Sleep() error
+	// Wake turns the laser and the fan back on
+	Wake() error
+}
+
+// ModeSwitcher is implemented by sensors whose communication mode can be
+// changed at runtime.
+type ModeSwitcher interface {
+	// Mode returns the current communication mode
+	Mode() Mode
+	// SetMode switches the sensor to the given communication mode
+	SetMode(m Mode) error
+}
+
+// Streamer is implemented by sensors able to deliver readings continuously.
+type Streamer interface {
+	// Stream sends readings until ctx is cancelled or the sensor can no
+	// longer be reached, then closes the channel
+	Stream(ctx context.Context) <-chan Result
+}
+
+// RawCommander is implemented by sensors accepting arbitrary commands.
+type RawCommander interface {
+	// Command sends c as is and returns the n bytes answered, if any
+	Command(c []byte, n int) ([]byte, error)
+}
+
 // SensorInterface defines the common interface for ZH07 sensors.
+//
+// Deprecated: use Sensor, which does not depend on protocol internals.
+// AsSensor turns a SensorInterface into a Sensor.
 type SensorInterface interface {
 	// Init initializes the sensor and sets the communication mode
 	Init() error
@@ -11,3 +67,75 @@ type SensorInterface interface {
 	// Read returns a sensor reading or an error
 	Read() (*Reading, error)
 }
+
+// Mode is a communication mode.
+type Mode int
+
+const (
+	// ModeInitiative is the initiative upload mode, the sensor continuously broadcasts readings
+	ModeInitiative Mode = iota
+	// ModeQA is the question and answer mode, readings are requested on demand
+	ModeQA
+	// ModePWM is the PWM output, only carrying PM2.5
+	ModePWM
+)
+
+// String returns the name of the mode.
+func (m Mode) String() string {
+	switch m {
+	case ModeInitiative:
+		return "initiative"
+	case ModeQA:
+		return "qa"
+	case ModePWM:
+		return "pwm"
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// Info describes a sensor.
+type Info struct {
+	Model        Model
+	Mode         Mode
+	Capabilities Capabilities
+}
+
+// Result is a reading delivered by a Streamer, or the error that prevented it.
+type Result struct {
+	Reading *Reading
+	Err     error
+}
+
+// AsSensor adapts a SensorInterface, such as a v1 driver or a wrapper around
+// one, to Sensor. Info and Close are forwarded when s provides them; otherwise
+// Info reports the ZH07's capabilities and Close does nothing.
+func AsSensor(s SensorInterface) Sensor {
+	if v2, ok := s.(Sensor); ok {
+		return v2
+	}
+	return &legacySensor{s}
+}
+
+// legacySensor adapts a SensorInterface to Sensor.
+type legacySensor struct {
+	SensorInterface
+}
+
+// Info implements Sensor.
+func (l *legacySensor) Info() Info {
+	if i, ok := l.SensorInterface.(interface{ Info() Info }); ok {
+		return i.Info()
+	}
+	return Info{Model: ModelZH07, Capabilities: ModelZH07.Capabilities()}
+}
+
+// Close implements Sensor.
+func (l *legacySensor) Close(ctx context.Context) error {
+	switch c := l.SensorInterface.(type) {
+	case interface{ Close(context.Context) error }:
+		return c.Close(ctx)
+	case io.Closer:
+		return c.Close()
+	}
+	return nil
+}
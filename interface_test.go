@@ -0,0 +1,178 @@
+package zh07
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMode_String(t *testing.T) {
+	assert.Equal(t, "initiative", ModeInitiative.String())
+	assert.Equal(t, "qa", ModeQA.String())
+	assert.Equal(t, "pwm", ModePWM.String())
+	assert.Equal(t, "Mode(7)", Mode(7).String())
+}
+
+func TestSensor_Capabilities(t *testing.T) {
+	var sensors = map[string]Sensor{
+		"ZH07i": NewZH07i(nil),
+		"ZH07q": NewZH07q(nil),
+		"ZH07p": NewZH07p(nil),
+	}
+
+	for name, s := range sensors {
+		t.Run(name, func(t *testing.T) {
+			_, sleeper := s.(Sleeper)
+			_, switcher := s.(ModeSwitcher)
+			_, streamer := s.(Streamer)
+			_, raw := s.(RawCommander)
+
+			serial := name != "ZH07p"
+			assert.Equal(t, serial, sleeper)
+			assert.Equal(t, serial, switcher)
+			assert.True(t, streamer)
+			assert.Equal(t, serial, raw)
+		})
+	}
+
+	assert.Equal(t, Info{Model: ModelZH07, Mode: ModeInitiative, Capabilities: ModelZH07.Capabilities()}, NewZH07i(nil).Info())
+	assert.Equal(t, Info{Model: ModelZH07, Mode: ModeQA, Capabilities: ModelZH07.Capabilities()}, NewZH07q(nil).Info())
+	assert.Equal(t, Info{Model: ModelPMS5003, Mode: ModePWM, Capabilities: ModelPMS5003.Capabilities()}, NewZH07p(&Config{Model: ModelPMS5003}).Info())
+}
+
+func TestZH07i_SetMode(t *testing.T) {
+	var sent [][]byte
+
+	z := NewZH07i(&Config{WarmUp: -1, Clock: NewFakeClock(epoch)})
+	z.write = func(_ *bufio.ReadWriter, c []byte) error {
+		sent = append(sent, c)
+		return nil
+	}
+	z.writeAndRead = func(_ *bufio.ReadWriter, c []byte) ([]byte, error) {
+		sent = append(sent, c)
+		return sampleQAPayload, nil
+	}
+
+	assert.ErrorIs(t, z.SetMode(ModePWM), ErrNotSupported)
+	assert.NoError(t, z.SetMode(ModeQA))
+	assert.Equal(t, ModeQA, z.Mode())
+
+	r, err := z.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, &Reading{PM1: 0x65, PM25: 0x85, PM10: 0x96}, r)
+	assert.True(t, z.IsReadingValid())
+
+	assert.NoError(t, z.Init(), "keeps the mode selected")
+	assert.Equal(t, [][]byte{commandSetQAMode, commandQuery, commandSetQAMode}, sent)
+}
+
+func TestZH07q_SetMode(t *testing.T) {
+	var sent [][]byte
+
+	z := NewZH07q(&Config{
+		RW:     bufio.NewReadWriter(bufio.NewReader(bytes.NewReader(sampleInitiativePayload)), nil),
+		WarmUp: -1,
+		Clock:  NewFakeClock(epoch),
+	})
+	z.write = func(_ *bufio.ReadWriter, c []byte) error {
+		sent = append(sent, c)
+		return nil
+	}
+
+	assert.NoError(t, z.SetMode(ModeInitiative))
+	assert.Equal(t, ModeInitiative, z.Mode())
+	assert.Equal(t, ModeInitiative, z.Info().Mode)
+
+	r, err := z.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, &Reading{PM1: 0x54, PM25: 0x6E, PM10: 0x7C}, r)
+	assert.True(t, z.IsReadingValid())
+	assert.Equal(t, [][]byte{commandSetInitiativeUploadMode}, sent)
+}
+
+func TestZH07i_Command(t *testing.T) {
+	var (
+		b = bytes.NewBuffer(sampleQAPayload)
+		w = &bytes.Buffer{}
+		z = NewZH07i(&Config{RW: bufio.NewReadWriter(bufio.NewReader(b), bufio.NewWriter(w)), PostWriteDelay: -1})
+	)
+
+	got, err := z.Command(commandQuery, 9)
+	assert.NoError(t, err)
+	assert.Equal(t, sampleQAPayload, got)
+	assert.Equal(t, commandQuery, w.Bytes())
+
+	got, err = z.Command(commandDormantEnter, 0)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+
+	_, err = z.Command(commandQuery, 9)
+	assert.ErrorIs(t, err, ErrSensorCommunication)
+}
+
+func TestZH07i_Stream(t *testing.T) {
+	var (
+		data = append(append([]byte{0x00}, sampleInitiativePayload...), sampleInitiativePayload...)
+		z    = NewZH07i(&Config{
+			RW:     bufio.NewReadWriter(bufio.NewReader(bytes.NewReader(data)), nil),
+			WarmUp: -1,
+		})
+		got []Result
+	)
+
+	for r := range z.Stream(context.Background()) {
+		got = append(got, r)
+	}
+
+	assert.Len(t, got, 3)
+	assert.Equal(t, 0x6E, got[0].Reading.PM25)
+	assert.Equal(t, 0x6E, got[1].Reading.PM25)
+	assert.ErrorIs(t, got[2].Err, ErrSensorCommunication, "stops once the port is gone")
+}
+
+func Test_stream(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := &scriptedSensor{
+		readings: []*Reading{same(1), nil, nil, same(2)},
+		errs:     []error{nil, nil, ErrChecksumMismatch, nil},
+	}
+	ch := stream(ctx, func(context.Context) (*Reading, error) { return s.Read() })
+
+	assert.Equal(t, Result{Reading: same(1)}, <-ch)
+	assert.Equal(t, Result{Err: ErrChecksumMismatch}, <-ch, "skips resynchronisation, carries on after a bad reading")
+	assert.Equal(t, Result{Reading: same(2)}, <-ch)
+
+	cancel()
+	for range ch {
+	}
+}
+
+// closerSensor is a v1 sensor holding a resource.
+type closerSensor struct {
+	scriptedSensor
+	closed int
+}
+
+func (c *closerSensor) Close() error { c.closed++; return nil }
+
+func TestAsSensor(t *testing.T) {
+	z := NewZH07q(nil)
+	assert.Same(t, z, AsSensor(z), "v2 sensors are returned as is")
+
+	legacy := &scriptedSensor{readings: []*Reading{same(3)}}
+	s := AsSensor(legacy)
+	r, err := s.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, same(3), r)
+	assert.Equal(t, ModelZH07, s.Info().Model)
+	assert.NoError(t, s.Close(context.Background()))
+
+	c := &closerSensor{}
+	assert.NoError(t, AsSensor(c).Close(context.Background()))
+	assert.Equal(t, 1, c.closed)
+}
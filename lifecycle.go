@@ -0,0 +1,119 @@
+package zh07
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// lifecycle tracks the streams started by a sensor and the transport it owns,
+// so that Close can stop the former and release the latter. It is embedded by
+// every driver.
+type lifecycle struct {
+	mu           sync.Mutex
+	closed       bool
+	done         context.Context // cancelled by Close
+	cancel       context.CancelFunc
+	streams      sync.WaitGroup
+	owned        io.Closer
+	sleepOnClose bool
+}
+
+// manage sets the transport closed by Close, if any, and whether the sensor
+// should be put into dormant mode first.
+func (l *lifecycle) manage(owned io.Closer, sleepOnClose bool) {
+	l.owned, l.sleepOnClose = owned, sleepOnClose
+}
+
+// check returns ErrClosed once the sensor has been closed.
+func (l *lifecycle) check() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// stream runs read in the background like the package-level stream, also
+// stopping when the sensor is closed.
+func (l *lifecycle) stream(ctx context.Context, read func(ctx context.Context) (*Reading, error)) <-chan Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		ch := make(chan Result, 1)
+		ch <- Result{Err: ErrClosed}
+		close(ch)
+		return ch
+	}
+	if l.done == nil {
+		l.done, l.cancel = context.WithCancel(context.Background())
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(l.done, cancel)
+
+	l.streams.Add(1)
+	in := stream(ctx, read)
+	out := make(chan Result)
+	go func() {
+		defer l.streams.Done()
+		defer cancel()
+		defer stop()
+		defer close(out)
+
+		for r := range in {
+			select {
+			case out <- r:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return out
+}
+
+// shutdown marks the sensor as closed and stops its streams. Once they are
+// done it calls release, then closes the owned transport. If ctx expires
+// first, while a stream or a read still uses the transport, release is
+// skipped or abandoned, but the transport is closed anyway to unblock them.
+// release must do nothing once ctx is done.
+func (l *lifecycle) shutdown(ctx context.Context, release func(ctx context.Context) error) error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return ErrClosed
+	}
+	l.closed = true
+	if l.cancel != nil {
+		l.cancel()
+	}
+	l.mu.Unlock()
+
+	released := make(chan error, 1)
+	go func() {
+		l.streams.Wait()
+		if release == nil {
+			released <- nil
+			return
+		}
+		released <- release(ctx)
+	}()
+
+	var errs []error
+	select {
+	case err := <-released:
+		errs = append(errs, err)
+	case <-ctx.Done():
+		errs = append(errs, ctx.Err())
+	}
+
+	if l.owned != nil {
+		errs = append(errs, l.owned.Close())
+	}
+
+	return errors.Join(errs...)
+}
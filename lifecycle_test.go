@@ -0,0 +1,229 @@
+package zh07
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZH07q_Close(t *testing.T) {
+	tests := []struct {
+		name         string
+		sleepOnClose bool
+		want         []byte
+		slept        time.Duration
+	}{
+		{name: "keep-running"},
+		{name: "sleep", sleepOnClose: true, want: commandDormantEnter, slept: defaultPostWriteDelay},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				w     = &bytes.Buffer{}
+				c     = &closeCounter{}
+				clock = NewFakeClock(epoch)
+				z     = NewZH07q(&Config{
+					RW:           bufio.NewReadWriter(bufio.NewReader(&bytes.Buffer{}), bufio.NewWriter(w)),
+					Closer:       c,
+					SleepOnClose: tt.sleepOnClose,
+					Clock:        clock,
+				})
+			)
+
+			assert.NoError(t, z.Close(context.Background()))
+			assert.Equal(t, tt.want, w.Bytes())
+			assert.Equal(t, tt.slept, clock.Slept(), "the dormant command is given time to be executed")
+			assert.Equal(t, 1, c.closed)
+
+			assert.ErrorIs(t, z.Close(context.Background()), ErrClosed)
+			assert.Equal(t, 1, c.closed, "the transport is closed once")
+
+			_, err := z.Read()
+			assert.ErrorIs(t, err, ErrClosed)
+			assert.ErrorIs(t, z.Init(), ErrClosed)
+			assert.ErrorIs(t, z.Sleep(), ErrClosed)
+			assert.ErrorIs(t, z.Wake(), ErrClosed)
+			_, err = z.Command(commandQuery, 9)
+			assert.ErrorIs(t, err, ErrClosed)
+			assert.Equal(t, tt.want, w.Bytes(), "nothing is sent after Close")
+
+			var got []Result
+			for r := range z.Stream(context.Background()) {
+				got = append(got, r)
+			}
+			assert.Equal(t, []Result{{Err: ErrClosed}}, got)
+		})
+	}
+}
+
+func TestZH07i_CloseStopsStream(t *testing.T) {
+	var (
+		pr, pw = io.Pipe()
+		z      = NewZH07i(&Config{
+			RW:     bufio.NewReadWriter(bufio.NewReader(pr), nil),
+			Closer: pr,
+			WarmUp: -1,
+		})
+	)
+
+	// the sensor broadcasts a frame every few milliseconds until the port is closed
+	go func() {
+		for {
+			if _, err := pw.Write(sampleInitiativePayload); err != nil {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+
+	ch := z.Stream(context.Background())
+	r := <-ch
+	assert.NoError(t, r.Err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, z.Close(ctx))
+
+	for range ch {
+	}
+	_, err := pw.Write(sampleInitiativePayload)
+	assert.ErrorIs(t, err, io.ErrClosedPipe, "the port is closed")
+}
+
+// enteredReader signals every call to Read before forwarding it.
+type enteredReader struct {
+	io.Reader
+	entered chan struct{}
+}
+
+func (r *enteredReader) Read(p []byte) (int, error) {
+	select {
+	case r.entered <- struct{}{}:
+	default:
+	}
+	return r.Reader.Read(p)
+}
+
+func TestZH07i_CloseTimeout(t *testing.T) {
+	var (
+		pr, _ = io.Pipe()
+		er    = &enteredReader{Reader: pr, entered: make(chan struct{}, 1)}
+		z     = NewZH07i(&Config{
+			RW:           bufio.NewReadWriter(bufio.NewReader(er), nil),
+			Closer:       pr,
+			SleepOnClose: true,
+		})
+		sent int
+	)
+	z.write = func(_ *bufio.ReadWriter, _ []byte) error {
+		sent++
+		return nil
+	}
+
+	// nothing is ever received, the stream stays blocked in Read
+	ch := z.Stream(context.Background())
+	<-er.entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, z.Close(ctx), context.DeadlineExceeded)
+	assert.Zero(t, sent, "the port is still in use, the dormant command is skipped")
+
+	// closing the port unblocked the stream
+	for range ch {
+	}
+}
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return bytes.Clone(b.buf.Bytes())
+}
+
+func TestZH07i_CloseWaitsForRead(t *testing.T) {
+	var (
+		pr, pw = io.Pipe()
+		er     = &enteredReader{Reader: pr, entered: make(chan struct{}, 1)}
+		w      = &lockedBuffer{}
+		z      = NewZH07i(&Config{
+			RW:             bufio.NewReadWriter(bufio.NewReader(er), bufio.NewWriter(w)),
+			SleepOnClose:   true,
+			WarmUp:         -1,
+			PostWriteDelay: -1,
+		})
+		read   = make(chan error, 1)
+		closed = make(chan error, 1)
+	)
+
+	go func() {
+		_, err := z.Read()
+		read <- err
+	}()
+	<-er.entered
+
+	go func() { closed <- z.Close(context.Background()) }()
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, w.Bytes(), "the dormant command waits for the read in progress")
+
+	_, err := pw.Write(sampleInitiativePayload)
+	assert.NoError(t, err)
+	assert.NoError(t, <-read)
+	assert.NoError(t, <-closed)
+	assert.Equal(t, commandDormantEnter, w.Bytes())
+}
+
+func TestZH07i_CloseTimeoutDuringRead(t *testing.T) {
+	var (
+		pr, _ = io.Pipe()
+		er    = &enteredReader{Reader: pr, entered: make(chan struct{}, 1)}
+		z     = NewZH07i(&Config{
+			RW:           bufio.NewReadWriter(bufio.NewReader(er), nil),
+			Closer:       pr,
+			SleepOnClose: true,
+		})
+		read = make(chan error, 1)
+	)
+
+	// nothing is ever received, the read holds the port until it is closed
+	go func() {
+		_, err := z.Read()
+		read <- err
+	}()
+	<-er.entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, z.Close(ctx), context.DeadlineExceeded)
+	assert.ErrorIs(t, <-read, ErrSensorCommunication, "closing the port unblocked the read")
+}
+
+func TestZH07p_Close(t *testing.T) {
+	c := &closeCounter{}
+	z := NewZH07p(&Config{PWM: pwmPeriods(0, pwmPeriod, 102*time.Millisecond), Closer: c})
+
+	assert.NoError(t, z.Close(context.Background()))
+	assert.Equal(t, 1, c.closed)
+	assert.ErrorIs(t, z.Init(), ErrClosed)
+	_, err := z.Read()
+	assert.ErrorIs(t, err, ErrClosed)
+}
@@ -0,0 +1,242 @@
+package zh07
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+const (
+	defaultManagerTrimFraction      = 0.2
+	defaultManagerTolerance         = 10
+	defaultManagerRelativeTolerance = 0.25
+	defaultManagerMaxSkips          = 64
+)
+
+// ConsensusMethod selects how the readings of several sensors are combined.
+type ConsensusMethod int
+
+const (
+	// ConsensusMedian takes the median of every channel
+	ConsensusMedian ConsensusMethod = iota
+	// ConsensusTrimmedMean takes the mean of every channel after discarding
+	// the highest and lowest values
+	ConsensusTrimmedMean
+)
+
+// ManagerConfig holds configuration options for a Manager.
+type ManagerConfig struct {
+	// Method is how readings are combined, the median by default
+	Method ConsensusMethod
+	// TrimFraction is the fraction of values discarded from each end before
+	// taking the trimmed mean, 0.2 if zero
+	TrimFraction float64
+	// Tolerance is the absolute deviation from the consensus a sensor may have
+	// on any channel before it is considered to drift [μg/m³], 10 if zero
+	Tolerance float64
+	// RelativeTolerance is the deviation, as a fraction of the consensus, a
+	// sensor may have before it is considered to drift, 0.25 if zero. The
+	// larger of both tolerances applies.
+	RelativeTolerance float64
+	// MinSensors is the number of sensors that must produce a reading for a
+	// consensus to be reached, 1 if zero
+	MinSensors int
+	// MaxSkips bounds how many frames skipped while resynchronising are
+	// tolerated per sensor on every Read, 64 if zero
+	MaxSkips int
+}
+
+// SensorResult is the outcome of reading one of the sensors owned by a Manager.
+type SensorResult struct {
+	Name      string
+	Reading   *Reading
+	Err       error
+	Deviation float64 // largest deviation from the consensus over all channels [μg/m³]
+	Drifting  bool    // the deviation exceeds the tolerance
+}
+
+// Consensus is the combined reading of the sensors owned by a Manager.
+type Consensus struct {
+	Reading  *Reading       // combined reading
+	Sensors  []SensorResult // one per sensor, in the order they were added
+	Drifting []string       // names of the sensors that drift from the group
+	Failed   []string       // names of the sensors that could not be read
+}
+
+// Manager owns several redundant sensors, reads them concurrently and combines
+// their readings. A failing sensor is left out of the consensus, so output is
+// produced as long as at least MinSensors are working.
+type Manager struct {
+	config ManagerConfig
+
+	mu      sync.Mutex
+	names   []string
+	sensors []SensorInterface
+}
+
+// NewManager creates a new Manager with no sensors.
+func NewManager(config *ManagerConfig) *Manager {
+	if config == nil {
+		config = &ManagerConfig{}
+	}
+
+	if config.TrimFraction <= 0 || config.TrimFraction >= 0.5 {
+		config.TrimFraction = defaultManagerTrimFraction
+	}
+
+	if config.Tolerance <= 0 {
+		config.Tolerance = defaultManagerTolerance
+	}
+
+	if config.RelativeTolerance <= 0 {
+		config.RelativeTolerance = defaultManagerRelativeTolerance
+	}
+
+	if config.MinSensors <= 0 {
+		config.MinSensors = 1
+	}
+
+	if config.MaxSkips <= 0 {
+		config.MaxSkips = defaultManagerMaxSkips
+	}
+
+	return &Manager{config: *config}
+}
+
+// Add adds a sensor to the manager under the given name.
+func (m *Manager) Add(name string, sensor SensorInterface) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.names = append(m.names, name)
+	m.sensors = append(m.sensors, sensor)
+}
+
+// Init initializes every sensor concurrently. The error, if any, joins the
+// errors of the sensors that failed, each prefixed with its name.
+func (m *Manager) Init() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	errs := make([]error, len(m.sensors))
+	m.each(func(i int, s SensorInterface) {
+		if err := s.Init(); err != nil {
+			errs[i] = fmt.Errorf("%s: %w", m.names[i], err)
+		}
+	})
+
+	return errors.Join(errs...)
+}
+
+// Read reads every sensor concurrently and combines their readings. The
+// consensus is returned along with per-sensor results even when some of them
+// failed; an error wrapping ErrNoSamples is returned when fewer than
+// MinSensors produced a reading.
+func (m *Manager) Read() (*Consensus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c := &Consensus{Sensors: make([]SensorResult, len(m.sensors))}
+	m.each(func(i int, s SensorInterface) {
+		c.Sensors[i] = SensorResult{Name: m.names[i]}
+		c.Sensors[i].Reading, c.Sensors[i].Err = m.read(s)
+	})
+
+	var (
+		values [3][]float64
+		errs   []error
+	)
+	for _, r := range c.Sensors {
+		if r.Err != nil {
+			c.Failed = append(c.Failed, r.Name)
+			errs = append(errs, fmt.Errorf("%s: %w", r.Name, r.Err))
+			continue
+		}
+
+		for i, ch := range pmChannels {
+			values[i] = append(values[i], float64(*ch.value(r.Reading)))
+		}
+	}
+
+	if len(values[0]) < m.config.MinSensors {
+		return c, errors.Join(append([]error{fmt.Errorf("%w: %d of %d sensors answered", ErrNoSamples, len(values[0]), m.config.MinSensors)}, errs...)...)
+	}
+
+	var consensus [3]float64
+	c.Reading = &Reading{}
+	for i, ch := range pmChannels {
+		consensus[i] = m.combine(values[i])
+		*ch.value(c.Reading) = int(math.Round(consensus[i]))
+	}
+
+	for i := range c.Sensors {
+		r := &c.Sensors[i]
+		if r.Err != nil {
+			continue
+		}
+
+		for j, ch := range pmChannels {
+			var (
+				d     = math.Abs(float64(*ch.value(r.Reading)) - consensus[j])
+				limit = math.Max(m.config.Tolerance, m.config.RelativeTolerance*consensus[j])
+			)
+
+			r.Deviation = math.Max(r.Deviation, d)
+			if d > limit {
+				r.Drifting = true
+			}
+		}
+
+		if r.Drifting {
+			c.Drifting = append(c.Drifting, r.Name)
+		}
+	}
+
+	return c, nil
+}
+
+// each runs fn for every sensor concurrently and waits for all of them.
+func (m *Manager) each(fn func(i int, s SensorInterface)) {
+	var wg sync.WaitGroup
+	for i, s := range m.sensors {
+		wg.Add(1)
+		go func(i int, s SensorInterface) {
+			defer wg.Done()
+			fn(i, s)
+		}(i, s)
+	}
+	wg.Wait()
+}
+
+// read reads s until it returns a reading, skipping frames that were discarded
+// while resynchronising.
+func (m *Manager) read(s SensorInterface) (*Reading, error) {
+	for i := 0; i < m.config.MaxSkips; i++ {
+		r, err := s.Read()
+		if err != nil || r != nil {
+			return r, err
+		}
+	}
+
+	return nil, fmt.Errorf("%w: no frame after %d attempts", ErrInvalidFrame, m.config.MaxSkips)
+}
+
+// combine reduces the values of one channel according to the configured method.
+func (m *Manager) combine(values []float64) float64 {
+	sort.Float64s(values)
+
+	if m.config.Method == ConsensusTrimmedMean {
+		trim := int(float64(len(values)) * m.config.TrimFraction)
+		values = values[trim : len(values)-trim]
+
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		return sum / float64(len(values))
+	}
+
+	return percentile(values, 50)
+}
@@ -0,0 +1,127 @@
+package zh07
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManager_Read(t *testing.T) {
+	commErr := fmt.Errorf("%w: test", ErrSensorCommunication)
+
+	tests := []struct {
+		name     string
+		config   *ManagerConfig
+		sensors  map[string]*scriptedSensor
+		want     *Reading
+		drifting []string
+		failed   []string
+		errIs    error
+	}{
+		{
+			name: "median",
+			sensors: map[string]*scriptedSensor{
+				"a": {readings: []*Reading{same(10)}},
+				"b": {readings: []*Reading{same(12)}},
+				"c": {readings: []*Reading{same(11)}},
+			},
+			want: same(11),
+		},
+		{
+			name:   "trimmed-mean",
+			config: &ManagerConfig{Method: ConsensusTrimmedMean, TrimFraction: 0.25},
+			sensors: map[string]*scriptedSensor{
+				"a": {readings: []*Reading{same(10)}},
+				"b": {readings: []*Reading{same(12)}},
+				"c": {readings: []*Reading{same(14)}},
+				"d": {readings: []*Reading{same(500)}},
+			},
+			want:     same(13),
+			drifting: []string{"d"},
+		},
+		{
+			name: "drift",
+			sensors: map[string]*scriptedSensor{
+				"a": {readings: []*Reading{same(100)}},
+				"b": {readings: []*Reading{same(104)}},
+				"c": {readings: []*Reading{{PM1: 100, PM25: 60, PM10: 100}}},
+			},
+			want:     &Reading{PM1: 100, PM25: 100, PM10: 100},
+			drifting: []string{"c"},
+		},
+		{
+			name: "one-failing",
+			sensors: map[string]*scriptedSensor{
+				"a": {readings: []*Reading{same(10)}},
+				"b": {errs: []error{commErr}},
+				"c": {readings: []*Reading{nil, nil, same(20)}},
+			},
+			want:   same(15),
+			failed: []string{"b"},
+		},
+		{
+			name:   "not-enough",
+			config: &ManagerConfig{MinSensors: 2, MaxSkips: 2},
+			sensors: map[string]*scriptedSensor{
+				"a": {readings: []*Reading{same(10)}},
+				"b": {errs: []error{commErr}},
+				"c": {readings: []*Reading{nil, nil, same(20)}},
+			},
+			failed: []string{"b", "c"},
+			errIs:  ErrNoSamples,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager(tt.config)
+			for _, name := range []string{"a", "b", "c", "d"} {
+				if s, ok := tt.sensors[name]; ok {
+					m.Add(name, s)
+				}
+			}
+
+			c, err := m.Read()
+			if tt.errIs != nil {
+				assert.ErrorIs(t, err, tt.errIs)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, c.Reading)
+			assert.Equal(t, tt.drifting, c.Drifting)
+			assert.Equal(t, tt.failed, c.Failed)
+			assert.Len(t, c.Sensors, len(tt.sensors))
+		})
+	}
+}
+
+func TestManager_ReadErrors(t *testing.T) {
+	var (
+		m       = NewManager(&ManagerConfig{MinSensors: 2})
+		commErr = fmt.Errorf("%w: test", ErrSensorCommunication)
+	)
+	m.Add("left", &scriptedSensor{errs: []error{commErr}})
+	m.Add("right", &scriptedSensor{readings: []*Reading{same(1)}})
+
+	c, err := m.Read()
+	assert.ErrorIs(t, err, ErrSensorCommunication)
+	assert.Contains(t, err.Error(), "left: sensor communication failed")
+	assert.Nil(t, c.Reading)
+	assert.Equal(t, same(1), c.Sensors[1].Reading)
+}
+
+func TestManager_Init(t *testing.T) {
+	var (
+		m = NewManager(nil)
+		a = &scriptedSensor{}
+		b = &scriptedSensor{initErr: fmt.Errorf("%w: test", ErrSensorCommunication)}
+	)
+	m.Add("a", a)
+	m.Add("b", b)
+
+	err := m.Init()
+	assert.ErrorIs(t, err, ErrSensorCommunication)
+	assert.Contains(t, err.Error(), "b: ")
+	assert.Equal(t, 1, a.inits)
+	assert.Equal(t, 1, b.inits)
+}
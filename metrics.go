@@ -0,0 +1,383 @@
+package zh07
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Names of the commands reported to Metrics.Command.
+const (
+	CommandQuery = "query" // query in question and answer mode
+	CommandMode  = "mode"  // mode switch
+	CommandSleep = "sleep" // entering dormant mode
+	CommandWake  = "wake"  // leaving dormant mode
+	CommandRaw   = "raw"   // command sent with RawCommander.Command
+)
+
+// defaultLatencyBuckets are the upper bounds of the command latency histogram
+// of ExpvarMetrics, around the 250ms post-write delay.
+var defaultLatencyBuckets = []time.Duration{
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	300 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+}
+
+// Metrics receives measurements from inside ZH07i and ZH07q, see
+// Config.Metrics. The methods are called with the exchange with the sensor
+// under way and should not block.
+type Metrics interface {
+	// Frame is called for every frame or answer received in mode m, valid
+	// telling whether its checksum matched
+	Frame(m Mode, valid bool)
+	// Resync is called when a frame is found after discarding bytes that did
+	// not start one
+	Resync(discarded int)
+	// Command is called once a command was sent, and its answer received if
+	// any, with the round trip time, the post-write delay included
+	Command(name string, rtt time.Duration, err error)
+	// Reading is called with the time a reading with a valid checksum was
+	// returned
+	Reading(t time.Time)
+}
+
+// instruments reports to a Metrics, doing nothing when there is none so that
+// a driver without Config.Metrics only pays for a nil check. It is used with
+// the port lock held.
+type instruments struct {
+	metrics Metrics
+	clock   Clock
+	skipped int // bytes discarded since the last frame
+}
+
+// start returns the time a command is sent, zero without metrics.
+func (i *instruments) start() time.Time {
+	if i.metrics == nil {
+		return time.Time{}
+	}
+	return i.clock.Now()
+}
+
+// command reports the command name sent at start.
+func (i *instruments) command(name string, start time.Time, err error) {
+	if i.metrics == nil {
+		return
+	}
+	i.metrics.Command(name, i.clock.Now().Sub(start), err)
+}
+
+// skip records n bytes discarded while looking for a frame.
+func (i *instruments) skip(n int) {
+	if i.metrics == nil {
+		return
+	}
+	i.skipped += n
+}
+
+// frame reports a frame or an answer received in mode m.
+func (i *instruments) frame(m Mode, valid bool) {
+	if i.metrics == nil {
+		return
+	}
+	if i.skipped > 0 {
+		i.metrics.Resync(i.skipped)
+		i.skipped = 0
+	}
+	i.metrics.Frame(m, valid)
+	if valid {
+		i.metrics.Reading(i.clock.Now())
+	}
+}
+
+// ExpvarConfig holds configuration options for an ExpvarMetrics.
+type ExpvarConfig struct {
+	// Name is the name the metrics are published under, "zh07" if empty. It
+	// must be unique within the process.
+	Name string
+	// Buckets are the upper bounds of the command latency histogram, from
+	// 10ms to 2.5s if empty
+	Buckets []time.Duration
+	// Clock is used for the time since the last valid reading, SystemClock
+	// if nil
+	Clock Clock
+}
+
+// ExpvarMetrics implements Metrics with expvar variables, served as JSON on
+// /debug/vars by the expvar package. It publishes a map holding:
+//
+//   - frames and checksum_errors, per mode
+//   - resyncs and discarded_bytes
+//   - commands and command_errors, per command
+//   - command_latency, a histogram of the round trip times in seconds
+//   - last_reading, the time of the last valid reading, and
+//     seconds_since_reading
+//
+// Several sensors can share an ExpvarMetrics, or publish under distinct names.
+type ExpvarMetrics struct {
+	vars           *expvar.Map
+	frames         *expvar.Map
+	checksumErrors *expvar.Map
+	resyncs        *expvar.Int
+	discarded      *expvar.Int
+	commands       *expvar.Map
+	commandErrors  *expvar.Map
+	latency        *histogram
+	clock          Clock
+
+	mu   sync.Mutex
+	last time.Time // time of the last valid reading
+}
+
+// NewExpvarMetrics creates a new ExpvarMetrics and publishes its variables.
+// Like expvar.Publish, it panics if the name is already in use.
+func NewExpvarMetrics(config *ExpvarConfig) *ExpvarMetrics {
+	if config == nil {
+		config = &ExpvarConfig{}
+	}
+
+	if config.Name == "" {
+		config.Name = "zh07"
+	}
+
+	if len(config.Buckets) == 0 {
+		config.Buckets = defaultLatencyBuckets
+	}
+
+	if config.Clock == nil {
+		config.Clock = SystemClock
+	}
+
+	m := &ExpvarMetrics{
+		vars:           new(expvar.Map),
+		frames:         new(expvar.Map),
+		checksumErrors: new(expvar.Map),
+		resyncs:        new(expvar.Int),
+		discarded:      new(expvar.Int),
+		commands:       new(expvar.Map),
+		commandErrors:  new(expvar.Map),
+		latency:        newHistogram(config.Buckets),
+		clock:          config.Clock,
+	}
+	m.vars.Set("frames", m.frames)
+	m.vars.Set("checksum_errors", m.checksumErrors)
+	m.vars.Set("resyncs", m.resyncs)
+	m.vars.Set("discarded_bytes", m.discarded)
+	m.vars.Set("commands", m.commands)
+	m.vars.Set("command_errors", m.commandErrors)
+	m.vars.Set("command_latency", m.latency)
+	m.vars.Set("last_reading", expvar.Func(func() any { return m.lastReading() }))
+	m.vars.Set("seconds_since_reading", expvar.Func(func() any { return m.sinceReading().Seconds() }))
+	expvar.Publish(config.Name, m.vars)
+
+	return m
+}
+
+// Frame counts the frame, and the checksum error if it is not valid.
+func (m *ExpvarMetrics) Frame(mode Mode, valid bool) {
+	m.frames.Add(mode.String(), 1)
+	if !valid {
+		m.checksumErrors.Add(mode.String(), 1)
+	}
+}
+
+// Resync counts the resynchronisation and the bytes discarded.
+func (m *ExpvarMetrics) Resync(discarded int) {
+	m.resyncs.Add(1)
+	m.discarded.Add(int64(discarded))
+}
+
+// Command counts the command, and the error if it failed, and records its
+// round trip time.
+func (m *ExpvarMetrics) Command(name string, rtt time.Duration, err error) {
+	m.commands.Add(name, 1)
+	if err != nil {
+		m.commandErrors.Add(name, 1)
+	}
+	m.latency.observe(rtt)
+}
+
+// Reading records the time of the last valid reading.
+func (m *ExpvarMetrics) Reading(t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.last = t
+}
+
+// Vars returns the published map.
+func (m *ExpvarMetrics) Vars() *expvar.Map {
+	return m.vars
+}
+
+// lastReading returns the time of the last valid reading, empty if there was
+// none.
+func (m *ExpvarMetrics) lastReading() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.last.IsZero() {
+		return ""
+	}
+	return m.last.Format(time.RFC3339Nano)
+}
+
+// sinceReading returns the time since the last valid reading, zero if there
+// was none.
+func (m *ExpvarMetrics) sinceReading() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.last.IsZero() {
+		return 0
+	}
+	return m.clock.Now().Sub(m.last)
+}
+
+// histogram counts durations into buckets, cumulatively like Prometheus. It
+// implements expvar.Var.
+type histogram struct {
+	bounds []time.Duration
+
+	mu     sync.Mutex
+	counts []int64 // counts[i] durations up to bounds[i], the last one counts all
+	sum    time.Duration
+}
+
+// newHistogram creates a histogram with the upper bounds bounds, sorted.
+func newHistogram(bounds []time.Duration) *histogram {
+	return &histogram{bounds: bounds, counts: make([]int64, len(bounds)+1)}
+}
+
+// observe counts d.
+func (h *histogram) observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, b := range h.bounds {
+		if d <= b {
+			h.counts[i]++
+		}
+	}
+	h.counts[len(h.bounds)]++
+	h.sum += d
+}
+
+// String returns the histogram as JSON, with the bounds in seconds.
+func (h *histogram) String() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	buckets := make(map[string]int64, len(h.counts))
+	for i, b := range h.bounds {
+		buckets[strconv.FormatFloat(b.Seconds(), 'g', -1, 64)] = h.counts[i]
+	}
+	buckets["+Inf"] = h.counts[len(h.bounds)]
+
+	j, err := json.Marshal(struct {
+		Buckets map[string]int64 `json:"buckets"`
+		Count   int64            `json:"count"`
+		Sum     float64          `json:"sum"`
+	}{buckets, h.counts[len(h.bounds)], h.sum.Seconds()})
+	if err != nil {
+		return fmt.Sprintf("%q", err.Error())
+	}
+	return string(j)
+}
+
+// Counter is the part of a Prometheus counter used by PrometheusMetrics.
+// prometheus.Counter implements it.
+type Counter interface {
+	Add(float64)
+}
+
+// Observer is the part of a Prometheus histogram or summary used by
+// PrometheusMetrics. prometheus.Histogram and prometheus.Observer implement it.
+type Observer interface {
+	Observe(float64)
+}
+
+// Gauge is the part of a Prometheus gauge used by PrometheusMetrics.
+// prometheus.Gauge implements it.
+type Gauge interface {
+	Set(float64)
+}
+
+// PrometheusMetrics implements Metrics with Prometheus client metrics, without
+// this package depending on the client: the fields take prometheus.Counter,
+// prometheus.Histogram and prometheus.Gauge, created and registered by the
+// caller, or the children of vectors got with WithLabelValues. Nil fields are
+// skipped.
+type PrometheusMetrics struct {
+	Frames                   Counter // frames read in initiative upload mode
+	Answers                  Counter // answers read in question and answer mode
+	ChecksumErrorsInitiative Counter // frames with a bad checksum
+	ChecksumErrorsQA         Counter // answers with a bad checksum
+	Resyncs                  Counter // resynchronisations
+	DiscardedBytes           Counter // bytes discarded while resynchronising
+	CommandErrors            Counter // failed commands
+	CommandLatency           Observer
+	// CommandLatencies, if set, returns the observer of the round trip
+	// times of command name, such as a child of a HistogramVec, instead of
+	// CommandLatency
+	CommandLatencies func(name string) Observer
+	// LastReading is set to the Unix time of the last valid reading, in
+	// seconds, so that time() - LastReading is the time since
+	LastReading Gauge
+}
+
+// Frame counts the frame or the answer, and the checksum error if it is not
+// valid.
+func (m *PrometheusMetrics) Frame(mode Mode, valid bool) {
+	total, errs := m.Frames, m.ChecksumErrorsInitiative
+	if mode == ModeQA {
+		total, errs = m.Answers, m.ChecksumErrorsQA
+	}
+	add(total, 1)
+	if !valid {
+		add(errs, 1)
+	}
+}
+
+// Resync counts the resynchronisation and the bytes discarded.
+func (m *PrometheusMetrics) Resync(discarded int) {
+	add(m.Resyncs, 1)
+	add(m.DiscardedBytes, float64(discarded))
+}
+
+// Command records the round trip time of the command, in seconds, and counts
+// the error if it failed.
+func (m *PrometheusMetrics) Command(name string, rtt time.Duration, err error) {
+	if err != nil {
+		add(m.CommandErrors, 1)
+	}
+
+	o := m.CommandLatency
+	if m.CommandLatencies != nil {
+		o = m.CommandLatencies(name)
+	}
+	if o != nil {
+		o.Observe(rtt.Seconds())
+	}
+}
+
+// Reading sets LastReading to t.
+func (m *PrometheusMetrics) Reading(t time.Time) {
+	if m.LastReading != nil {
+		m.LastReading.Set(float64(t.UnixNano()) / 1e9)
+	}
+}
+
+// add adds v to c, unless it is nil.
+func add(c Counter, v float64) {
+	if c != nil {
+		c.Add(v)
+	}
+}
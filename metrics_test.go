@@ -0,0 +1,248 @@
+package zh07
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingMetrics records the calls as text.
+type recordingMetrics struct {
+	calls []string
+}
+
+func (m *recordingMetrics) Frame(mode Mode, valid bool) {
+	m.calls = append(m.calls, fmt.Sprintf("frame %v %v", mode, valid))
+}
+
+func (m *recordingMetrics) Resync(discarded int) {
+	m.calls = append(m.calls, fmt.Sprintf("resync %d", discarded))
+}
+
+func (m *recordingMetrics) Command(name string, rtt time.Duration, err error) {
+	m.calls = append(m.calls, fmt.Sprintf("command %s %v %v", name, rtt, err))
+}
+
+func (m *recordingMetrics) Reading(t time.Time) {
+	m.calls = append(m.calls, "reading "+t.Format("15:04:05.000"))
+}
+
+func TestZH07q_Metrics(t *testing.T) {
+	var (
+		clock   = NewFakeClock(epoch)
+		metrics = &recordingMetrics{}
+		port    = &responder{command: commandQuery, response: sampleQAPayload}
+		z       = NewZH07q(&Config{
+			RW:      bufio.NewReadWriter(bufio.NewReader(port), bufio.NewWriter(port)),
+			Clock:   clock,
+			WarmUp:  -1,
+			Metrics: metrics,
+		})
+	)
+
+	assert.NoError(t, z.Init())
+	_, err := z.Read()
+	assert.NoError(t, err)
+	port.response = sampleQABadChecksum
+	_, err = z.Read()
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	port.response = nil
+	_, err = z.Read()
+	assert.ErrorIs(t, err, ErrSensorCommunication)
+
+	assert.Equal(t, []string{
+		"command mode 250ms <nil>",
+		"command query 250ms <nil>",
+		"frame qa true",
+		"reading 10:00:00.500",
+		"command query 250ms <nil>",
+		"frame qa false",
+		"command query 250ms sensor communication failed: EOF",
+	}, metrics.calls)
+}
+
+func TestZH07i_Metrics(t *testing.T) {
+	var (
+		clock   = NewFakeClock(epoch)
+		metrics = &recordingMetrics{}
+		line    bytes.Buffer
+	)
+	line.Write([]byte{0x00, 0x42, 0x4D, 0x00, 0x00}) // the tail of a frame, then a bad length
+	line.Write(sampleInitiativePayload)
+	line.Write(sampleInitiativeBadChecksum)
+
+	z := NewZH07i(&Config{
+		RW:             bufio.NewReadWriter(bufio.NewReader(&line), bufio.NewWriter(&bytes.Buffer{})),
+		Clock:          clock,
+		WarmUp:         -1,
+		PostWriteDelay: -1,
+		Metrics:        metrics,
+	})
+
+	for {
+		r, err := z.Read()
+		assert.NoError(t, err)
+		if r != nil {
+			break
+		}
+	}
+	clock.Advance(time.Second)
+	_, err := z.Read()
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	assert.NoError(t, z.Sleep())
+
+	assert.Equal(t, []string{
+		"resync 5",
+		"frame initiative true",
+		"reading 10:00:00.000",
+		"frame initiative false",
+		"command sleep 0s <nil>",
+	}, metrics.calls)
+}
+
+func TestInstruments_disabled(t *testing.T) {
+	i := instruments{clock: NewFakeClock(epoch)}
+
+	assert.Zero(t, i.start())
+	i.skip(3)
+	i.frame(ModeInitiative, true)
+	i.command(CommandRaw, time.Time{}, nil)
+	assert.Zero(t, i.skipped)
+}
+
+func TestExpvarMetrics(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	m := NewExpvarMetrics(&ExpvarConfig{
+		Name:    fmt.Sprintf("zh07_test_%d", time.Now().UnixNano()), // unique, with -count too
+		Buckets: []time.Duration{100 * time.Millisecond, 500 * time.Millisecond},
+		Clock:   clock,
+	})
+
+	assert.Equal(t, `""`, m.Vars().Get("last_reading").String())
+	assert.Equal(t, "0", m.Vars().Get("seconds_since_reading").String())
+
+	m.Frame(ModeInitiative, true)
+	m.Frame(ModeInitiative, false)
+	m.Frame(ModeQA, true)
+	m.Resync(5)
+	m.Resync(3)
+	m.Command(CommandQuery, 250*time.Millisecond, nil)
+	m.Command(CommandQuery, 50*time.Millisecond, errors.New("test"))
+	m.Command(CommandMode, time.Second, nil)
+	m.Reading(epoch)
+	clock.Advance(3 * time.Second)
+
+	var vars struct {
+		Frames         map[string]int `json:"frames"`
+		ChecksumErrors map[string]int `json:"checksum_errors"`
+		Resyncs        int            `json:"resyncs"`
+		Discarded      int            `json:"discarded_bytes"`
+		Commands       map[string]int `json:"commands"`
+		CommandErrors  map[string]int `json:"command_errors"`
+		Latency        struct {
+			Buckets map[string]int `json:"buckets"`
+			Count   int            `json:"count"`
+			Sum     float64        `json:"sum"`
+		} `json:"command_latency"`
+		LastReading  time.Time `json:"last_reading"`
+		SinceReading float64   `json:"seconds_since_reading"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(m.Vars().String()), &vars))
+
+	assert.Equal(t, map[string]int{"initiative": 2, "qa": 1}, vars.Frames)
+	assert.Equal(t, map[string]int{"initiative": 1}, vars.ChecksumErrors)
+	assert.Equal(t, 2, vars.Resyncs)
+	assert.Equal(t, 8, vars.Discarded)
+	assert.Equal(t, map[string]int{"query": 2, "mode": 1}, vars.Commands)
+	assert.Equal(t, map[string]int{"query": 1}, vars.CommandErrors)
+	assert.Equal(t, map[string]int{"0.1": 1, "0.5": 2, "+Inf": 3}, vars.Latency.Buckets)
+	assert.Equal(t, 3, vars.Latency.Count)
+	assert.InDelta(t, 1.3, vars.Latency.Sum, 1e-9)
+	assert.True(t, epoch.Equal(vars.LastReading))
+	assert.Equal(t, 3.0, vars.SinceReading)
+}
+
+// promValue is a fake Prometheus metric.
+type promValue struct {
+	values []float64
+}
+
+func (v *promValue) Add(f float64)     { v.values = append(v.values, f) }
+func (v *promValue) Observe(f float64) { v.values = append(v.values, f) }
+func (v *promValue) Set(f float64)     { v.values = append(v.values, f) }
+
+func TestPrometheusMetrics(t *testing.T) {
+	var (
+		frames, answers, errsI, errsQA = &promValue{}, &promValue{}, &promValue{}, &promValue{}
+		resyncs, discarded, cmdErrs    = &promValue{}, &promValue{}, &promValue{}
+		latency, last                  = &promValue{}, &promValue{}
+		m                              = &PrometheusMetrics{
+			Frames:                   frames,
+			Answers:                  answers,
+			ChecksumErrorsInitiative: errsI,
+			ChecksumErrorsQA:         errsQA,
+			Resyncs:                  resyncs,
+			DiscardedBytes:           discarded,
+			CommandErrors:            cmdErrs,
+			CommandLatency:           latency,
+			LastReading:              last,
+		}
+	)
+
+	m.Frame(ModeInitiative, true)
+	m.Frame(ModeInitiative, false)
+	m.Frame(ModeQA, false)
+	m.Resync(5)
+	m.Command(CommandQuery, 250*time.Millisecond, nil)
+	m.Command(CommandQuery, time.Second, errors.New("test"))
+	m.Reading(epoch.Add(500 * time.Millisecond))
+
+	assert.Equal(t, []float64{1, 1}, frames.values)
+	assert.Equal(t, []float64{1}, answers.values)
+	assert.Equal(t, []float64{1}, errsI.values)
+	assert.Equal(t, []float64{1}, errsQA.values)
+	assert.Equal(t, []float64{1}, resyncs.values)
+	assert.Equal(t, []float64{5}, discarded.values)
+	assert.Equal(t, []float64{1}, cmdErrs.values)
+	assert.Equal(t, []float64{0.25, 1}, latency.values)
+	assert.Equal(t, []float64{float64(epoch.Unix()) + 0.5}, last.values)
+
+	var names []string
+	m.CommandLatencies = func(name string) Observer {
+		names = append(names, name)
+		return latency
+	}
+	m.Command(CommandMode, time.Second, nil)
+	assert.Equal(t, []string{CommandMode}, names)
+	assert.Len(t, latency.values, 3)
+
+	assert.NotPanics(t, func() {
+		var empty PrometheusMetrics
+		empty.Frame(ModeQA, false)
+		empty.Resync(1)
+		empty.Command(CommandRaw, time.Second, errors.New("test"))
+		empty.Reading(epoch)
+	})
+}
+
+func TestZH07q_ReadInto_metrics(t *testing.T) {
+	config := newLoopConfig(sampleQAPayload)
+	config.Metrics = &PrometheusMetrics{Answers: &promValue{values: make([]float64, 0, 1000)}}
+	var (
+		z = NewZH07q(config)
+		r Reading
+	)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if ok, err := z.ReadInto(&r); !ok || err != nil {
+			t.Fatal(ok, err)
+		}
+	})
+	assert.Zero(t, allocs)
+}
@@ -0,0 +1,381 @@
+package zh07
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Model identifies a sensor model. Models sharing the 0x42 0x4d initiative
+// upload frame are driven by the same code through a profile that describes
+// their frame layout and command set.
+type Model int
+
+const (
+	// ModelZH07 is the Winsen ZH07, the default
+	ModelZH07 Model = iota
+	// ModelZH03B is the Winsen ZH03B, which sends a shorter 24-byte frame
+	ModelZH03B
+	// ModelPMS5003 is the Plantower PMS5003, which also reports particle counts
+	ModelPMS5003
+	// ModelPMS7003 is the Plantower PMS7003, which also reports particle counts
+	ModelPMS7003
+	// ModelZH06 is the Winsen ZH06. Its datasheet, docs/ZH06.pdf, gives the
+	// same 32-byte frame, commands, 0-1000μg/m³ range and PWM output as the
+	// ZH07's: the two only differ in their package, so the ZH06 is driven with
+	// the ZH07's profile and reports the same capabilities under its own name.
+	ModelZH06
+)
+
+// String returns the name of the model.
+func (m Model) String() string {
+	if p, ok := profiles[m]; ok {
+		return p.name
+	}
+	return fmt.Sprintf("Model(%d)", int(m))
+}
+
+// ParticleCounts holds the number of particles beyond each diameter in 0.1L of
+// air. It is only reported by the Plantower models and is zero otherwise.
+type ParticleCounts struct {
+	Gt03  int // particles > 0.3μm
+	Gt05  int // particles > 0.5μm
+	Gt10  int // particles > 1.0μm
+	Gt25  int // particles > 2.5μm
+	Gt50  int // particles > 5.0μm
+	Gt100 int // particles > 10μm
+}
+
+// Capabilities describes what a sensor model supports.
+type Capabilities struct {
+	Model Model
+
+	Initiative bool // initiative upload mode
+	QA         bool // question and answer mode
+	Dormant    bool // dormant mode, Sleep() and Wake()
+	PWM        bool // PWM output, see ZH07p
+
+	MinConcentration int // lower bound of the measurement range [μg/m³]
+	MaxConcentration int // upper bound of the measurement range [μg/m³]
+
+	FrameLength    int  // length of the initiative upload frame, in bytes
+	ParticleCounts bool // frames carry particle counts, see Reading.Counts
+}
+
+// Capabilities returns what the model supports. Unknown models report the
+// ZH07's capabilities, which is how the drivers treat them.
+func (m Model) Capabilities() Capabilities {
+	p := profileFor(m)
+
+	return Capabilities{
+		Model:            p.model,
+		Initiative:       p.cmdInitiative != nil,
+		QA:               p.cmdQA != nil,
+		Dormant:          p.cmdSleep != nil,
+		PWM:              p.pwm,
+		MinConcentration: p.minConcentration,
+		MaxConcentration: p.maxConcentration,
+		FrameLength:      p.frameLength,
+		ParticleCounts:   p.counts > 0,
+	}
+}
+
+// lineRate is the speed of the serial line of every model, in bits per second.
+// At 8N1 a byte takes 10 bits.
+const lineRate = 9600
+
+// maxFrameAttempts is how many times to try to synchronise with a frame
+// answering a query before giving up.
+const maxFrameAttempts = 64
+
+// profile describes the frame layout and the command set of a sensor model.
+type profile struct {
+	model Model
+	name  string
+
+	// measurement range [μg/m³]
+	minConcentration int
+	maxConcentration int
+	// pwm is true when the model has a PWM output
+	pwm bool
+
+	// initiative upload frame, starting with 0x42 0x4d and ending with a
+	// 2-byte checksum
+	frameLength int // total length of the frame, in bytes
+	pm1         int // offset of the PM1.0 concentration
+	pm25        int // offset of the PM2.5 concentration
+	pm10        int // offset of the PM10 concentration
+	counts      int // offset of the particle counts, 0 if not available
+
+	// qaFrame is true when the answer to a query is an initiative upload frame
+	// rather than the 9-byte 0xFF 0x86 answer
+	qaFrame bool
+
+	// commands, nil when not supported
+	cmdInitiative []byte
+	cmdQA         []byte
+	cmdQuery      []byte
+	cmdSleep      []byte
+	cmdWake       []byte
+}
+
+var (
+	// Plantower commands: 0x42 0x4d command dataH dataL checksumH checksumL
+	plantowerCommandActive  = []byte{0x42, 0x4D, 0xE1, 0x00, 0x01, 0x01, 0x71}
+	plantowerCommandPassive = []byte{0x42, 0x4D, 0xE1, 0x00, 0x00, 0x01, 0x70}
+	plantowerCommandRead    = []byte{0x42, 0x4D, 0xE2, 0x00, 0x00, 0x01, 0x71}
+	plantowerCommandSleep   = []byte{0x42, 0x4D, 0xE4, 0x00, 0x00, 0x01, 0x73}
+	plantowerCommandWake    = []byte{0x42, 0x4D, 0xE4, 0x00, 0x01, 0x01, 0x74}
+
+	winsenProfile = profile{
+		maxConcentration: 1000,
+		pwm:              true,
+		frameLength:      32,
+		pm1:              10,
+		pm25:             12,
+		pm10:             14,
+		cmdInitiative:    commandSetInitiativeUploadMode,
+		cmdQA:            commandSetQAMode,
+		cmdQuery:         commandQuery,
+		cmdSleep:         commandDormantEnter,
+		cmdWake:          commandDormantQuit,
+	}
+
+	plantowerProfile = profile{
+		// effective range, the maximum range is ≥1000
+		maxConcentration: 500,
+		frameLength:      32,
+		pm1:              10,
+		pm25:             12,
+		pm10:             14,
+		counts:           16,
+		qaFrame:          true,
+		cmdInitiative:    plantowerCommandActive,
+		cmdQA:            plantowerCommandPassive,
+		cmdQuery:         plantowerCommandRead,
+		cmdSleep:         plantowerCommandSleep,
+		cmdWake:          plantowerCommandWake,
+	}
+
+	zh03bProfile = profile{
+		minConcentration: 1,
+		maxConcentration: 1000,
+		pwm:              true,
+		frameLength:      24,
+		pm1:              10,
+		pm25:             12,
+		pm10:             14,
+		cmdInitiative:    commandSetInitiativeUploadMode,
+		cmdQA:            commandSetQAMode,
+		cmdQuery:         commandQuery,
+		cmdSleep:         commandDormantEnter,
+		cmdWake:          commandDormantQuit,
+	}
+
+	profiles = map[Model]*profile{
+		ModelZH06:    withName(winsenProfile, ModelZH06, "ZH06"), // identical to the ZH07, see ModelZH06
+		ModelZH07:    withName(winsenProfile, ModelZH07, "ZH07"),
+		ModelZH03B:   withName(zh03bProfile, ModelZH03B, "ZH03B"),
+		ModelPMS5003: withName(plantowerProfile, ModelPMS5003, "PMS5003"),
+		ModelPMS7003: withName(plantowerProfile, ModelPMS7003, "PMS7003"),
+	}
+)
+
+// withName returns a copy of p for model m.
+func withName(p profile, m Model, name string) *profile {
+	p.model, p.name = m, name
+	return &p
+}
+
+// profileFor returns the profile of model m, falling back to the ZH07's.
+func profileFor(m Model) *profile {
+	if p, ok := profiles[m]; ok {
+		return p
+	}
+	return profiles[ModelZH07]
+}
+
+// command returns cmd, or ErrNotSupported if the model has no such command.
+func (p *profile) command(cmd []byte, op string) ([]byte, error) {
+	if cmd == nil {
+		return nil, fmt.Errorf("%w: %s on %s", ErrNotSupported, op, p.name)
+	}
+	return cmd, nil
+}
+
+// readFrame reads an initiative upload frame into buf, which must hold at
+// least frameLength bytes, and returns it. It returns a nil frame and no error
+// when the bytes read do not start a frame of the expected length, in which
+// case the caller should try again to resynchronise.
+func (p *profile) readFrame(rw *bufio.ReadWriter, buf []byte) ([]byte, error) {
+	d, _, err := p.scanFrame(rw, buf)
+	return d, err
+}
+
+// scanFrame is readFrame also returning the number of bytes discarded when
+// they do not start a frame.
+func (p *profile) scanFrame(rw *bufio.ReadWriter, buf []byte) ([]byte, int, error) {
+	var (
+		b0  = buf[0:1]
+		b1  = buf[1:4]
+		n   int
+		err error
+	)
+
+	// read byte by byte until we find the 1st start character (0x42)
+	if _, err = rw.Read(b0); err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrSensorCommunication, err)
+	}
+	if b0[0] != 0x42 {
+		return nil, 1, nil
+	}
+	// then we read the next 3 bytes, which should be:
+	//   2nd character start (0x4d)
+	//   frame length high bits
+	//   frame length low bits
+	// with io.ReadFull, as a short read would leave the previous frame's
+	// bytes in buf and let a shifted frame through
+	if n, err = io.ReadFull(rw, b1[:1]); err != nil {
+		return nil, 1 + n, fmt.Errorf("%w: %v", ErrSensorCommunication, err)
+	}
+	if b1[0] != 0x4d {
+		return nil, 1 + n, nil
+	}
+	if n, err = io.ReadFull(rw, b1[1:3]); err != nil {
+		return nil, 2 + n, fmt.Errorf("%w: %v", ErrSensorCommunication, err)
+	}
+
+	// frame length counts the bytes after the length itself, 28 for a 32-byte frame
+	if byteToInt(b1[1:3]) != p.frameLength-4 {
+		return nil, 4, nil
+	}
+
+	// if everything matches so far, we read the remaining data right after
+	// the header, in place
+	if _, err = io.ReadFull(rw, buf[4:p.frameLength]); err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrSensorCommunication, err)
+	}
+
+	return buf[:p.frameLength], 0, nil
+}
+
+// airtime returns the time it takes to transmit an initiative upload frame.
+func (p *profile) airtime() time.Duration {
+	return time.Duration(p.frameLength*10) * time.Second / lineRate
+}
+
+// decodeFrame extracts a reading from an initiative upload frame.
+func (p *profile) decodeFrame(d []byte) Reading {
+	r := Reading{
+		PM1:  byteToInt(d[p.pm1 : p.pm1+2]),
+		PM25: byteToInt(d[p.pm25 : p.pm25+2]),
+		PM10: byteToInt(d[p.pm10 : p.pm10+2]),
+	}
+
+	if p.counts > 0 {
+		c := d[p.counts:]
+		r.Counts = ParticleCounts{
+			Gt03:  byteToInt(c[0:2]),
+			Gt05:  byteToInt(c[2:4]),
+			Gt10:  byteToInt(c[4:6]),
+			Gt25:  byteToInt(c[6:8]),
+			Gt50:  byteToInt(c[8:10]),
+			Gt100: byteToInt(c[10:12]),
+		}
+	}
+
+	return r
+}
+
+// decode extracts a reading from a 9-byte answer or an initiative upload frame.
+func (p *profile) decode(d []byte) Reading {
+	if len(d) == 9 {
+		return Reading{
+			PM1:  byteToInt(d[6:8]),
+			PM25: byteToInt(d[2:4]),
+			PM10: byteToInt(d[4:6]),
+		}
+	}
+	return p.decodeFrame(d)
+}
+
+// modeCommand returns the command switching to communication mode m.
+func (p *profile) modeCommand(m Mode) ([]byte, error) {
+	switch m {
+	case ModeInitiative:
+		return p.command(p.cmdInitiative, "initiative upload mode")
+	case ModeQA:
+		return p.command(p.cmdQA, "question and answer mode")
+	}
+	return nil, fmt.Errorf("%w: %v mode on a serial port", ErrNotSupported, m)
+}
+
+// query sends a query command and returns the answer: a 9-byte answer read
+// through writeAndRead, or an initiative upload frame read into buf for the
+// models answering with one, skipping anything else such as command
+// acknowledgements.
+func (p *profile) query(
+	rw *bufio.ReadWriter,
+	buf []byte,
+	write func(rw *bufio.ReadWriter, c []byte) error,
+	writeAndRead func(rw *bufio.ReadWriter, c []byte) ([]byte, error),
+	wait func(),
+) ([]byte, error) {
+	c, err := p.command(p.cmdQuery, "question and answer mode")
+	if err != nil {
+		return nil, err
+	}
+	if !p.qaFrame {
+		return writeAndRead(rw, c)
+	}
+
+	if err = write(rw, c); err != nil {
+		return nil, err
+	}
+	wait() // wait for the response
+
+	for i := 0; i < maxFrameAttempts; i++ {
+		d, err := p.readFrame(rw, buf)
+		if err != nil {
+			return nil, err
+		}
+		if d != nil {
+			return d, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: no frame in answer", ErrInvalidFrame)
+}
+
+// checksumOf computes the checksum of a 9-byte answer or an initiative upload frame.
+func checksumOf(d []byte) int {
+	if len(d) == 9 {
+		return calculateChecksum(&d)
+	}
+	return frameChecksum(d)
+}
+
+// receivedChecksumOf recovers the checksum received in a 9-byte answer or an
+// initiative upload frame.
+func receivedChecksumOf(d []byte) int {
+	if len(d) == 9 {
+		return int(d[8])
+	}
+	return frameReceivedChecksum(d)
+}
+
+// frameChecksum computes the checksum of an initiative upload frame, the sum
+// of every byte but the last two.
+func frameChecksum(d []byte) int {
+	var r0 int
+	for _, v := range d[:len(d)-2] {
+		r0 += int(v)
+	}
+	return r0
+}
+
+// frameReceivedChecksum recovers the checksum received in an initiative upload frame.
+func frameReceivedChecksum(d []byte) int {
+	return byteToInt(d[len(d)-2:])
+}
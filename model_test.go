@@ -0,0 +1,332 @@
+package zh07
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// frame builds an initiative upload frame of length n carrying the given
+// 16-bit words from offset 4, with a valid checksum.
+func frame(n int, words ...int) []byte {
+	d := make([]byte, n)
+	d[0], d[1] = 0x42, 0x4D
+	d[2], d[3] = byte((n-4)>>8), byte(n-4)
+	for i, w := range words {
+		d[4+2*i], d[5+2*i] = byte(w>>8), byte(w)
+	}
+	cs := frameChecksum(d)
+	d[n-2], d[n-1] = byte(cs>>8), byte(cs)
+
+	return d
+}
+
+// plantowerFrame builds a PMS5003/PMS7003 frame.
+func plantowerFrame(pm1, pm25, pm10 int, counts ParticleCounts) []byte {
+	return frame(32,
+		pm1, pm25, pm10, // standard particles
+		pm1, pm25, pm10, // atmospheric environment
+		counts.Gt03, counts.Gt05, counts.Gt10, counts.Gt25, counts.Gt50, counts.Gt100,
+	)
+}
+
+func TestModel_String(t *testing.T) {
+	assert.Equal(t, "ZH06", ModelZH06.String())
+	assert.Equal(t, "ZH07", ModelZH07.String())
+	assert.Equal(t, "ZH03B", ModelZH03B.String())
+	assert.Equal(t, "PMS5003", ModelPMS5003.String())
+	assert.Equal(t, "PMS7003", ModelPMS7003.String())
+	assert.Equal(t, "Model(42)", Model(42).String())
+}
+
+func TestZH07i_ReadModels(t *testing.T) {
+	counts := ParticleCounts{Gt03: 1200, Gt05: 350, Gt10: 80, Gt25: 12, Gt50: 3, Gt100: 1}
+
+	tests := []struct {
+		name  string
+		model Model
+		data  []byte
+		want  *Reading
+	}{
+		{
+			name:  "zh07",
+			model: ModelZH07,
+			data:  sampleInitiativePayload,
+			want:  &Reading{PM1: 0x54, PM25: 0x6E, PM10: 0x7C},
+		},
+		{
+			name:  "zh06",
+			model: ModelZH06,
+			data:  sampleInitiativePayload,
+			want:  &Reading{PM1: 0x54, PM25: 0x6E, PM10: 0x7C},
+		},
+		{
+			name:  "zh03b",
+			model: ModelZH03B,
+			data:  frame(24, 0, 0, 0, 10, 20, 30),
+			want:  &Reading{PM1: 10, PM25: 20, PM10: 30},
+		},
+		{
+			name:  "zh03b-skips-zh07-frame",
+			model: ModelZH03B,
+			data:  sampleInitiativePayload,
+		},
+		{
+			name:  "pms5003",
+			model: ModelPMS5003,
+			data:  plantowerFrame(5, 8, 11, counts),
+			want:  &Reading{PM1: 5, PM25: 8, PM10: 11, Counts: counts},
+		},
+		{
+			name:  "pms7003",
+			model: ModelPMS7003,
+			data:  plantowerFrame(5, 8, 11, counts),
+			want:  &Reading{PM1: 5, PM25: 8, PM10: 11, Counts: counts},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z := NewZH07i(&Config{
+				RW:     bufio.NewReadWriter(bufio.NewReader(bytes.NewReader(tt.data)), nil),
+				Model:  tt.model,
+				WarmUp: -1,
+			})
+
+			got, err := z.Read()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			if tt.want != nil {
+				assert.True(t, z.IsReadingValid())
+			}
+		})
+	}
+}
+
+func TestZH07q_ReadPlantower(t *testing.T) {
+	var (
+		counts = ParticleCounts{Gt03: 900, Gt05: 250}
+		ack    = []byte{0x42, 0x4D, 0x00, 0x04, 0xE1, 0x00, 0x01, 0x74}
+		bad    = plantowerFrame(5, 8, 11, counts)
+	)
+	bad[31]++
+
+	tests := []struct {
+		name   string
+		data   []byte
+		checks []checkFn
+	}{
+		{
+			name: "success",
+			data: plantowerFrame(5, 8, 11, counts),
+			checks: check(
+				hasError(false),
+				pm(8, 11, 5),
+			),
+		},
+		{
+			name: "skips-acknowledgement",
+			data: append(append([]byte{0x00}, ack...), plantowerFrame(5, 8, 11, counts)...),
+			checks: check(
+				hasError(false),
+				pm(8, 11, 5),
+			),
+		},
+		{
+			name: "fail-checksum",
+			data: bad,
+			checks: check(
+				hasError(true),
+				isNil,
+			),
+		},
+		{
+			name: "fail-no-frame",
+			data: ack,
+			checks: check(
+				hasError(true),
+				isNil,
+			),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent [][]byte
+
+			z := NewZH07q(&Config{
+				RW:     bufio.NewReadWriter(bufio.NewReader(bytes.NewReader(tt.data)), nil),
+				Model:  ModelPMS5003,
+				WarmUp: -1,
+				Clock:  NewFakeClock(epoch),
+			})
+			z.write = func(_ *bufio.ReadWriter, c []byte) error {
+				sent = append(sent, c)
+				return nil
+			}
+
+			got, err := z.Read()
+			for _, c := range tt.checks {
+				c(t, got, err)
+			}
+			assert.Equal(t, [][]byte{plantowerCommandRead}, sent)
+			if err == nil {
+				assert.Equal(t, counts, got.Counts)
+			}
+		})
+	}
+}
+
+func TestModel_Commands(t *testing.T) {
+	tests := []struct {
+		model          Model
+		initiative, qa []byte
+		sleep, wake    []byte
+	}{
+		{
+			model:      ModelZH07,
+			initiative: commandSetInitiativeUploadMode,
+			qa:         commandSetQAMode,
+			sleep:      commandDormantEnter,
+			wake:       commandDormantQuit,
+		},
+		{
+			model:      ModelZH03B,
+			initiative: commandSetInitiativeUploadMode,
+			qa:         commandSetQAMode,
+			sleep:      commandDormantEnter,
+			wake:       commandDormantQuit,
+		},
+		{
+			model:      ModelPMS5003,
+			initiative: plantowerCommandActive,
+			qa:         plantowerCommandPassive,
+			sleep:      plantowerCommandSleep,
+			wake:       plantowerCommandWake,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model.String(), func(t *testing.T) {
+			var (
+				sent   [][]byte
+				clock  = NewFakeClock(epoch)
+				record = func(_ *bufio.ReadWriter, c []byte) error {
+					sent = append(sent, c)
+					return nil
+				}
+			)
+
+			zi := NewZH07i(&Config{Model: tt.model, Clock: clock})
+			zi.write = record
+			zq := NewZH07q(&Config{Model: tt.model, Clock: clock})
+			zq.write = record
+
+			assert.NoError(t, zi.Init())
+			assert.NoError(t, zq.Init())
+			assert.NoError(t, zi.Sleep())
+			assert.NoError(t, zq.Wake())
+			assert.Equal(t, [][]byte{tt.initiative, tt.qa, tt.sleep, tt.wake}, sent)
+			assert.Equal(t, 4*defaultPostWriteDelay, clock.Slept(), "waits for every command to be executed")
+		})
+	}
+}
+
+func Test_plantowerCommandChecksums(t *testing.T) {
+	for _, c := range [][]byte{
+		plantowerCommandActive,
+		plantowerCommandPassive,
+		plantowerCommandRead,
+		plantowerCommandSleep,
+		plantowerCommandWake,
+	} {
+		assert.Equal(t, frameReceivedChecksum(c), frameChecksum(c), toHex(c))
+	}
+}
+
+func TestModel_Capabilities(t *testing.T) {
+	tests := []struct {
+		model Model
+		want  Capabilities
+	}{
+		{
+			model: ModelZH06,
+			want: Capabilities{Model: ModelZH06, Initiative: true, QA: true, Dormant: true, PWM: true,
+				MaxConcentration: 1000, FrameLength: 32},
+		},
+		{
+			model: ModelZH07,
+			want: Capabilities{Model: ModelZH07, Initiative: true, QA: true, Dormant: true, PWM: true,
+				MaxConcentration: 1000, FrameLength: 32},
+		},
+		{
+			model: ModelZH03B,
+			want: Capabilities{Model: ModelZH03B, Initiative: true, QA: true, Dormant: true, PWM: true,
+				MinConcentration: 1, MaxConcentration: 1000, FrameLength: 24},
+		},
+		{
+			model: ModelPMS5003,
+			want: Capabilities{Model: ModelPMS5003, Initiative: true, QA: true, Dormant: true,
+				MaxConcentration: 500, FrameLength: 32, ParticleCounts: true},
+		},
+		{
+			model: Model(42),
+			want: Capabilities{Model: ModelZH07, Initiative: true, QA: true, Dormant: true, PWM: true,
+				MaxConcentration: 1000, FrameLength: 32},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model.String(), func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.model.Capabilities())
+			assert.Equal(t, tt.want, NewZH07i(&Config{Model: tt.model}).Capabilities())
+			assert.Equal(t, tt.want, NewZH07q(&Config{Model: tt.model}).Capabilities())
+			assert.Equal(t, tt.want, NewZH07p(&Config{Model: tt.model}).Capabilities())
+		})
+	}
+}
+
+func TestModel_ZH06(t *testing.T) {
+	// the ZH06 shares everything with the ZH07 but its name: frame layout,
+	// commands, measurement range and PWM output
+	zh06, zh07 := *profileFor(ModelZH06), *profileFor(ModelZH07)
+	assert.Equal(t, ModelZH06, zh06.model)
+	assert.Equal(t, "ZH06", zh06.name)
+
+	zh06.model, zh06.name = zh07.model, zh07.name
+	assert.Equal(t, zh07, zh06)
+
+	want := ModelZH07.Capabilities()
+	want.Model = ModelZH06
+	assert.Equal(t, want, ModelZH06.Capabilities())
+}
+
+func TestModel_NotSupported(t *testing.T) {
+	var (
+		sent   int
+		record = func(_ *bufio.ReadWriter, _ []byte) error {
+			sent++
+			return nil
+		}
+		bare = &profile{name: "bare"}
+	)
+
+	zi := NewZH07i(nil)
+	zi.profile, zi.write = bare, record
+	assert.ErrorIs(t, zi.Init(), ErrNotSupported)
+	assert.ErrorIs(t, zi.Sleep(), ErrNotSupported)
+	assert.ErrorIs(t, zi.Wake(), ErrNotSupported)
+
+	zq := NewZH07q(nil)
+	zq.profile, zq.write = bare, record
+	assert.ErrorIs(t, zq.Init(), ErrNotSupported)
+	assert.ErrorIs(t, zq.Sleep(), ErrNotSupported)
+	assert.ErrorIs(t, zq.Wake(), ErrNotSupported)
+	_, err := zq.Read()
+	assert.ErrorIs(t, err, ErrNotSupported)
+
+	assert.Zero(t, sent, "nothing is sent to the sensor")
+
+	zp := NewZH07p(&Config{Model: ModelPMS5003, PWM: &edgeList{}})
+	assert.ErrorIs(t, zp.Init(), ErrNotSupported)
+	_, err = zp.Read()
+	assert.ErrorIs(t, err, ErrNotSupported)
+}
@@ -0,0 +1,167 @@
+package zh07
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPowerOffTime     = 2 * time.Second
+	defaultPowerMinInterval = 5 * time.Minute
+)
+
+var _ PowerSwitch = (*FakePowerSwitch)(nil)
+
+// PowerSwitch controls the supply (VDD) of a sensor.
+type PowerSwitch interface {
+	// SetPower turns the supply on or off
+	SetPower(on bool) error
+}
+
+// PowerCycleConfig holds configuration options for a PowerCycler.
+type PowerCycleConfig struct {
+	// OffTime is how long the supply is kept off, 2s if zero
+	OffTime time.Duration
+	// MinInterval is the shortest time allowed between the start of two power
+	// cycles, 5m if zero. A negative value disables rate limiting.
+	MinInterval time.Duration
+	// Logf, when set, receives a line for every power cycle
+	Logf func(format string, args ...any)
+	// Clock times the power cycles and the rate limit, SystemClock if nil
+	Clock Clock
+}
+
+// PowerCycler power cycles a sensor that stopped answering, which is the only
+// way out of a latch-up. Power cycles are rate limited so that a sensor that is
+// gone for good is not switched on and off continuously.
+type PowerCycler struct {
+	sw     PowerSwitch
+	config PowerCycleConfig
+
+	mu     sync.Mutex
+	last   time.Time
+	cycles int
+}
+
+// NewPowerCycler creates a new PowerCycler using sw.
+func NewPowerCycler(sw PowerSwitch, config *PowerCycleConfig) *PowerCycler {
+	if config == nil {
+		config = &PowerCycleConfig{}
+	}
+
+	if config.OffTime <= 0 {
+		config.OffTime = defaultPowerOffTime
+	}
+
+	switch {
+	case config.MinInterval == 0:
+		config.MinInterval = defaultPowerMinInterval
+	case config.MinInterval < 0:
+		config.MinInterval = 0
+	}
+
+	if config.Clock == nil {
+		config.Clock = SystemClock
+	}
+
+	return &PowerCycler{
+		sw:     sw,
+		config: *config,
+	}
+}
+
+// Cycle turns the supply off, waits OffTime and turns it back on. It returns an
+// error wrapping ErrRateLimited when called within MinInterval of the previous
+// cycle. The supply is turned back on even if ctx is done while waiting.
+func (p *PowerCycler) Cycle(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.config.Clock.Now()
+	if !p.last.IsZero() && now.Sub(p.last) < p.config.MinInterval {
+		return fmt.Errorf("%w: last power cycle %v ago, minimum interval is %v",
+			ErrRateLimited, now.Sub(p.last).Round(time.Second), p.config.MinInterval)
+	}
+	p.last = now
+	p.cycles++
+
+	p.logf("power cycling sensor (#%d), off for %v", p.cycles, p.config.OffTime)
+
+	if err := p.sw.SetPower(false); err != nil {
+		p.logf("turning power off: %v", err)
+		return fmt.Errorf("turning power off: %w", err)
+	}
+
+	waitErr := sleepContext(ctx, p.config.Clock, p.config.OffTime)
+
+	if err := p.sw.SetPower(true); err != nil {
+		p.logf("turning power on: %v", err)
+		return fmt.Errorf("turning power on: %w", err)
+	}
+
+	return waitErr
+}
+
+// Cycles returns the number of power cycles performed.
+func (p *PowerCycler) Cycles() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.cycles
+}
+
+// logf logs a power cycle when a logger was configured.
+func (p *PowerCycler) logf(format string, args ...any) {
+	if p.config.Logf != nil {
+		p.config.Logf(format, args...)
+	}
+}
+
+// FakePowerSwitch is an in-memory PowerSwitch for tests. The zero value is a
+// switch that is off.
+type FakePowerSwitch struct {
+	mu          sync.Mutex
+	on          bool
+	transitions []bool
+	err         error
+}
+
+// SetPower implements PowerSwitch. It fails with the error set by SetError, if any.
+func (f *FakePowerSwitch) SetPower(on bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return f.err
+	}
+	f.on = on
+	f.transitions = append(f.transitions, on)
+
+	return nil
+}
+
+// SetError makes every following SetPower call fail with err, or succeed when err is nil.
+func (f *FakePowerSwitch) SetError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.err = err
+}
+
+// On reports whether the supply is on.
+func (f *FakePowerSwitch) On() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.on
+}
+
+// Transitions returns every state the switch was set to, in order.
+func (f *FakePowerSwitch) Transitions() []bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]bool(nil), f.transitions...)
+}
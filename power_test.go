@@ -0,0 +1,147 @@
+package zh07
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPowerCycler_Cycle(t *testing.T) {
+	var (
+		sw    = &FakePowerSwitch{}
+		logs  []string
+		clock = NewFakeClock(epoch)
+		p     = NewPowerCycler(sw, &PowerCycleConfig{
+			OffTime:     2 * time.Second,
+			MinInterval: time.Minute,
+			Logf: func(format string, args ...any) {
+				logs = append(logs, fmt.Sprintf(format, args...))
+			},
+			Clock: clock,
+		})
+		cycle = func() error {
+			return advancing(clock, 2*time.Second, func() error { return p.Cycle(context.Background()) })
+		}
+	)
+
+	assert.NoError(t, cycle())
+	assert.Equal(t, []bool{false, true}, sw.Transitions())
+	assert.True(t, sw.On())
+	assert.Equal(t, 1, p.Cycles())
+	assert.Equal(t, epoch.Add(2*time.Second), clock.Now(), "the power is off for OffTime")
+
+	clock.Advance(30 * time.Second)
+	assert.ErrorIs(t, cycle(), ErrRateLimited)
+	assert.Equal(t, 1, p.Cycles())
+
+	clock.Advance(28 * time.Second)
+	assert.NoError(t, cycle())
+	assert.Equal(t, 2, p.Cycles())
+	assert.Equal(t, []string{
+		"power cycling sensor (#1), off for 2s",
+		"power cycling sensor (#2), off for 2s",
+	}, logs)
+}
+
+func TestPowerCycler_Cancelled(t *testing.T) {
+	var (
+		sw          = &FakePowerSwitch{}
+		p           = NewPowerCycler(sw, &PowerCycleConfig{OffTime: time.Hour})
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	cancel()
+
+	assert.ErrorIs(t, p.Cycle(ctx), context.Canceled)
+	assert.True(t, sw.On(), "power must be restored even when cancelled")
+}
+
+func TestPowerCycler_SwitchError(t *testing.T) {
+	var (
+		sw = &FakePowerSwitch{}
+		p  = NewPowerCycler(sw, &PowerCycleConfig{MinInterval: -1})
+	)
+	sw.SetError(errors.New("test error from gpio"))
+
+	err := p.Cycle(context.Background())
+	assert.ErrorContains(t, err, "turning power off: test error from gpio")
+	assert.Empty(t, sw.Transitions())
+}
+
+func TestResilientSensor_PowerCycle(t *testing.T) {
+	var (
+		commErr = fmt.Errorf("%w: test", ErrSensorCommunication)
+		latched = &scriptedSensor{errs: make([]error, 12)}
+		healthy = &scriptedSensor{readings: []*Reading{same(5)}}
+		sw      = &FakePowerSwitch{}
+		r       = NewResilientSensor(&ResilientConfig{
+			// the sensor stays latched up, whatever the number of reopens,
+			// until it is power cycled
+			Open: func() (SensorInterface, io.Closer, error) {
+				if len(sw.Transitions()) > 0 {
+					return healthy, nil, nil
+				}
+				return latched, nil, nil
+			},
+			Power: NewPowerCycler(sw, &PowerCycleConfig{OffTime: time.Millisecond}),
+			Clock: NewFakeClock(epoch),
+		})
+	)
+	for i := range latched.errs {
+		latched.errs[i] = commErr
+	}
+
+	// with the default policy a read makes 4 attempts, the 12th failure,
+	// which power cycles the sensor, is the last attempt of the 3rd read
+	for i := 0; i < 3; i++ {
+		_, err := r.Read()
+		assert.ErrorIs(t, err, ErrSensorCommunication)
+	}
+	assert.Equal(t, []bool{false, true}, sw.Transitions())
+
+	got, err := r.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, same(5), got)
+}
+
+// failingSensor fails every read.
+type failingSensor struct {
+	scriptedSensor
+}
+
+func (s *failingSensor) Read() (*Reading, error) {
+	return nil, fmt.Errorf("%w: test", ErrSensorCommunication)
+}
+
+func TestResilientSensor_RecoverySchedule(t *testing.T) {
+	var (
+		s       = &failingSensor{}
+		power   = NewPowerCycler(&FakePowerSwitch{}, &PowerCycleConfig{OffTime: time.Millisecond, MinInterval: -1})
+		reopens int
+		r       = NewResilientSensor(&ResilientConfig{
+			Open: func() (SensorInterface, io.Closer, error) {
+				reopens++
+				return s, nil, nil
+			},
+			Power: power,
+			Clock: NewFakeClock(epoch),
+		})
+	)
+
+	// 30 reads of 4 attempts each with the default policy
+	for i := 0; i < 30; i++ {
+		_, err := r.Read()
+		assert.ErrorIs(t, err, ErrSensorCommunication)
+	}
+	assert.Equal(t, 120, r.Failures())
+
+	// every 12th failure power cycles, every other 6th reopens and every
+	// other 3rd re-sends the mode command
+	assert.Equal(t, 10, power.Cycles())
+	assert.Equal(t, 1+10+10, reopens, "opened, reopened and power cycled")
+	assert.Equal(t, 21+20, s.inits, "initialized when opened and re-initialized")
+}
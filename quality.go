@@ -0,0 +1,157 @@
+package zh07
+
+import "strings"
+
+const (
+	defaultMaxConcentration = 1000 // upper end of the datasheet measurement range [μg/m³]
+	defaultStuckCount       = 60
+	defaultMaxHumidity      = 85
+)
+
+var _ Filter = (*QualityChecker)(nil)
+
+// QualityFlag is a set of quality-control flags attached to a reading.
+// A reading without flags passed every check.
+type QualityFlag uint16
+
+const (
+	// FlagOutOfRange marks a value outside the sensor's measurement range
+	FlagOutOfRange QualityFlag = 1 << iota
+	// FlagOrderViolation marks a reading where PM1.0 > PM2.5 or PM2.5 > PM10
+	FlagOrderViolation
+	// FlagStuckValue marks a reading identical to a long run of previous ones
+	FlagStuckValue
+	// FlagWarmingUp marks a reading taken before the sensor had stabilised
+	FlagWarmingUp
+	// FlagHumiditySuspect marks a reading taken at a relative humidity high
+	// enough for water droplets to inflate optical particle counts
+	FlagHumiditySuspect
+)
+
+var qualityFlagNames = []struct {
+	flag QualityFlag
+	name string
+}{
+	{flag: FlagOutOfRange, name: "out-of-range"},
+	{flag: FlagOrderViolation, name: "order-violation"},
+	{flag: FlagStuckValue, name: "stuck-value"},
+	{flag: FlagWarmingUp, name: "warming-up"},
+	{flag: FlagHumiditySuspect, name: "humidity-suspect"},
+}
+
+// Has reports whether every flag in mask is set.
+func (f QualityFlag) Has(mask QualityFlag) bool {
+	return f&mask == mask
+}
+
+// String returns the names of the flags set, separated by "|", or "ok".
+func (f QualityFlag) String() string {
+	if f == 0 {
+		return "ok"
+	}
+
+	var names []string
+	for _, n := range qualityFlagNames {
+		if f.Has(n.flag) {
+			names = append(names, n.name)
+		}
+	}
+
+	return strings.Join(names, "|")
+}
+
+// QualityConfig holds configuration options for a QualityChecker.
+type QualityConfig struct {
+	// MinConcentration is the lowest valid value [μg/m³]
+	MinConcentration int
+	// MaxConcentration is the highest valid value [μg/m³], 1000 if zero
+	MaxConcentration int
+	// StuckCount is the number of consecutive identical readings after which
+	// they are flagged as stuck, 60 if zero. A negative value disables the check.
+	StuckCount int
+	// Humidity optionally returns the current relative humidity [%] from an
+	// external sensor; ok is false when no value is available
+	Humidity func() (rh float64, ok bool)
+	// MaxHumidity is the relative humidity [%] above which readings are
+	// flagged as suspect, 85 if zero
+	MaxHumidity float64
+	// WarmingUp optionally reports whether the sensor is still stabilising
+	WarmingUp func() bool
+}
+
+// QualityChecker attaches quality-control flags to readings.
+//
+// It implements Filter, so it can be chained with outlier filters or used in a
+// FilteredSensor; it never rejects a reading, it only flags it.
+type QualityChecker struct {
+	config QualityConfig
+	last   Reading
+	run    int
+}
+
+// NewQualityChecker creates a new QualityChecker.
+func NewQualityChecker(config *QualityConfig) *QualityChecker {
+	if config == nil {
+		config = &QualityConfig{}
+	}
+
+	if config.MaxConcentration == 0 {
+		config.MaxConcentration = defaultMaxConcentration
+	}
+
+	if config.StuckCount == 0 {
+		config.StuckCount = defaultStuckCount
+	}
+
+	if config.MaxHumidity == 0 {
+		config.MaxHumidity = defaultMaxHumidity
+	}
+
+	return &QualityChecker{config: *config}
+}
+
+// Check runs every check on r, adds the resulting flags to r.Flags and returns them.
+func (q *QualityChecker) Check(r *Reading) QualityFlag {
+	var f QualityFlag
+
+	for _, c := range pmChannels {
+		if v := *c.value(r); v < q.config.MinConcentration || v > q.config.MaxConcentration {
+			f |= FlagOutOfRange
+		}
+	}
+
+	if r.PM1 > r.PM25 || r.PM25 > r.PM10 {
+		f |= FlagOrderViolation
+	}
+
+	if r.PM1 == q.last.PM1 && r.PM25 == q.last.PM25 && r.PM10 == q.last.PM10 && q.run > 0 {
+		q.run++
+	} else {
+		q.last, q.run = *r, 1
+	}
+	if q.config.StuckCount > 0 && q.run >= q.config.StuckCount {
+		f |= FlagStuckValue
+	}
+
+	if q.config.WarmingUp != nil && q.config.WarmingUp() {
+		f |= FlagWarmingUp
+	}
+
+	if q.config.Humidity != nil {
+		if rh, ok := q.config.Humidity(); ok && rh > q.config.MaxHumidity {
+			f |= FlagHumiditySuspect
+		}
+	}
+
+	r.Flags |= f
+
+	return f
+}
+
+// Apply implements Filter. It returns a flagged copy of r and never an error.
+func (q *QualityChecker) Apply(r *Reading) (*Reading, error) {
+	out := *r
+	q.Check(&out)
+
+	return &out, nil
+}
@@ -0,0 +1,116 @@
+package zh07
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQualityFlag_String(t *testing.T) {
+	assert.Equal(t, "ok", QualityFlag(0).String())
+	assert.Equal(t, "out-of-range", FlagOutOfRange.String())
+	assert.Equal(t, "order-violation|warming-up", (FlagWarmingUp | FlagOrderViolation).String())
+}
+
+func TestQualityFlag_Has(t *testing.T) {
+	f := FlagStuckValue | FlagHumiditySuspect
+
+	assert.True(t, f.Has(FlagStuckValue))
+	assert.True(t, f.Has(FlagStuckValue|FlagHumiditySuspect))
+	assert.False(t, f.Has(FlagStuckValue|FlagOutOfRange))
+}
+
+func TestQualityChecker_Check(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *QualityConfig
+		reading Reading
+		want    QualityFlag
+	}{
+		{
+			name:    "ok",
+			reading: Reading{PM1: 5, PM25: 10, PM10: 20},
+			want:    0,
+		},
+		{
+			name:    "out-of-range",
+			reading: Reading{PM1: 5, PM25: 10, PM10: 1001},
+			want:    FlagOutOfRange,
+		},
+		{
+			name:    "custom-range",
+			config:  &QualityConfig{MinConcentration: 1, MaxConcentration: 500},
+			reading: Reading{PM1: 0, PM25: 10, PM10: 20},
+			want:    FlagOutOfRange,
+		},
+		{
+			name:    "order-violation",
+			reading: Reading{PM1: 15, PM25: 10, PM10: 20},
+			want:    FlagOrderViolation,
+		},
+		{
+			name: "warming-up",
+			config: &QualityConfig{
+				WarmingUp: func() bool { return true },
+			},
+			reading: Reading{PM1: 5, PM25: 10, PM10: 20},
+			want:    FlagWarmingUp,
+		},
+		{
+			name: "humidity-suspect",
+			config: &QualityConfig{
+				Humidity: func() (float64, bool) { return 92, true },
+			},
+			reading: Reading{PM1: 5, PM25: 10, PM10: 20},
+			want:    FlagHumiditySuspect,
+		},
+		{
+			name: "humidity-unavailable",
+			config: &QualityConfig{
+				Humidity: func() (float64, bool) { return 92, false },
+			},
+			reading: Reading{PM1: 5, PM25: 10, PM10: 20},
+			want:    0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				q = NewQualityChecker(tt.config)
+				r = tt.reading
+			)
+
+			assert.Equal(t, tt.want, q.Check(&r))
+			assert.Equal(t, tt.want, r.Flags)
+		})
+	}
+}
+
+func TestQualityChecker_StuckValue(t *testing.T) {
+	var (
+		q   = NewQualityChecker(&QualityConfig{StuckCount: 3})
+		got []bool
+	)
+
+	for _, v := range []int{4, 4, 4, 4, 5, 5} {
+		got = append(got, q.Check(same(v)).Has(FlagStuckValue))
+	}
+	assert.Equal(t, []bool{false, false, true, true, false, false}, got)
+
+	q = NewQualityChecker(&QualityConfig{StuckCount: -1})
+	for i := 0; i < 100; i++ {
+		assert.Zero(t, q.Check(same(4)))
+	}
+}
+
+func TestQualityChecker_Apply(t *testing.T) {
+	var (
+		q  = NewQualityChecker(nil)
+		in = &Reading{PM1: 30, PM25: 20, PM10: 10}
+	)
+
+	r, err := ApplyFilters(in, q)
+	assert.NoError(t, err)
+	assert.Equal(t, FlagOrderViolation, r.Flags)
+	assert.Zero(t, in.Flags, "the original reading must not be modified")
+}
@@ -0,0 +1,175 @@
+package zh07
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ReplayConfig holds configuration options for a Replay.
+type ReplayConfig struct {
+	// Realtime serves the bytes read with their original timing relative to
+	// the commands written, otherwise they are served as fast as possible
+	Realtime bool
+	// Clock is used to wait in real time, SystemClock if nil
+	Clock Clock
+}
+
+// Replay is a transport serving a capture back to a driver, see ReadCapture.
+//
+// Bytes read are served from the RX records in order, each read returning at
+// most one record so that frames arrive in the same chunks as they did. A
+// record is only served once every TX record before it was written, since
+// it usually answers them; until then, and once the capture is exhausted,
+// reads fail with io.EOF as on a serial port whose reads time out.
+//
+// Bytes written are checked against the TX records, however they are
+// chunked. Writing anything else fails with ErrDivergence, as does any later
+// call.
+type Replay struct {
+	mu       sync.Mutex
+	records  []CaptureRecord
+	realtime bool
+	clock    Clock
+	base     time.Time // time the capture started, shifted as commands are written late
+
+	tx, txOff int // next TX record, and bytes of it already written
+	rx, rxOff int // next RX record, and bytes of it already read
+
+	err error
+}
+
+// NewReplay creates a new Replay serving records.
+func NewReplay(records []CaptureRecord, config *ReplayConfig) *Replay {
+	if config == nil {
+		config = &ReplayConfig{}
+	}
+
+	if config.Clock == nil {
+		config.Clock = SystemClock
+	}
+
+	r := &Replay{
+		records:  records,
+		realtime: config.Realtime,
+		clock:    config.Clock,
+		base:     config.Clock.Now(),
+	}
+	r.tx = r.seek(0, TX)
+	r.rx = r.seek(0, RX)
+
+	return r
+}
+
+// Read serves the next RX record, or what is left of it.
+func (r *Replay) Read(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.rx >= len(r.records) || r.tx < r.rx {
+		return 0, io.EOF
+	}
+
+	rec := r.records[r.rx]
+	if r.realtime {
+		if d := r.base.Add(rec.Offset).Sub(r.clock.Now()); d > 0 {
+			r.clock.Sleep(d)
+		}
+	}
+
+	n := copy(b, rec.Data[r.rxOff:])
+	if r.rxOff += n; r.rxOff == len(rec.Data) {
+		r.rx, r.rxOff = r.seek(r.rx+1, RX), 0
+	}
+
+	return n, nil
+}
+
+// Write checks b against the TX records.
+func (r *Replay) Write(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	for i := 0; i < len(b); {
+		if r.tx >= len(r.records) {
+			r.err = fmt.Errorf("%w: wrote %X after the end of the capture", ErrDivergence, b)
+			return i, r.err
+		}
+
+		rec := r.records[r.tx]
+		if r.txOff == 0 && r.realtime {
+			// keep the records that follow in time with this command
+			if now := r.clock.Now(); now.After(r.base.Add(rec.Offset)) {
+				r.base = now.Add(-rec.Offset)
+			}
+		}
+
+		want := rec.Data[r.txOff:]
+		n := min(len(want), len(b)-i)
+		if !bytes.Equal(b[i:i+n], want[:n]) {
+			r.err = fmt.Errorf("%w: wrote %X, expected %X at %v", ErrDivergence, b, want, rec.Offset)
+			return i, r.err
+		}
+
+		i += n
+		if r.txOff += n; r.txOff == len(rec.Data) {
+			r.tx, r.txOff = r.seek(r.tx+1, TX), 0
+		}
+	}
+
+	return len(b), nil
+}
+
+// Close does nothing, the replay can be checked with Done afterwards.
+func (r *Replay) Close() error {
+	return nil
+}
+
+// Done returns the divergence error if there was one, or an error wrapping
+// ErrDivergence if some bytes were neither written nor read, and nil if the
+// whole capture was replayed.
+func (r *Replay) Done() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+
+	tx, rx := r.left(r.tx, r.txOff, TX), r.left(r.rx, r.rxOff, RX)
+	if tx > 0 || rx > 0 {
+		return fmt.Errorf("%w: %d bytes to write and %d to read left", ErrDivergence, tx, rx)
+	}
+
+	return nil
+}
+
+// seek returns the index of the first record in direction d from i on, or
+// len(r.records) if there is none.
+func (r *Replay) seek(i int, d Direction) int {
+	for i < len(r.records) && (r.records[i].Direction != d || len(r.records[i].Data) == 0) {
+		i++
+	}
+	return i
+}
+
+// left counts the bytes in direction d from record i on, skipping the first
+// off bytes.
+func (r *Replay) left(i, off int, d Direction) int {
+	n := -off
+	for ; i < len(r.records); i++ {
+		if r.records[i].Direction == d {
+			n += len(r.records[i].Data)
+		}
+	}
+	return max(n, 0)
+}
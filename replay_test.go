@@ -0,0 +1,136 @@
+package zh07
+
+import (
+	"bufio"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// qaSession is a capture of a ZH07q initialised and queried once, the
+// answer arriving 20ms after the post-write delay.
+var qaSession = []CaptureRecord{
+	{Offset: 0, Direction: TX, Data: commandSetQAMode},
+	{Offset: 250 * time.Millisecond, Direction: TX, Data: commandQuery},
+	{Offset: 520 * time.Millisecond, Direction: RX, Data: sampleQAPayload},
+}
+
+// replayed returns a read-writer over r.
+func replayed(r *Replay) *bufio.ReadWriter {
+	return bufio.NewReadWriter(bufio.NewReader(r), bufio.NewWriter(r))
+}
+
+func TestReplay_ZH07q(t *testing.T) {
+	tests := []struct {
+		name     string
+		realtime bool
+		delay    time.Duration // post-write delay
+		late     time.Duration // time passed between Init and Read
+		want     time.Duration // time passed when the reading is returned
+	}{
+		{
+			name:     "realtime",
+			realtime: true,
+			want:     520 * time.Millisecond,
+		},
+		{
+			name:     "realtime-late",
+			realtime: true,
+			late:     time.Second,
+			want:     1520 * time.Millisecond,
+		},
+		{
+			name:  "fast",
+			delay: -1,
+			want:  0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				clock  = NewFakeClock(epoch)
+				replay = NewReplay(qaSession, &ReplayConfig{Realtime: tt.realtime, Clock: clock})
+				z      = NewZH07q(&Config{RW: replayed(replay), WarmUp: -1, Clock: clock, PostWriteDelay: tt.delay})
+			)
+
+			assert.NoError(t, z.Init())
+			clock.Advance(tt.late)
+			r, err := z.Read()
+			assert.NoError(t, err)
+			assert.Equal(t, &Reading{PM1: 0x65, PM25: 0x85, PM10: 0x96}, r)
+			assert.Equal(t, tt.want, clock.Now().Sub(epoch))
+			assert.NoError(t, replay.Done())
+		})
+	}
+}
+
+func TestReplay_ZH07i(t *testing.T) {
+	var (
+		clock  = NewFakeClock(epoch)
+		replay = NewReplay([]CaptureRecord{
+			{Offset: 0, Direction: TX, Data: commandSetInitiativeUploadMode},
+			{Offset: 900 * time.Millisecond, Direction: RX, Data: sampleInitiativePayload[:10]},
+			{Offset: 910 * time.Millisecond, Direction: RX, Data: sampleInitiativePayload[10:]},
+			{Offset: 1900 * time.Millisecond, Direction: RX, Data: sampleInitiativePayload},
+		}, &ReplayConfig{Realtime: true, Clock: clock})
+		z = NewZH07i(&Config{RW: replayed(replay), WarmUp: -1, Clock: clock})
+	)
+
+	assert.NoError(t, z.Init())
+	for _, at := range []time.Duration{910 * time.Millisecond, 1900 * time.Millisecond} {
+		r, err := z.Read()
+		assert.NoError(t, err)
+		assert.Equal(t, &Reading{PM1: 0x54, PM25: 0x6E, PM10: 0x7C}, r)
+		assert.Equal(t, at, clock.Now().Sub(epoch), "frames arrive in time")
+	}
+
+	_, err := z.Read()
+	assert.ErrorIs(t, err, ErrSensorCommunication, "reads time out at the end of the capture")
+	assert.NoError(t, replay.Done())
+}
+
+func TestReplay_Divergence(t *testing.T) {
+	replay := NewReplay(qaSession, nil)
+	z := NewZH07i(&Config{RW: replayed(replay), PostWriteDelay: -1})
+
+	err := z.Init()
+	assert.ErrorIs(t, err, ErrDivergence)
+	assert.EqualError(t, err, "replay diverged: wrote FF0178400000000047, expected FF0178410000000046 at 0s")
+
+	_, err = replay.Read(make([]byte, 9))
+	assert.ErrorIs(t, err, ErrDivergence, "the divergence sticks")
+	assert.ErrorIs(t, replay.Done(), ErrDivergence)
+}
+
+func TestReplay(t *testing.T) {
+	replay := NewReplay(qaSession, nil)
+	b := make([]byte, 16)
+
+	_, err := replay.Read(b)
+	assert.Equal(t, io.EOF, err, "the answer waits for the commands before it")
+
+	n, err := replay.Write(append(append([]byte{}, commandSetQAMode...), commandQuery[:3]...))
+	assert.NoError(t, err, "records can be written in other chunks")
+	assert.Equal(t, 12, n)
+	assert.EqualError(t, replay.Done(), "replay diverged: 6 bytes to write and 9 to read left")
+
+	_, err = replay.Write(commandQuery[3:])
+	assert.NoError(t, err)
+
+	n, err = replay.Read(b[:4])
+	assert.NoError(t, err)
+	assert.Equal(t, sampleQAPayload[:4], b[:n])
+	n, err = replay.Read(b)
+	assert.NoError(t, err)
+	assert.Equal(t, sampleQAPayload[4:], b[:n], "what is left of the record")
+
+	_, err = replay.Read(b)
+	assert.Equal(t, io.EOF, err)
+	assert.NoError(t, replay.Done())
+
+	_, err = replay.Write(commandQuery)
+	assert.EqualError(t, err, "replay diverged: wrote FF0186000000000079 after the end of the capture")
+	assert.NoError(t, replay.Close())
+}
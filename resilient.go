@@ -0,0 +1,287 @@
+package zh07
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryMaxRetries     = 3
+	defaultRetryInitialBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff     = 10 * time.Second
+	defaultRetryMultiplier     = 2
+	defaultResilientReinit     = 3
+	defaultResilientReopen     = 6
+	defaultResilientPowerCycle = 12
+)
+
+var _ SensorInterface = (*ResilientSensor)(nil)
+
+// RetryPolicy describes how failed reads are retried.
+type RetryPolicy struct {
+	// MaxRetries is the number of times a failed read is retried before
+	// giving up, 3 if zero. A negative value disables retries.
+	MaxRetries int
+	// InitialBackoff is the pause before the first retry, 100ms if zero
+	InitialBackoff time.Duration
+	// MaxBackoff caps the pause between retries, 10s if zero
+	MaxBackoff time.Duration
+	// Multiplier is the factor the pause grows by after every retry, 2 if zero
+	Multiplier float64
+}
+
+// Backoff returns the pause before the given retry, counting from zero.
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	d := float64(p.InitialBackoff)
+	for i := 0; i < retry && d < float64(p.MaxBackoff); i++ {
+		d *= p.Multiplier
+	}
+
+	if d > float64(p.MaxBackoff) {
+		return p.MaxBackoff
+	}
+	return time.Duration(d)
+}
+
+// ResilientConfig holds configuration options for a ResilientSensor.
+type ResilientConfig struct {
+	// Open opens the transport and creates a sensor on it. It is called the
+	// first time the sensor is needed and whenever the transport has to be
+	// reopened, for instance after a USB-serial adapter re-enumerates. The
+	// closer, when not nil, is closed before opening again.
+	Open func() (SensorInterface, io.Closer, error)
+	// Retry is the retry and backoff policy for reads
+	Retry RetryPolicy
+	// ReinitAfter is the number of consecutive failures after which the mode
+	// command is sent again, 3 if zero
+	ReinitAfter int
+	// ReopenAfter is the number of consecutive failures after which the
+	// transport is closed and opened again, 6 if zero
+	ReopenAfter int
+	// Power, when set, is used to power cycle the sensor when reopening the
+	// transport is not enough
+	Power *PowerCycler
+	// PowerCycleAfter is the number of consecutive failures after which the
+	// sensor is power cycled and the transport reopened, 12 if zero
+	PowerCycleAfter int
+	// Logf, when set, receives a line for every recovery action taken
+	Logf func(format string, args ...any)
+	// Clock waits out the backoff between retries, SystemClock if nil
+	Clock Clock
+}
+
+// ResilientSensor wraps a sensor and recovers from repeated failures, first by
+// sending the mode command again, then by reopening the transport and, when a
+// PowerCycler is configured, finally by power cycling the sensor.
+type ResilientSensor struct {
+	config ResilientConfig
+
+	reads    sync.Mutex // serialises Read, backoff included
+	mu       sync.Mutex // guards the fields below
+	sensor   SensorInterface
+	closer   io.Closer
+	failures int
+}
+
+// NewResilientSensor creates a new ResilientSensor. The transport is not opened
+// until Init or Read are called.
+func NewResilientSensor(config *ResilientConfig) *ResilientSensor {
+	if config == nil {
+		config = &ResilientConfig{}
+	}
+
+	if config.Retry.MaxRetries == 0 {
+		config.Retry.MaxRetries = defaultRetryMaxRetries
+	}
+
+	if config.Retry.InitialBackoff <= 0 {
+		config.Retry.InitialBackoff = defaultRetryInitialBackoff
+	}
+
+	if config.Retry.MaxBackoff <= 0 {
+		config.Retry.MaxBackoff = defaultRetryMaxBackoff
+	}
+
+	if config.Retry.Multiplier <= 0 {
+		config.Retry.Multiplier = defaultRetryMultiplier
+	}
+
+	if config.ReinitAfter <= 0 {
+		config.ReinitAfter = defaultResilientReinit
+	}
+
+	if config.ReopenAfter <= 0 {
+		config.ReopenAfter = defaultResilientReopen
+	}
+
+	if config.PowerCycleAfter <= 0 {
+		config.PowerCycleAfter = defaultResilientPowerCycle
+	}
+
+	if config.Clock == nil {
+		config.Clock = SystemClock
+	}
+
+	return &ResilientSensor{
+		config: *config,
+	}
+}
+
+// Init opens the transport if needed and initializes the sensor.
+func (r *ResilientSensor) Init() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.sensor == nil {
+		return r.reopen()
+	}
+
+	return r.sensor.Init()
+}
+
+// CalculateChecksum calculates the checksum of the current sensor's last payload.
+func (r *ResilientSensor) CalculateChecksum() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.sensor == nil {
+		return 0
+	}
+	return r.sensor.CalculateChecksum()
+}
+
+// IsReadingValid checks the current sensor's last payload.
+func (r *ResilientSensor) IsReadingValid() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.sensor != nil && r.sensor.IsReadingValid()
+}
+
+// Read reads from the sensor, retrying failed reads according to the retry
+// policy and recovering the sensor when failures pile up. The error of the
+// last attempt is returned once the retries are exhausted.
+func (r *ResilientSensor) Read() (*Reading, error) {
+	r.reads.Lock()
+	defer r.reads.Unlock()
+
+	for retry := 0; ; retry++ {
+		reading, err := r.attempt()
+		if err == nil {
+			return reading, nil
+		}
+		if retry >= r.config.Retry.MaxRetries {
+			return nil, err
+		}
+
+		// back off without holding r.mu, so that the other methods answer
+		// meanwhile
+		r.config.Clock.Sleep(r.config.Retry.Backoff(retry))
+	}
+}
+
+// attempt reads once, counting a failure and recovering the sensor as needed.
+func (r *ResilientSensor) attempt() (*Reading, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reading, err := r.read()
+	if err == nil {
+		if reading != nil {
+			r.failures = 0
+		}
+		return reading, nil
+	}
+
+	// recover on every failure, the last attempt included, so that no
+	// multiple of a recovery threshold is missed
+	r.failures++
+	r.recover(err)
+
+	return nil, err
+}
+
+// Failures returns the number of consecutive failed reads.
+func (r *ResilientSensor) Failures() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.failures
+}
+
+// read reads from the current sensor, opening it first if needed.
+func (r *ResilientSensor) read() (*Reading, error) {
+	if r.sensor == nil {
+		if err := r.reopen(); err != nil {
+			return nil, err
+		}
+	}
+
+	return r.sensor.Read()
+}
+
+// recover takes the recovery action due after the current number of failures.
+func (r *ResilientSensor) recover(cause error) {
+	switch {
+	case r.sensor == nil:
+		// the transport could not be opened, the next read tries again
+	case r.config.Power != nil && r.failures%r.config.PowerCycleAfter == 0:
+		r.logf("power cycling sensor after %d consecutive failures: %v", r.failures, cause)
+		if err := r.config.Power.Cycle(context.Background()); err != nil {
+			r.logf("power cycling sensor: %v", err)
+		}
+		if err := r.reopen(); err != nil {
+			r.logf("reopening transport: %v", err)
+		}
+	case r.failures%r.config.ReopenAfter == 0:
+		r.logf("reopening transport after %d consecutive failures: %v", r.failures, cause)
+		if err := r.reopen(); err != nil {
+			r.logf("reopening transport: %v", err)
+		}
+	case r.failures%r.config.ReinitAfter == 0:
+		r.logf("re-sending mode command after %d consecutive failures: %v", r.failures, cause)
+		if err := r.sensor.Init(); err != nil {
+			r.logf("re-sending mode command: %v", err)
+		}
+	}
+}
+
+// reopen closes the current transport, if any, opens a new one and
+// initializes the sensor on it. On failure the sensor is left unset.
+func (r *ResilientSensor) reopen() error {
+	if r.closer != nil {
+		if err := r.closer.Close(); err != nil {
+			r.logf("closing transport: %v", err)
+		}
+	}
+	r.sensor, r.closer = nil, nil
+
+	if r.config.Open == nil {
+		return fmt.Errorf("%w: no Open function configured", ErrSensorCommunication)
+	}
+
+	s, c, err := r.config.Open()
+	if err != nil {
+		return fmt.Errorf("%w: opening transport: %v", ErrSensorCommunication, err)
+	}
+
+	if err := s.Init(); err != nil {
+		if c != nil {
+			_ = c.Close()
+		}
+		return err
+	}
+	r.sensor, r.closer = s, c
+
+	return nil
+}
+
+// logf logs a recovery action when a logger was configured.
+func (r *ResilientSensor) logf(format string, args ...any) {
+	if r.config.Logf != nil {
+		r.config.Logf(format, args...)
+	}
+}
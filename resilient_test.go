@@ -0,0 +1,180 @@
+package zh07
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// closeCounter counts calls to Close.
+type closeCounter struct {
+	closed int
+}
+
+func (c *closeCounter) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 3}
+
+	var got []time.Duration
+	for i := 0; i < 5; i++ {
+		got = append(got, p.Backoff(i))
+	}
+	assert.Equal(t, []time.Duration{
+		100 * time.Millisecond,
+		300 * time.Millisecond,
+		900 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}, got)
+}
+
+func TestResilientSensor_Read(t *testing.T) {
+	var (
+		commErr = fmt.Errorf("%w: test", ErrSensorCommunication)
+		first   = &scriptedSensor{
+			readings: []*Reading{same(1), nil, nil, nil, nil, nil, nil, same(2)},
+			errs:     []error{nil, commErr, commErr, commErr, commErr, commErr, commErr},
+		}
+		second  = &scriptedSensor{readings: []*Reading{same(3)}}
+		sensors = []*scriptedSensor{first, second}
+		closers []*closeCounter
+		logs    []string
+		clock   = NewFakeClock(epoch)
+		r       = NewResilientSensor(&ResilientConfig{
+			Open: func() (SensorInterface, io.Closer, error) {
+				if len(sensors) == 0 {
+					return nil, nil, errors.New("no such device")
+				}
+				s := sensors[0]
+				sensors = sensors[1:]
+				c := &closeCounter{}
+				closers = append(closers, c)
+				return s, c, nil
+			},
+			Retry:       RetryPolicy{MaxRetries: 2, InitialBackoff: time.Millisecond, Multiplier: 2},
+			ReinitAfter: 2,
+			ReopenAfter: 5,
+			Logf: func(format string, args ...any) {
+				logs = append(logs, fmt.Sprintf(format, args...))
+			},
+			Clock: clock,
+		})
+	)
+
+	assert.False(t, r.IsReadingValid())
+	assert.Equal(t, 0, r.CalculateChecksum())
+
+	got, err := r.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, same(1), got)
+	assert.Equal(t, 1, first.inits, "the sensor is initialized when opened")
+
+	// 3 failures: the mode command is sent again after the 2nd
+	_, err = r.Read()
+	assert.ErrorIs(t, err, ErrSensorCommunication)
+	assert.Equal(t, 3, r.Failures())
+	assert.Equal(t, 2, first.inits)
+	assert.Equal(t, time.Millisecond+2*time.Millisecond, clock.Slept(), "backing off before each retry")
+
+	// 2 more failures trigger a reopen, which reads from the second sensor
+	got, err = r.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, same(3), got)
+	assert.Equal(t, 0, r.Failures())
+	assert.Equal(t, 3, first.inits)
+	assert.Equal(t, 1, second.inits)
+	assert.Equal(t, 1, closers[0].closed)
+	assert.True(t, r.IsReadingValid())
+
+	if assert.Len(t, logs, 3) {
+		assert.Contains(t, logs[0], "re-sending mode command after 2 consecutive failures")
+		assert.Contains(t, logs[1], "re-sending mode command after 4 consecutive failures")
+		assert.Contains(t, logs[2], "reopening transport after 5 consecutive failures")
+	}
+}
+
+// gateClock is a FakeClock whose Sleep blocks until released.
+type gateClock struct {
+	*FakeClock
+	sleeping chan time.Duration
+	release  chan struct{}
+}
+
+func (c *gateClock) Sleep(d time.Duration) {
+	c.sleeping <- d
+	<-c.release
+	c.FakeClock.Sleep(d)
+}
+
+func TestResilientSensor_ReadBackoff(t *testing.T) {
+	var (
+		commErr = fmt.Errorf("%w: test", ErrSensorCommunication)
+		s       = &scriptedSensor{readings: []*Reading{nil, same(4)}, errs: []error{commErr}}
+		clock   = &gateClock{FakeClock: NewFakeClock(epoch), sleeping: make(chan time.Duration), release: make(chan struct{})}
+		r       = NewResilientSensor(&ResilientConfig{
+			Open:  func() (SensorInterface, io.Closer, error) { return s, nil, nil },
+			Retry: RetryPolicy{MaxRetries: 1, InitialBackoff: time.Second},
+			Clock: clock,
+		})
+		done = make(chan *Reading)
+	)
+
+	go func() {
+		got, err := r.Read()
+		assert.NoError(t, err)
+		done <- got
+	}()
+
+	assert.Equal(t, time.Second, <-clock.sleeping)
+	assert.Equal(t, 1, r.Failures(), "answered while backing off")
+	close(clock.release)
+
+	assert.Equal(t, same(4), <-done)
+	assert.Equal(t, 0, r.Failures())
+}
+
+func TestResilientSensor_DeviceGone(t *testing.T) {
+	var (
+		present = false
+		s       = &scriptedSensor{readings: []*Reading{same(7)}}
+		r       = NewResilientSensor(&ResilientConfig{
+			Open: func() (SensorInterface, io.Closer, error) {
+				if !present {
+					return nil, nil, errors.New("no such device")
+				}
+				return s, nil, nil
+			},
+			Retry: RetryPolicy{MaxRetries: -1},
+			Clock: NewFakeClock(epoch),
+		})
+	)
+
+	assert.ErrorIs(t, r.Init(), ErrSensorCommunication)
+
+	_, err := r.Read()
+	assert.ErrorIs(t, err, ErrSensorCommunication)
+	assert.Contains(t, err.Error(), "no such device")
+
+	present = true
+	got, err := r.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, same(7), got)
+
+	assert.NoError(t, r.Init())
+	assert.Equal(t, 2, s.inits)
+}
+
+func TestResilientSensor_NoOpen(t *testing.T) {
+	r := NewResilientSensor(&ResilientConfig{Clock: NewFakeClock(epoch)})
+
+	_, err := r.Read()
+	assert.ErrorIs(t, err, ErrSensorCommunication)
+}
@@ -0,0 +1,238 @@
+package zh07
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const defaultSnifferReplyTimeout = time.Second
+
+// SnifferConfig holds configuration options for Sniff.
+type SnifferConfig struct {
+	// Model selects the frame layout and the command set, ModelZH07 if zero
+	Model Model
+	// Clock timestamps the events, SystemClock if nil
+	Clock Clock
+	// ReplyTimeout is how long a query waits for its answer, 1s if zero. A
+	// query is reported as unanswered when anything else arrives after it.
+	ReplyTimeout time.Duration
+}
+
+// SniffEvent is a command, an answer, a frame or a run of stray bytes seen on
+// the lines between a microcontroller and a sensor.
+type SniffEvent struct {
+	Time      time.Time // time the first byte was received
+	Direction Direction // TX from the microcontroller, RX from the sensor
+	Data      []byte
+	Label     string        // what the bytes are, as printed by Annotate
+	Command   string        // name of the command sent, if known
+	Reading   *Reading      // reading carried by an answer or a frame with a valid checksum
+	Latency   time.Duration // time since the query an answer replies to
+	Err       error         // why the bytes could not be decoded, or ErrTimeout for an unanswered query
+}
+
+// sniffed is a chunk of bytes received on one of the lines.
+type sniffed struct {
+	dir  Direction
+	at   time.Time
+	data []byte
+	err  error
+}
+
+// Sniff decodes the traffic between a microcontroller and a sensor, read
+// passively from two serial adapters: tx carries what the microcontroller
+// sends and rx what the sensor answers. Commands and answers are decoded
+// with the frame formats of the model and each query is paired with its
+// answer; initiative upload frames are decoded as they come.
+//
+// The events are sent on the returned channel, which is closed once both
+// readers failed, io.EOF included, or ctx is done. Readers blocked in Read
+// are not interrupted by ctx, close the ports to stop them.
+func Sniff(ctx context.Context, tx, rx io.Reader, config *SnifferConfig) <-chan SniffEvent {
+	if config == nil {
+		config = &SnifferConfig{}
+	}
+
+	if config.Clock == nil {
+		config.Clock = SystemClock
+	}
+
+	if config.ReplyTimeout <= 0 {
+		config.ReplyTimeout = defaultSnifferReplyTimeout
+	}
+
+	var (
+		out    = make(chan SniffEvent)
+		chunks = make(chan sniffed)
+	)
+	go sniffLine(ctx, TX, tx, config.Clock, chunks)
+	go sniffLine(ctx, RX, rx, config.Clock, chunks)
+
+	go func() {
+		defer close(out)
+
+		s := &sniffer{
+			profile: profileFor(config.Model),
+			timeout: config.ReplyTimeout,
+			start:   config.Clock.Now(),
+			lines:   map[Direction]*scanner{TX: {dir: TX}, RX: {dir: RX}},
+			out:     out,
+		}
+
+		for open := 2; open > 0; {
+			var c sniffed
+			select {
+			case <-ctx.Done():
+				return
+			case c = <-chunks:
+			}
+
+			if !s.push(ctx, c) {
+				return
+			}
+			if c.err != nil {
+				open--
+			}
+		}
+
+		s.flush(ctx)
+	}()
+
+	return out
+}
+
+// sniffLine reads r and sends what it reads on chunks until it fails.
+func sniffLine(ctx context.Context, dir Direction, r io.Reader, clock Clock, chunks chan<- sniffed) {
+	for {
+		b := make([]byte, 64)
+		n, err := r.Read(b)
+
+		select {
+		case chunks <- sniffed{dir: dir, at: clock.Now(), data: b[:n], err: err}:
+		case <-ctx.Done():
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// sniffer pairs queries with answers and turns units into events.
+type sniffer struct {
+	profile *profile
+	timeout time.Duration
+	start   time.Time
+	lines   map[Direction]*scanner
+	query   *SniffEvent // query waiting for its answer
+	out     chan<- SniffEvent
+}
+
+// push decodes a chunk and sends the resulting events. It returns false
+// once ctx is done.
+func (s *sniffer) push(ctx context.Context, c sniffed) bool {
+	l := s.lines[c.dir]
+	l.push(c.at.Sub(s.start), c.data)
+
+	for u, ok := l.next(); ok; u, ok = l.next() {
+		if !s.emit(ctx, s.event(u)...) {
+			return false
+		}
+	}
+
+	if c.err != nil && !errors.Is(c.err, io.EOF) {
+		return s.emit(ctx, SniffEvent{
+			Time:      c.at,
+			Direction: c.dir,
+			Err:       fmt.Errorf("%w: %v line: %v", ErrSensorCommunication, c.dir, c.err),
+		})
+	}
+
+	return true
+}
+
+// flush sends whatever is left once both lines are closed.
+func (s *sniffer) flush(ctx context.Context) {
+	for _, d := range []Direction{TX, RX} {
+		if u, ok := s.lines[d].rest(); ok && !s.emit(ctx, s.event(u)...) {
+			return
+		}
+	}
+	if s.query != nil {
+		s.emit(ctx, s.unanswered())
+	}
+}
+
+// emit sends events, returning false once ctx is done.
+func (s *sniffer) emit(ctx context.Context, events ...SniffEvent) bool {
+	for _, e := range events {
+		select {
+		case s.out <- e:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// event turns u into events: a query left unanswered may come first.
+func (s *sniffer) event(u unit) []SniffEvent {
+	var (
+		events []SniffEvent
+		p      = s.profile
+		e      = SniffEvent{
+			Time:      s.start.Add(u.offset),
+			Direction: u.dir,
+			Data:      u.data,
+			Label:     p.describe(u),
+		}
+	)
+
+	// a query waits for the next answer, within the reply timeout
+	if s.query != nil && (u.kind == unitCommand || e.Time.Sub(s.query.Time) > s.timeout) {
+		events = append(events, s.unanswered())
+	}
+
+	switch u.kind {
+	case unitCommand:
+		e.Command = p.commandName(u.data)
+		if e.Command == "" {
+			e.Err = fmt.Errorf("%w: unknown command %X", ErrInvalidFrame, u.data)
+		} else if e.Command == "query" {
+			q := e
+			s.query = &q
+		}
+
+	case unitAnswer, unitFrame:
+		if u.kind == unitFrame && len(u.data) != p.frameLength {
+			break // acknowledgement, or a frame of another model
+		}
+		if checksumOf(u.data) != receivedChecksumOf(u.data) {
+			e.Err = fmt.Errorf("%w: received=%X, calculated=%X", ErrChecksumMismatch, receivedChecksumOf(u.data), checksumOf(u.data))
+		} else {
+			r := p.decode(u.data)
+			e.Reading = &r
+		}
+		if s.query != nil {
+			e.Latency = e.Time.Sub(s.query.Time)
+			s.query = nil
+		}
+
+	default:
+		e.Err = fmt.Errorf("%w: %s", ErrInvalidFrame, e.Label)
+	}
+
+	return append(events, e)
+}
+
+// unanswered returns the event reporting the pending query as unanswered.
+func (s *sniffer) unanswered() SniffEvent {
+	e := *s.query
+	e.Err = fmt.Errorf("%w: query sent at %s left unanswered", ErrTimeout, e.Time.Format(time.RFC3339Nano))
+	s.query = nil
+	return e
+}
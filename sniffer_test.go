@@ -0,0 +1,174 @@
+package zh07
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// line is a serial line whose chunks are sent by the test, each read
+// returning one. Sending nil unplugs it and closing it ends it with io.EOF.
+type line chan []byte
+
+func (l line) Read(b []byte) (int, error) {
+	c, ok := <-l
+	switch {
+	case !ok:
+		return 0, io.EOF
+	case c == nil:
+		return 0, errors.New("unplugged")
+	}
+	return copy(b, c), nil
+}
+
+// nextEvent returns the next event, failing the test if none comes.
+func nextEvent(t *testing.T, events <-chan SniffEvent) SniffEvent {
+	t.Helper()
+
+	select {
+	case e, ok := <-events:
+		assert.True(t, ok, "channel closed")
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+		return SniffEvent{}
+	}
+}
+
+func TestSniff(t *testing.T) {
+	var (
+		clock          = NewFakeClock(epoch)
+		txl, rxl       = make(line), make(line)
+		events         = Sniff(context.Background(), txl, rxl, &SnifferConfig{Clock: clock})
+		want           = &Reading{PM1: 0x65, PM25: 0x85, PM10: 0x96}
+		tx             = func(b []byte) { txl <- b }
+		rx             = func(b []byte) { rxl <- b }
+		ms             = time.Millisecond
+		receivedAt     = func(d time.Duration) time.Time { return epoch.Add(d) }
+		assertReceived = func(e SniffEvent, dir Direction, at time.Duration) {
+			t.Helper()
+			assert.Equal(t, dir, e.Direction)
+			assert.Equal(t, receivedAt(at), e.Time)
+		}
+	)
+
+	// mode switch
+	tx(commandSetQAMode)
+	e := nextEvent(t, events)
+	assertReceived(e, TX, 0)
+	assert.Equal(t, "set question and answer mode", e.Command)
+	assert.NoError(t, e.Err)
+
+	// query and its answer, in two chunks
+	clock.Advance(250 * ms)
+	tx(commandQuery)
+	e = nextEvent(t, events)
+	assert.Equal(t, "query", e.Command)
+	clock.Advance(20 * ms)
+	rx(sampleQAPayload[:3])
+	rx(sampleQAPayload[3:])
+	e = nextEvent(t, events)
+	assertReceived(e, RX, 270*ms)
+	assert.Equal(t, want, e.Reading)
+	assert.Equal(t, 20*ms, e.Latency)
+	assert.Equal(t, "answer: PM1.0=101 PM2.5=133 PM10=150, checksum ok", e.Label)
+
+	// a query left unanswered
+	tx(commandQuery)
+	nextEvent(t, events)
+	clock.Advance(time.Second)
+	tx(commandQuery)
+	e = nextEvent(t, events)
+	assertReceived(e, TX, 270*ms)
+	assert.ErrorIs(t, e.Err, ErrTimeout)
+	assert.Equal(t, "query", nextEvent(t, events).Command)
+
+	// an answer with a bad checksum
+	clock.Advance(20 * ms)
+	rx(sampleQABadChecksum)
+	e = nextEvent(t, events)
+	assert.ErrorIs(t, e.Err, ErrChecksumMismatch)
+	assert.Nil(t, e.Reading)
+	assert.Equal(t, 20*ms, e.Latency, "still paired with its query")
+
+	// an answer after the reply timeout is not paired
+	tx(commandQuery)
+	nextEvent(t, events)
+	clock.Advance(2 * time.Second)
+	rx(sampleQAPayload)
+	assert.ErrorIs(t, nextEvent(t, events).Err, ErrTimeout)
+	e = nextEvent(t, events)
+	assert.Equal(t, want, e.Reading)
+	assert.Zero(t, e.Latency)
+
+	// initiative upload frames and noise
+	tx(commandSetInitiativeUploadMode)
+	assert.Equal(t, "set initiative upload mode", nextEvent(t, events).Command)
+	rx([]byte{0x13, 0x37})
+	e = nextEvent(t, events)
+	assert.ErrorIs(t, e.Err, ErrInvalidFrame)
+	assert.Equal(t, "2 stray bytes", e.Label)
+	rx(sampleInitiativePayload)
+	e = nextEvent(t, events)
+	assert.Equal(t, &Reading{PM1: 0x54, PM25: 0x6E, PM10: 0x7C}, e.Reading)
+	assert.Zero(t, e.Latency)
+
+	// unknown command
+	tx([]byte{0xFF, 0x01, 0x99, 0x00, 0x00, 0x00, 0x00, 0x00, 0x66})
+	e = nextEvent(t, events)
+	assert.ErrorIs(t, e.Err, ErrInvalidFrame)
+	assert.Empty(t, e.Command)
+
+	// a query and the start of a frame are flushed when the lines close
+	tx(commandQuery)
+	nextEvent(t, events)
+	rx(sampleQAPayload[:5])
+	close(txl)
+	rx(nil)
+
+	e = nextEvent(t, events)
+	assert.ErrorIs(t, e.Err, ErrSensorCommunication)
+	assert.Contains(t, e.Err.Error(), "RX line: unplugged")
+	e = nextEvent(t, events)
+	assert.Equal(t, "incomplete, 5 bytes", e.Label)
+	assert.ErrorIs(t, nextEvent(t, events).Err, ErrTimeout)
+	_, ok := <-events
+	assert.False(t, ok, "closed once both lines are")
+}
+
+func TestSniff_Plantower(t *testing.T) {
+	var (
+		clock    = NewFakeClock(epoch)
+		txl, rxl = make(line), make(line)
+		events   = Sniff(context.Background(), txl, rxl, &SnifferConfig{Model: ModelPMS5003, Clock: clock})
+		counts   = ParticleCounts{Gt03: 900, Gt05: 250}
+	)
+
+	txl <- plantowerCommandRead
+	assert.Equal(t, "query", nextEvent(t, events).Command)
+
+	clock.Advance(30 * time.Millisecond)
+	rxl <- plantowerFrame(5, 8, 11, counts)
+	e := nextEvent(t, events)
+	assert.Equal(t, &Reading{PM1: 5, PM25: 8, PM10: 11, Counts: counts}, e.Reading)
+	assert.Equal(t, 30*time.Millisecond, e.Latency)
+}
+
+func TestSniff_Cancel(t *testing.T) {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		events      = Sniff(ctx, make(line), make(line), nil)
+	)
+
+	cancel()
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("the channel is not closed")
+	}
+}
@@ -0,0 +1,44 @@
+package zh07
+
+import (
+	"context"
+	"errors"
+)
+
+// stream calls read in a loop and sends the results on the returned channel
+// until ctx is cancelled or read fails with anything but a bad reading. A
+// pending read is not interrupted by ctx unless read observes it, the loop
+// stops once it returns.
+func stream(ctx context.Context, read func(ctx context.Context) (*Reading, error)) <-chan Result {
+	ch := make(chan Result)
+
+	go func() {
+		defer close(ch)
+
+		for ctx.Err() == nil {
+			r, err := read(ctx)
+			if r == nil && err == nil {
+				continue // resynchronising with the frames
+			}
+
+			select {
+			case ch <- Result{Reading: r, Err: err}:
+			case <-ctx.Done():
+				return
+			}
+
+			if err != nil && !badReading(err) {
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// badReading reports whether err only concerns the data received, so the
+// next reading may succeed.
+func badReading(err error) bool {
+	return errors.Is(err, ErrChecksumMismatch) || errors.Is(err, ErrInvalidFrame) ||
+		errors.Is(err, ErrOutlier) || errors.Is(err, ErrTimeout)
+}
@@ -0,0 +1,204 @@
+package zh07
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A capture is a text file with a line per chunk of bytes written to or read
+// from the sensor:
+//
+//	# zh07 capture started 2025-06-17T12:00:00Z
+//	0 TX FF0186000000000079
+//	251000000 RX FF86008500960065FA
+//
+// Each line holds the time since the capture started in nanoseconds, TX for
+// bytes written to the sensor or RX for bytes read from it, and the bytes in
+// hexadecimal. Blank lines and lines starting with # are ignored.
+
+// Direction tells whether bytes were written to or read from the sensor.
+type Direction int
+
+const (
+	// TX is for bytes written to the sensor
+	TX Direction = iota
+	// RX is for bytes read from the sensor
+	RX
+)
+
+// String returns TX or RX.
+func (d Direction) String() string {
+	switch d {
+	case TX:
+		return "TX"
+	case RX:
+		return "RX"
+	default:
+		return fmt.Sprintf("Direction(%d)", int(d))
+	}
+}
+
+// CaptureRecord is a chunk of bytes written to or read from the sensor.
+type CaptureRecord struct {
+	Offset    time.Duration // time since the capture started
+	Direction Direction
+	Data      []byte
+}
+
+// String returns the record as a line of a capture, without the newline.
+func (r CaptureRecord) String() string {
+	return fmt.Sprintf("%d %s %X", r.Offset.Nanoseconds(), r.Direction, r.Data)
+}
+
+// ReadCapture parses a capture.
+func ReadCapture(r io.Reader) ([]CaptureRecord, error) {
+	var (
+		records []CaptureRecord
+		s       = bufio.NewScanner(r)
+		line    int
+	)
+
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		line++
+		l := strings.TrimSpace(s.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+
+		f := strings.Fields(l)
+		if len(f) != 3 {
+			return nil, fmt.Errorf("%w: line %d: expected time, direction and data", ErrInvalidCapture, line)
+		}
+
+		ns, err := strconv.ParseInt(f[0], 10, 64)
+		if err != nil || ns < 0 {
+			return nil, fmt.Errorf("%w: line %d: invalid time %q", ErrInvalidCapture, line, f[0])
+		}
+
+		var d Direction
+		switch f[1] {
+		case "TX":
+			d = TX
+		case "RX":
+			d = RX
+		default:
+			return nil, fmt.Errorf("%w: line %d: invalid direction %q", ErrInvalidCapture, line, f[1])
+		}
+
+		data, err := hex.DecodeString(f[2])
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidCapture, line, err)
+		}
+
+		records = append(records, CaptureRecord{Offset: time.Duration(ns), Direction: d, Data: data})
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCapture, err)
+	}
+
+	return records, nil
+}
+
+// TapConfig holds configuration options for a Tap.
+type TapConfig struct {
+	// Clock timestamps the records, SystemClock if nil. The offsets use the
+	// monotonic clock reading when the clock provides one, as time.Now does.
+	Clock Clock
+}
+
+// Tap wraps the transport to a sensor and records every byte written to and
+// read from it into a capture, see ReadCapture for the format. Failing to
+// write the capture does not affect the transport, see Err.
+type Tap struct {
+	rw    io.ReadWriter
+	clock Clock
+	start time.Time
+
+	mu      sync.Mutex
+	capture io.Writer
+	err     error
+}
+
+// NewTap creates a new Tap around rw, writing the capture to capture.
+func NewTap(rw io.ReadWriter, capture io.Writer, config *TapConfig) *Tap {
+	if config == nil {
+		config = &TapConfig{}
+	}
+
+	if config.Clock == nil {
+		config.Clock = SystemClock
+	}
+
+	t := &Tap{
+		rw:      rw,
+		clock:   config.Clock,
+		start:   config.Clock.Now(),
+		capture: capture,
+	}
+	t.write(fmt.Sprintf("# zh07 capture started %s\n", t.start.UTC().Format(time.RFC3339Nano)))
+
+	return t
+}
+
+// Read reads from the transport and records the bytes read.
+func (t *Tap) Read(b []byte) (int, error) {
+	n, err := t.rw.Read(b)
+	if n > 0 {
+		t.record(RX, b[:n])
+	}
+	return n, err
+}
+
+// Write writes to the transport and records the bytes written.
+func (t *Tap) Write(b []byte) (int, error) {
+	n, err := t.rw.Write(b)
+	if n > 0 {
+		t.record(TX, b[:n])
+	}
+	return n, err
+}
+
+// Close closes the transport if it is an io.Closer. The capture is left open.
+func (t *Tap) Close() error {
+	if c, ok := t.rw.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Err returns the first error writing the capture, if any.
+func (t *Tap) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.err
+}
+
+// record appends a record to the capture. The time is taken under the lock
+// so that records are written in order.
+func (t *Tap) record(d Direction, b []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r := CaptureRecord{Offset: t.clock.Now().Sub(t.start), Direction: d, Data: b}
+	t.write(r.String() + "\n")
+}
+
+// write writes s to the capture, unless a previous write failed. The caller
+// must hold t.mu, or be the only one using the tap.
+func (t *Tap) write(s string) {
+	if t.err != nil {
+		return
+	}
+	if _, err := io.WriteString(t.capture, s); err != nil {
+		t.err = err
+	}
+}
@@ -0,0 +1,110 @@
+package zh07
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestTap(t *testing.T) {
+	var (
+		clock   = NewFakeClock(epoch)
+		port    = &sensorPort{clock: clock, latency: 20 * time.Millisecond}
+		capture bytes.Buffer
+		tap     = NewTap(port, &capture, &TapConfig{Clock: clock})
+	)
+
+	clock.Advance(time.Second)
+	z := NewZH07q(&Config{
+		RW:     bufio.NewReadWriter(bufio.NewReader(tap), bufio.NewWriter(tap)),
+		WarmUp: -1,
+		Clock:  clock,
+		Closer: tap,
+	})
+	r, err := z.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, &Reading{PM1: 0x65, PM25: 0x85, PM10: 0x96}, r)
+	assert.NoError(t, z.Close(context.Background()))
+
+	assert.Equal(t, "# zh07 capture started 2025-06-17T10:00:00Z\n"+
+		"1000000000 TX FF0186000000000079\n"+
+		"1270000000 RX FF86008500960065FA\n", capture.String(),
+		"the answer is read after the post-write delay and the latency")
+	assert.True(t, port.closed, "closing the tap closes the transport")
+	assert.NoError(t, tap.Err())
+
+	records, err := ReadCapture(&capture)
+	assert.NoError(t, err)
+	assert.Equal(t, []CaptureRecord{
+		{Offset: time.Second, Direction: TX, Data: commandQuery},
+		{Offset: 1270 * time.Millisecond, Direction: RX, Data: sampleQAPayload},
+	}, records)
+}
+
+func TestTap_Err(t *testing.T) {
+	port := &sensorPort{clock: NewFakeClock(epoch)}
+	tap := NewTap(port, failingWriter{}, nil)
+
+	n, err := tap.Write(commandQuery)
+	assert.NoError(t, err, "the transport is not affected")
+	assert.Equal(t, 9, n)
+	assert.EqualError(t, tap.Err(), "disk full")
+}
+
+func TestReadCapture(t *testing.T) {
+	tests := []struct {
+		name    string
+		capture string
+		want    []CaptureRecord
+		wantErr string
+	}{
+		{
+			name:    "comments",
+			capture: "# zh07 capture\n\n  # indented\n5 RX 00ff\n",
+			want:    []CaptureRecord{{Offset: 5, Direction: RX, Data: []byte{0x00, 0xFF}}},
+		},
+		{
+			name:    "fields",
+			capture: "0 TX\n",
+			wantErr: "invalid capture: line 1: expected time, direction and data",
+		},
+		{
+			name:    "time",
+			capture: "# header\n-1 TX FF\n",
+			wantErr: `invalid capture: line 2: invalid time "-1"`,
+		},
+		{
+			name:    "direction",
+			capture: "0 XX FF\n",
+			wantErr: `invalid capture: line 1: invalid direction "XX"`,
+		},
+		{
+			name:    "data",
+			capture: "0 TX FG\n",
+			wantErr: "invalid capture: line 1: encoding/hex: invalid byte: U+0047 'G'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadCapture(strings.NewReader(tt.capture))
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.ErrorIs(t, err, ErrInvalidCapture)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package zh07
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultWarmUp is the stabilisation time given by the datasheet.
+const defaultWarmUp = 30 * time.Second
+
+// warmup tracks the stabilisation period that follows power-up, leaving dormancy
+// or changing the communication mode. It is embedded by the sensor types, which
+// makes its exported methods part of their API.
+type warmup struct {
+	duration time.Duration
+	clk      Clock
+
+	mu    sync.Mutex
+	since time.Time
+}
+
+// setup sets the length of the stabilisation period and starts it right away.
+func (w *warmup) setup(d time.Duration) {
+	switch {
+	case d == 0:
+		d = defaultWarmUp
+	case d < 0:
+		d = 0
+	}
+
+	w.duration = d
+	w.restart()
+}
+
+// restart starts a new stabilisation period.
+func (w *warmup) restart() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.since = w.clock().Now()
+}
+
+// clock returns the clock, the system clock if none was set.
+func (w *warmup) clock() Clock {
+	if w.clk == nil {
+		return SystemClock
+	}
+	return w.clk
+}
+
+// ReadyAt returns the time at which the current stabilisation period ends.
+func (w *warmup) ReadyAt() time.Time {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.since.Add(w.duration)
+}
+
+// WarmingUp reports whether the sensor is still within its stabilisation period.
+// Readings taken meanwhile carry FlagWarmingUp.
+func (w *warmup) WarmingUp() bool {
+	return w.clock().Now().Before(w.ReadyAt())
+}
+
+// WaitReady blocks until the stabilisation period is over or ctx is done, in
+// which case it returns the context's error.
+func (w *warmup) WaitReady(ctx context.Context) error {
+	for {
+		d := w.ReadyAt().Sub(w.clock().Now())
+		if d <= 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-w.clock().After(d):
+			// the period may have been restarted meanwhile, check again
+		}
+	}
+}
+
+// flag marks r as taken during warm-up when appropriate.
+func (w *warmup) flag(r *Reading) {
+	if r != nil && w.WarmingUp() {
+		r.Flags |= FlagWarmingUp
+	}
+}
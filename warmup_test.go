@@ -0,0 +1,132 @@
+package zh07
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_warmup(t *testing.T) {
+	var (
+		clock = NewFakeClock(epoch)
+		w     = &warmup{clk: clock}
+	)
+
+	w.setup(10 * time.Second)
+	assert.True(t, w.WarmingUp())
+	assert.Equal(t, epoch.Add(10*time.Second), w.ReadyAt())
+
+	clock.Advance(10 * time.Second)
+	assert.False(t, w.WarmingUp())
+
+	w.restart()
+	assert.True(t, w.WarmingUp())
+
+	r := &Reading{}
+	w.flag(r)
+	assert.Equal(t, FlagWarmingUp, r.Flags)
+	w.flag(nil)
+
+	w.setup(-1)
+	assert.False(t, w.WarmingUp())
+
+	w.setup(0)
+	assert.Equal(t, defaultWarmUp, w.duration)
+}
+
+func Test_warmup_WaitReady(t *testing.T) {
+	w := &warmup{}
+
+	w.setup(20 * time.Millisecond)
+	assert.NoError(t, w.WaitReady(context.Background()))
+	assert.False(t, w.WarmingUp())
+	assert.NoError(t, w.WaitReady(context.Background()), "returns right away once ready")
+
+	w.setup(time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, w.WaitReady(ctx), context.DeadlineExceeded)
+}
+
+func TestZH07i_WarmUp(t *testing.T) {
+	tests := []struct {
+		name   string
+		warmUp time.Duration
+		want   QualityFlag
+	}{
+		{name: "warming-up", warmUp: 0, want: FlagWarmingUp},
+		{name: "disabled", warmUp: -1, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z := NewZH07i(&Config{
+				RW:     bufio.NewReadWriter(bufio.NewReader(bytes.NewReader(sampleInitiativePayload)), nil),
+				WarmUp: tt.warmUp,
+			})
+
+			r, err := z.Read()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, r.Flags)
+		})
+	}
+}
+
+func TestZH07q_WarmUp(t *testing.T) {
+	z := NewZH07q(&Config{WarmUp: time.Hour})
+	z.writeAndRead = func(_ *bufio.ReadWriter, _ []byte) ([]byte, error) {
+		return sampleQAPayload, nil
+	}
+
+	r, err := z.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, FlagWarmingUp, r.Flags)
+}
+
+// sleeper is implemented by both sensor types.
+type sleeper interface {
+	Sleep() error
+	Wake() error
+	WarmingUp() bool
+}
+
+func TestSleepWake(t *testing.T) {
+	var (
+		sent    [][]byte
+		failing bool
+		write   = func(_ *bufio.ReadWriter, c []byte) error {
+			if failing {
+				return fmt.Errorf("test error from write")
+			}
+			sent = append(sent, c)
+			return nil
+		}
+		zi = NewZH07i(&Config{WarmUp: -1, PostWriteDelay: -1})
+		zq = NewZH07q(&Config{WarmUp: -1, PostWriteDelay: -1})
+	)
+	zi.write = write
+	zq.write = write
+
+	for _, z := range []sleeper{zi, zq} {
+		sent, failing = nil, false
+
+		assert.NoError(t, z.Sleep())
+		assert.NoError(t, z.Wake())
+		assert.Equal(t, [][]byte{commandDormantEnter, commandDormantQuit}, sent)
+
+		failing = true
+		assert.Error(t, z.Sleep())
+		assert.Error(t, z.Wake())
+	}
+
+	zq.setup(time.Hour)
+	zq.since = time.Time{}
+	assert.False(t, zq.WarmingUp())
+	failing = false
+	assert.NoError(t, zq.Wake())
+	assert.True(t, zq.WarmingUp(), "waking up restarts the stabilisation period")
+}
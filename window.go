@@ -0,0 +1,275 @@
+package zh07
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	defaultWindowSize       = time.Minute
+	defaultWindowMaxSamples = 4096
+)
+
+// Stats summarises the samples of a single PM channel over a window.
+type Stats struct {
+	Count  int     // number of samples in the window
+	Mean   float64 // arithmetic mean [μg/m³]
+	Median float64 // 50th percentile [μg/m³]
+	Min    float64 // lowest sample [μg/m³]
+	Max    float64 // highest sample [μg/m³]
+	StdDev float64 // population standard deviation [μg/m³]
+	// Percentiles maps each configured percentile (0-100) to its value [μg/m³]
+	Percentiles map[float64]float64
+}
+
+// WindowStats holds the statistics of every PM channel for the window [Start, End).
+type WindowStats struct {
+	Start time.Time
+	End   time.Time
+	PM1   Stats
+	PM25  Stats
+	PM10  Stats
+}
+
+// AggregatorConfig holds configuration options for an Aggregator.
+type AggregatorConfig struct {
+	// Size is the length of each window, one minute if zero
+	Size time.Duration
+	// Step is the distance between the start of consecutive windows. Zero, or a
+	// value equal to Size, produces tumbling windows; a smaller value produces
+	// sliding windows that overlap.
+	Step time.Duration
+	// MaxSamples bounds the number of samples kept in memory, 4096 if zero. When
+	// the limit is reached the oldest sample is discarded.
+	MaxSamples int
+	// Percentiles lists the percentiles (0-100) reported for every channel
+	Percentiles []float64
+}
+
+// sample is a reading stored by the Aggregator along with its arrival time.
+type sample struct {
+	at   time.Time
+	pm1  int
+	pm25 int
+	pm10 int
+}
+
+// Aggregator groups readings into time windows and computes statistics for them.
+//
+// Windows are aligned to multiples of the step, so samples arriving at irregular
+// intervals, as they do from a ZH07i stream or a polled ZH07q, always land in
+// the same windows regardless of when the aggregator was started. A window is
+// emitted once a sample at or after its end is added, or when Flush is called.
+// Empty windows are never emitted.
+//
+// An Aggregator is not safe for concurrent use.
+type Aggregator struct {
+	size        time.Duration
+	step        time.Duration
+	percentiles []float64
+	ring        []sample
+	head        int
+	count       int
+	next        time.Time // end of the next window to be emitted
+	dropped     int
+	scratch     [3][]float64
+}
+
+// NewAggregator creates a new Aggregator.
+func NewAggregator(config *AggregatorConfig) *Aggregator {
+	if config == nil {
+		config = &AggregatorConfig{}
+	}
+
+	if config.Size <= 0 {
+		config.Size = defaultWindowSize
+	}
+
+	if config.Step <= 0 || config.Step > config.Size {
+		config.Step = config.Size
+	}
+
+	if config.MaxSamples <= 0 {
+		config.MaxSamples = defaultWindowMaxSamples
+	}
+
+	return &Aggregator{
+		size:        config.Size,
+		step:        config.Step,
+		percentiles: append([]float64(nil), config.Percentiles...),
+		ring:        make([]sample, config.MaxSamples),
+	}
+}
+
+// Add records a reading taken at the given time and returns the windows
+// completed by it, oldest first. Nil readings are ignored, as are readings older
+// than the start of the oldest window still open.
+func (a *Aggregator) Add(at time.Time, r *Reading) []WindowStats {
+	if r == nil {
+		return nil
+	}
+
+	if a.next.IsZero() {
+		a.next = a.firstEnd(at)
+	}
+
+	if at.Before(a.next.Add(-a.size)) {
+		a.dropped++
+		return nil
+	}
+
+	var out []WindowStats
+	for !at.Before(a.next) {
+		if w, ok := a.window(); ok {
+			out = append(out, w)
+		}
+		a.advance()
+
+		// nothing left in memory, jump straight to the window holding this sample
+		if a.count == 0 && !at.Before(a.next) {
+			a.next = a.firstEnd(at)
+		}
+	}
+
+	a.push(sample{at: at, pm1: r.PM1, pm25: r.PM25, pm10: r.PM10})
+
+	return out
+}
+
+// Flush returns every window that still holds samples, including partial ones,
+// and resets the aggregator.
+func (a *Aggregator) Flush() []WindowStats {
+	var out []WindowStats
+	for a.count > 0 {
+		if w, ok := a.window(); ok {
+			out = append(out, w)
+		}
+		a.advance()
+	}
+	a.next = time.Time{}
+
+	return out
+}
+
+// Dropped returns how many samples were discarded, either because they arrived
+// too late or because MaxSamples was exceeded.
+func (a *Aggregator) Dropped() int {
+	return a.dropped
+}
+
+// firstEnd returns the end of the earliest step-aligned window that ends after at.
+func (a *Aggregator) firstEnd(at time.Time) time.Time {
+	return at.Truncate(a.step).Add(a.step)
+}
+
+// push appends a sample to the ring, overwriting the oldest one when it is full.
+func (a *Aggregator) push(s sample) {
+	if a.count == len(a.ring) {
+		a.ring[a.head] = s
+		a.head = (a.head + 1) % len(a.ring)
+		a.dropped++
+		return
+	}
+	a.ring[(a.head+a.count)%len(a.ring)] = s
+	a.count++
+}
+
+// advance moves to the next window and evicts samples that no longer belong to it.
+func (a *Aggregator) advance() {
+	a.next = a.next.Add(a.step)
+	start := a.next.Add(-a.size)
+	for a.count > 0 && a.ring[a.head].at.Before(start) {
+		a.head = (a.head + 1) % len(a.ring)
+		a.count--
+	}
+}
+
+// window computes the statistics for the window ending at a.next.
+func (a *Aggregator) window() (WindowStats, bool) {
+	var (
+		start = a.next.Add(-a.size)
+		pm1   = a.scratch[0][:0]
+		pm25  = a.scratch[1][:0]
+		pm10  = a.scratch[2][:0]
+	)
+
+	for i := 0; i < a.count; i++ {
+		s := a.ring[(a.head+i)%len(a.ring)]
+		if s.at.Before(start) || !s.at.Before(a.next) {
+			continue
+		}
+		pm1 = append(pm1, float64(s.pm1))
+		pm25 = append(pm25, float64(s.pm25))
+		pm10 = append(pm10, float64(s.pm10))
+	}
+	a.scratch = [3][]float64{pm1, pm25, pm10}
+
+	if len(pm1) == 0 {
+		return WindowStats{}, false
+	}
+
+	return WindowStats{
+		Start: start,
+		End:   a.next,
+		PM1:   computeStats(pm1, a.percentiles),
+		PM25:  computeStats(pm25, a.percentiles),
+		PM10:  computeStats(pm10, a.percentiles),
+	}, true
+}
+
+// computeStats sorts values in place and summarises them.
+func computeStats(values []float64, percentiles []float64) Stats {
+	s := Stats{Count: len(values)}
+	if s.Count == 0 {
+		return s
+	}
+
+	sort.Float64s(values)
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	s.Mean = sum / float64(s.Count)
+
+	var sq float64
+	for _, v := range values {
+		sq += (v - s.Mean) * (v - s.Mean)
+	}
+	s.StdDev = math.Sqrt(sq / float64(s.Count))
+
+	s.Min = values[0]
+	s.Max = values[s.Count-1]
+	s.Median = percentile(values, 50)
+
+	if len(percentiles) > 0 {
+		s.Percentiles = make(map[float64]float64, len(percentiles))
+		for _, p := range percentiles {
+			s.Percentiles[p] = percentile(values, p)
+		}
+	}
+
+	return s
+}
+
+// percentile returns the p-th percentile (0-100) of sorted values using linear
+// interpolation between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	switch {
+	case len(sorted) == 0:
+		return 0
+	case p <= 0:
+		return sorted[0]
+	case p >= 100:
+		return sorted[len(sorted)-1]
+	}
+
+	var (
+		rank = p / 100 * float64(len(sorted)-1)
+		lo   = int(math.Floor(rank))
+		hi   = int(math.Ceil(rank))
+	)
+
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo))
+}
@@ -0,0 +1,128 @@
+package zh07
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var epoch = time.Date(2025, 6, 17, 10, 0, 0, 0, time.UTC)
+
+func TestAggregator_Tumbling(t *testing.T) {
+	var (
+		a = NewAggregator(&AggregatorConfig{
+			Size:        time.Minute,
+			Percentiles: []float64{90},
+		})
+		got []WindowStats
+	)
+
+	for i, v := range []int{10, 20, 30, 40} {
+		got = append(got, a.Add(epoch.Add(time.Duration(i)*15*time.Second), &Reading{PM1: v, PM25: v * 2, PM10: v * 3})...)
+	}
+	assert.Empty(t, got, "no window should be complete yet")
+
+	got = a.Add(epoch.Add(time.Minute), &Reading{PM1: 100, PM25: 100, PM10: 100})
+	if assert.Len(t, got, 1) {
+		w := got[0]
+		assert.Equal(t, epoch, w.Start)
+		assert.Equal(t, epoch.Add(time.Minute), w.End)
+		assert.Equal(t, 4, w.PM1.Count)
+		assert.Equal(t, 25.0, w.PM1.Mean)
+		assert.Equal(t, 25.0, w.PM1.Median)
+		assert.Equal(t, 10.0, w.PM1.Min)
+		assert.Equal(t, 40.0, w.PM1.Max)
+		assert.InDelta(t, 11.1803, w.PM1.StdDev, 0.0001)
+		assert.InDelta(t, 37.0, w.PM1.Percentiles[90], 0.0001)
+		assert.Equal(t, 50.0, w.PM25.Mean)
+		assert.Equal(t, 120.0, w.PM10.Max)
+	}
+
+	got = a.Flush()
+	if assert.Len(t, got, 1) {
+		assert.Equal(t, 1, got[0].PM25.Count)
+		assert.Equal(t, 100.0, got[0].PM25.Mean)
+	}
+	assert.Empty(t, a.Flush())
+}
+
+func TestAggregator_Sliding(t *testing.T) {
+	var (
+		a = NewAggregator(&AggregatorConfig{
+			Size: time.Minute,
+			Step: 30 * time.Second,
+		})
+		got []WindowStats
+	)
+
+	for i := 0; i < 6; i++ {
+		got = append(got, a.Add(epoch.Add(time.Duration(i)*20*time.Second), &Reading{PM25: i})...)
+	}
+
+	// samples at 0s, 20s, 40s, 60s, 80s, 100s
+	if assert.Len(t, got, 3) {
+		assert.Equal(t, []time.Time{epoch.Add(-30 * time.Second), epoch, epoch.Add(30 * time.Second)},
+			[]time.Time{got[0].Start, got[1].Start, got[2].Start})
+		assert.Equal(t, []int{2, 3, 3},
+			[]int{got[0].PM25.Count, got[1].PM25.Count, got[2].PM25.Count})
+		assert.Equal(t, 1.0, got[1].PM25.Mean)
+	}
+}
+
+func TestAggregator_IrregularSamples(t *testing.T) {
+	a := NewAggregator(&AggregatorConfig{Size: time.Minute})
+
+	assert.Empty(t, a.Add(epoch.Add(5*time.Second), &Reading{PM25: 1}))
+	assert.Empty(t, a.Add(epoch.Add(3*time.Second), &Reading{PM25: 3}), "out of order sample within the open window")
+	assert.Empty(t, a.Add(epoch.Add(-2*time.Minute), &Reading{PM25: 3}), "late sample")
+	assert.Empty(t, a.Add(epoch, nil))
+	assert.Equal(t, 1, a.Dropped())
+
+	// a long gap emits the pending window only, empty windows are skipped
+	got := a.Add(epoch.Add(10*time.Minute+time.Second), &Reading{PM25: 7})
+	if assert.Len(t, got, 1) {
+		assert.Equal(t, 2, got[0].PM25.Count)
+		assert.Equal(t, 2.0, got[0].PM25.Mean)
+	}
+
+	got = a.Flush()
+	if assert.Len(t, got, 1) {
+		assert.Equal(t, epoch.Add(10*time.Minute), got[0].Start)
+	}
+}
+
+func TestAggregator_MaxSamples(t *testing.T) {
+	a := NewAggregator(&AggregatorConfig{Size: time.Hour, MaxSamples: 3})
+
+	for i := 0; i < 5; i++ {
+		a.Add(epoch.Add(time.Duration(i)*time.Second), &Reading{PM10: i})
+	}
+
+	got := a.Flush()
+	if assert.Len(t, got, 1) {
+		assert.Equal(t, 3, got[0].PM10.Count)
+		assert.Equal(t, 2.0, got[0].PM10.Min)
+	}
+	assert.Equal(t, 2, a.Dropped())
+}
+
+func Test_percentile(t *testing.T) {
+	values := []float64{1, 2, 3, 4}
+
+	tests := []struct {
+		p    float64
+		want float64
+	}{
+		{p: -1, want: 1},
+		{p: 0, want: 1},
+		{p: 50, want: 2.5},
+		{p: 100, want: 4},
+		{p: 150, want: 4},
+	}
+	for _, tt := range tests {
+		assert.Equalf(t, tt.want, percentile(values, tt.p), "percentile %v", tt.p)
+	}
+
+	assert.Equal(t, 0.0, percentile(nil, 50))
+}
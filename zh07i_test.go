@@ -4,7 +4,10 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 const (
@@ -76,19 +79,15 @@ func TestZH07i_Init(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			var (
-				b = &bytes.Buffer{}
-				z = NewZH07i(&Config{
-					RW: bufio.NewReadWriter(bufio.NewReader(b), bufio.NewWriter(b)),
-				})
-			)
+			z := NewZH07i(&Config{
+				RW:    newResponder(commandSetInitiativeUploadMode, []byte{0x01, 0x02, 0x03}),
+				Clock: NewFakeClock(epoch),
+			})
 
 			if tt.before != nil {
 				tt.before(z)
 			}
 
-			go dummyCommandResponder(t, z.rw, commandSetInitiativeUploadMode, []byte{0x01, 0x02, 0x03})
-
 			if err := z.Init(); (err != nil) != tt.wantErr {
 				t.Errorf("ZH07q.Init() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -97,7 +96,7 @@ func TestZH07i_Init(t *testing.T) {
 }
 
 func TestZH07i_CalculateChecksum(t *testing.T) {
-	var z *ZH07i = &ZH07i{data: sampleInitiativePayload}
+	var z *ZH07i = &ZH07i{driver: driver{data: sampleInitiativePayload}}
 	if cs := z.CalculateChecksum(); cs != z.getChecksum() {
 		t.Errorf("TestCalculateChecksumInitiative, got %d, expected %d", cs, checksum)
 	}
@@ -126,7 +125,7 @@ func TestZH07i_IsReadingInvalid(t *testing.T) {
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			z := &ZH07i{data: tt.data}
+			z := &ZH07i{driver: driver{data: tt.data}}
 			if got := z.IsReadingValid(); got != tt.want {
 				t.Errorf("ZH07i.IsReadingValid() = %v, want %v", got, tt.want)
 			}
@@ -181,6 +180,14 @@ func TestZH07i_Read(t *testing.T) {
 					hasError(true),
 				),
 			},
+			{
+				name: "fail-checksum-mismatch",
+				data: sampleInitiativeBadChecksum,
+				checks: check(
+					isChecksumMismatch,
+					isNil,
+				),
+			},
 		}
 	)
 	for _, tt := range tests {
@@ -202,9 +209,130 @@ func TestZH07i_Read(t *testing.T) {
 	}
 }
 
+// chunkReader returns one chunk per read, like a serial port delivering a
+// frame in pieces.
+type chunkReader struct {
+	chunks [][]byte
+}
+
+func (c *chunkReader) Read(b []byte) (int, error) {
+	if len(c.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, c.chunks[0])
+	if c.chunks[0] = c.chunks[0][n:]; len(c.chunks[0]) == 0 {
+		c.chunks = c.chunks[1:]
+	}
+	return n, nil
+}
+
+func TestZH07i_ReadSplitHeader(t *testing.T) {
+	// a second frame with other concentrations, split right after the start
+	// characters: the length bytes must not be taken from the first frame
+	next := append([]byte(nil), sampleInitiativePayload...)
+	next[11], next[13], next[15] = 0x10, 0x20, 0x30
+	cs := frameChecksum(next)
+	next[30], next[31] = byte(cs>>8), byte(cs)
+
+	z := NewZH07i(&Config{
+		RW: bufio.NewReadWriter(bufio.NewReader(&chunkReader{chunks: [][]byte{
+			sampleInitiativePayload, next[:2], next[2:],
+		}}), nil),
+		WarmUp: -1,
+	})
+
+	got, err := z.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, &Reading{PM1: 0x54, PM25: 0x6E, PM10: 0x7C}, got)
+
+	got, err = z.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, &Reading{PM1: 0x10, PM25: 0x20, PM10: 0x30}, got)
+	assert.True(t, z.IsReadingValid())
+}
+
 func TestZH07i_getChecksum(t *testing.T) {
-	var z *ZH07i = &ZH07i{data: sampleInitiativePayload}
+	var z *ZH07i = &ZH07i{driver: driver{data: sampleInitiativePayload}}
 	if cs := z.getChecksum(); cs != checksum {
 		t.Errorf("TestGetChecksumInitiative, got %d, expected %d", cs, checksum)
 	}
 }
+
+// loopPort sends data over and over, starting over on every write: it
+// answers each query, or broadcasts frames, without allocating.
+type loopPort struct {
+	data []byte
+	off  int
+}
+
+func (p *loopPort) Read(b []byte) (int, error) {
+	n := copy(b, p.data[p.off:])
+	p.off = (p.off + n) % len(p.data)
+	return n, nil
+}
+
+func (p *loopPort) Write(b []byte) (int, error) {
+	p.off = 0
+	return len(b), nil
+}
+
+// newLoopConfig returns the configuration of a sensor on a loopPort, with no delays.
+func newLoopConfig(data []byte) *Config {
+	p := &loopPort{data: data}
+	return &Config{
+		RW:             bufio.NewReadWriter(bufio.NewReader(p), bufio.NewWriter(p)),
+		WarmUp:         -1,
+		PostWriteDelay: -1,
+	}
+}
+
+func TestZH07i_ReadInto(t *testing.T) {
+	var (
+		z = NewZH07i(newLoopConfig(sampleInitiativePayload))
+		r Reading
+	)
+
+	ok, err := z.ReadInto(&r)
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	assert.Equal(t, Reading{PM1: 0x54, PM25: 0x6E, PM10: 0x7C}, r)
+	assert.True(t, z.IsReadingValid())
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if ok, err := z.ReadInto(&r); !ok || err != nil {
+			t.Fatal(ok, err)
+		}
+	})
+	assert.Zero(t, allocs)
+
+	z = NewZH07i(newLoopConfig(sampleInitiativeBadChecksum))
+	ok, err = z.ReadInto(&r)
+	assert.False(t, ok)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	assert.False(t, z.IsReadingValid())
+}
+
+func BenchmarkZH07i_Read(b *testing.B) {
+	z := NewZH07i(newLoopConfig(sampleInitiativePayload))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := z.Read(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkZH07i_ReadInto(b *testing.B) {
+	var (
+		z = NewZH07i(newLoopConfig(sampleInitiativePayload))
+		r Reading
+	)
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := z.ReadInto(&r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package zh07
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	// pwmPeriod is the nominal period of the PWM output
+	pwmPeriod = 1004 * time.Millisecond
+	// pwmMargin is the fixed high time at the start of every period, and the
+	// fixed low time at its end
+	pwmMargin = 2 * time.Millisecond
+	// pwmRange is the concentration represented by a full duty cycle [μg/m³]
+	pwmRange = 1000
+	// pwmTolerance is the accepted deviation from the nominal period
+	pwmTolerance = 0.05
+)
+
+var (
+	_ SensorInterface = (*ZH07p)(nil)
+	_ Sensor          = (*ZH07p)(nil)
+	_ Streamer        = (*ZH07p)(nil)
+)
+
+// Edge is a transition of the PWM output.
+type Edge struct {
+	Rising bool          // low to high transition
+	Time   time.Duration // timestamp from a monotonic clock
+}
+
+// EdgeSource produces the edges of the sensor's PWM output, in order.
+type EdgeSource interface {
+	// NextEdge blocks until the next edge arrives
+	NextEdge() (Edge, error)
+}
+
+// ZH07p implements the SensorInterface for the PWM output.
+// Only the PM2.5 concentration is available; PM1.0 and PM10 are always zero.
+type ZH07p struct {
+	warmup
+	lifecycle
+	profile *profile
+	edges   EdgeSource
+	rise    time.Duration // start of the current period
+	fall    time.Duration // end of the high time of the current period
+	primed  bool          // a rising edge was seen
+	high    bool          // the falling edge of the current period was seen
+	valid   bool          // the last period was within tolerance
+}
+
+// NewZH07p creates a new ZH07p sensor instance reading from config.PWM.
+// Models without a PWM output fail with ErrNotSupported.
+func NewZH07p(config *Config) *ZH07p {
+	if config == nil {
+		config = &Config{}
+	}
+
+	z := &ZH07p{
+		profile: profileFor(config.Model),
+		edges:   config.PWM,
+	}
+	z.clk = config.Clock
+	z.setup(config.WarmUp)
+	z.manage(config.Closer, false)
+
+	return z
+}
+
+// Init discards any partial period. The PWM output needs no configuration.
+func (z *ZH07p) Init() error {
+	if err := z.check(); err != nil {
+		return err
+	}
+	if err := z.supported(); err != nil {
+		return err
+	}
+	if z.edges == nil {
+		return fmt.Errorf("%w: no PWM edge source configured", ErrSensorCommunication)
+	}
+	z.primed, z.high = false, false
+
+	return nil
+}
+
+// Capabilities reports what the configured model supports.
+func (z *ZH07p) Capabilities() Capabilities {
+	return z.model().model.Capabilities()
+}
+
+// Info describes the sensor.
+func (z *ZH07p) Info() Info {
+	return Info{Model: z.model().model, Mode: ModePWM, Capabilities: z.Capabilities()}
+}
+
+// Stream sends a reading for every PWM period, see Streamer.
+func (z *ZH07p) Stream(ctx context.Context) <-chan Result {
+	return z.lifecycle.stream(ctx, func(context.Context) (*Reading, error) { return z.Read() })
+}
+
+// Close stops the streams and closes Config.Closer, typically the GPIO line
+// providing the edges. Any later call returns ErrClosed.
+func (z *ZH07p) Close(ctx context.Context) error {
+	return z.shutdown(ctx, nil)
+}
+
+// CalculateChecksum returns 0, the PWM output carries no checksum.
+func (z *ZH07p) CalculateChecksum() int {
+	return 0
+}
+
+// IsReadingValid checks if the last period was within the datasheet tolerance.
+func (z *ZH07p) IsReadingValid() bool {
+	return z.valid
+}
+
+// Read waits for a complete PWM period and converts its duty cycle to PM2.5
+// using the datasheet formula C = 1000 × (TH − 2ms) / (T − 4ms).
+func (z *ZH07p) Read() (*Reading, error) {
+	if err := z.check(); err != nil {
+		return nil, err
+	}
+	if err := z.supported(); err != nil {
+		return nil, err
+	}
+	if z.edges == nil {
+		return nil, fmt.Errorf("%w: no PWM edge source configured", ErrSensorCommunication)
+	}
+
+	for {
+		e, err := z.edges.NextEdge()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSensorCommunication, err)
+		}
+
+		if !e.Rising {
+			if z.primed {
+				z.fall, z.high = e.Time, true
+			}
+			continue
+		}
+
+		var (
+			start = z.rise
+			fall  = z.fall
+			ok    = z.primed && z.high
+		)
+		z.rise, z.primed, z.high = e.Time, true, false
+
+		if !ok {
+			continue
+		}
+
+		r, err := z.decode(fall-start, e.Time-start)
+		if r != nil {
+			z.flag(r)
+		}
+
+		return r, err
+	}
+}
+
+// decode converts the high time and the period of the PWM output into a reading.
+func (z *ZH07p) decode(th, t time.Duration) (*Reading, error) {
+	z.valid = math.Abs(float64(t-pwmPeriod)) <= pwmTolerance*float64(pwmPeriod)
+	if !z.valid {
+		return nil, fmt.Errorf("%w: PWM period %v, expected %v", ErrInvalidFrame, t, pwmPeriod)
+	}
+
+	c := pwmRange * float64(th-pwmMargin) / float64(t-2*pwmMargin)
+	c = math.Max(0, math.Min(pwmRange, c))
+
+	return &Reading{PM25: int(math.Round(c))}, nil
+}
+
+// supported returns ErrNotSupported if the configured model has no PWM output.
+func (z *ZH07p) supported() error {
+	if p := z.model(); !p.pwm {
+		return fmt.Errorf("%w: PWM output on %s", ErrNotSupported, p.name)
+	}
+	return nil
+}
+
+// model returns the profile of the sensor, the ZH07's if none was configured.
+func (z *ZH07p) model() *profile {
+	if z.profile == nil {
+		return profileFor(ModelZH07)
+	}
+	return z.profile
+}
@@ -0,0 +1,134 @@
+package zh07
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// edgeList is an EdgeSource replaying a fixed list of edges.
+type edgeList []Edge
+
+func (l *edgeList) NextEdge() (Edge, error) {
+	if len(*l) == 0 {
+		return Edge{}, io.EOF
+	}
+	e := (*l)[0]
+	*l = (*l)[1:]
+
+	return e, nil
+}
+
+// pwmPeriods returns the edges of consecutive PWM periods with the given high
+// times, starting with a rising edge at start.
+func pwmPeriods(start time.Duration, period time.Duration, highs ...time.Duration) *edgeList {
+	var l edgeList
+	for i, th := range highs {
+		rise := start + time.Duration(i)*period
+		l = append(l, Edge{Rising: true, Time: rise}, Edge{Time: rise + th})
+	}
+	l = append(l, Edge{Rising: true, Time: start + time.Duration(len(highs))*period})
+
+	return &l
+}
+
+func TestZH07p_Read(t *testing.T) {
+	tests := []struct {
+		name   string
+		edges  *edgeList
+		checks []checkFn
+		valid  bool
+	}{
+		{
+			name:  "success",
+			edges: pwmPeriods(0, pwmPeriod, 102*time.Millisecond),
+			checks: check(
+				hasError(false),
+				pm(100, 0, 0),
+			),
+			valid: true,
+		},
+		{
+			name:  "minimum",
+			edges: pwmPeriods(0, pwmPeriod, pwmMargin),
+			checks: check(
+				hasError(false),
+				pm(0, 0, 0),
+			),
+			valid: true,
+		},
+		{
+			name:  "maximum",
+			edges: pwmPeriods(0, pwmPeriod, pwmPeriod-pwmMargin),
+			checks: check(
+				hasError(false),
+				pm(1000, 0, 0),
+			),
+			valid: true,
+		},
+		{
+			name:  "starts-mid-period",
+			edges: &edgeList{{Time: 5}, {Rising: true, Time: 10}, {Time: 10 + 502*time.Millisecond}, {Rising: true, Time: 10 + pwmPeriod}},
+			checks: check(
+				hasError(false),
+				pm(500, 0, 0),
+			),
+			valid: true,
+		},
+		{
+			name:  "fail-period-out-of-tolerance",
+			edges: pwmPeriods(0, 800*time.Millisecond, 102*time.Millisecond),
+			checks: check(
+				hasError(true),
+				isNil,
+			),
+		},
+		{
+			name:  "fail-no-more-edges",
+			edges: &edgeList{{Rising: true}},
+			checks: check(
+				hasError(true),
+				isNil,
+			),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z := NewZH07p(&Config{PWM: tt.edges, WarmUp: -1})
+			assert.NoError(t, z.Init())
+
+			got, err := z.Read()
+			for _, c := range tt.checks {
+				c(t, got, err)
+			}
+			assert.Equal(t, tt.valid, z.IsReadingValid())
+			assert.Equal(t, 0, z.CalculateChecksum())
+		})
+	}
+}
+
+func TestZH07p_ReadConsecutive(t *testing.T) {
+	z := NewZH07p(&Config{
+		PWM: pwmPeriods(time.Second, pwmPeriod, 52*time.Millisecond, 202*time.Millisecond),
+	})
+
+	var got []int
+	for i := 0; i < 2; i++ {
+		r, err := z.Read()
+		assert.NoError(t, err)
+		assert.True(t, r.Flags.Has(FlagWarmingUp))
+		got = append(got, r.PM25)
+	}
+	assert.Equal(t, []int{50, 200}, got)
+}
+
+func TestZH07p_NoSource(t *testing.T) {
+	z := NewZH07p(nil)
+
+	assert.ErrorIs(t, z.Init(), ErrSensorCommunication)
+	_, err := z.Read()
+	assert.True(t, errors.Is(err, ErrSensorCommunication))
+}
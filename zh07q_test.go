@@ -4,7 +4,10 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 var (
@@ -48,19 +51,15 @@ func TestZH07q_Init(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			var (
-				b = &bytes.Buffer{}
-				z = NewZH07q(&Config{
-					RW: bufio.NewReadWriter(bufio.NewReader(b), bufio.NewWriter(b)),
-				})
-			)
+			z := NewZH07q(&Config{
+				RW:    newResponder(commandQuery, []byte{0x00}),
+				Clock: NewFakeClock(epoch),
+			})
 
 			if tt.before != nil {
 				tt.before(z)
 			}
 
-			go dummyCommandResponder(t, z.rw, commandQuery, []byte{0x00})
-
 			if err := z.Init(); (err != nil) != tt.wantErr {
 				t.Errorf("ZH07q.Init() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -69,7 +68,7 @@ func TestZH07q_Init(t *testing.T) {
 }
 
 func TestZH07q_CalculateChecksum(t *testing.T) {
-	var z *ZH07q = &ZH07q{data: sampleQAPayload}
+	var z *ZH07q = &ZH07q{driver: driver{data: sampleQAPayload}}
 	if cs := z.CalculateChecksum(); cs != z.getChecksum() {
 		t.Errorf("TestCalculateChecksumInitiative, got %d, expected %d", cs, checksum)
 	}
@@ -98,7 +97,7 @@ func TestZH07q_IsReadingInvalid(t *testing.T) {
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			z := &ZH07q{data: tt.data}
+			z := &ZH07q{driver: driver{data: tt.data}}
 			if got := z.IsReadingValid(); got != tt.want {
 				t.Errorf("ZH07q.IsReadingValid() = %v, want %v", got, tt.want)
 			}
@@ -146,9 +145,9 @@ func TestZH07q_Read(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			var (
-				b = &bytes.Buffer{}
 				z = NewZH07q(&Config{
-					RW: bufio.NewReadWriter(bufio.NewReader(b), bufio.NewWriter(b)),
+					RW:    newResponder(commandQuery, tt.response),
+					Clock: NewFakeClock(epoch),
 				})
 				got *Reading
 				err error
@@ -158,8 +157,6 @@ func TestZH07q_Read(t *testing.T) {
 				tt.before(z)
 			}
 
-			go dummyCommandResponder(t, z.rw, commandQuery, tt.response)
-
 			got, err = z.Read()
 			for _, c := range tt.checks {
 				c(t, got, err)
@@ -169,8 +166,86 @@ func TestZH07q_Read(t *testing.T) {
 }
 
 func TestZH07q_getChecksum(t *testing.T) {
-	var z *ZH07q = &ZH07q{data: sampleQAPayload}
+	var z *ZH07q = &ZH07q{driver: driver{data: sampleQAPayload}}
 	if cs := z.getChecksum(); cs != 0xFA {
 		t.Errorf("TestGetChecksumQA, got %d, expected %d", cs, checksum)
 	}
 }
+
+func TestZH07q_ReadInto(t *testing.T) {
+	var (
+		z = NewZH07q(newLoopConfig(sampleQAPayload))
+		r Reading
+	)
+
+	ok, err := z.ReadInto(&r)
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	assert.Equal(t, Reading{PM1: 0x65, PM25: 0x85, PM10: 0x96}, r)
+	assert.True(t, z.IsReadingValid())
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if ok, err := z.ReadInto(&r); !ok || err != nil {
+			t.Fatal(ok, err)
+		}
+	})
+	assert.Zero(t, allocs)
+
+	z = NewZH07q(newLoopConfig(sampleQABadChecksum))
+	ok, err = z.ReadInto(&r)
+	assert.False(t, ok)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	assert.False(t, z.IsReadingValid())
+}
+
+func BenchmarkZH07q_Read(b *testing.B) {
+	z := NewZH07q(newLoopConfig(sampleQAPayload))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := z.Read(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkZH07q_ReadInto(b *testing.B) {
+	var (
+		z = NewZH07q(newLoopConfig(sampleQAPayload))
+		r Reading
+	)
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := z.ReadInto(&r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestZH07q_FrameStats(t *testing.T) {
+	var (
+		line  = append([]byte{0x00, 0x00}, sampleInitiativePayload...)
+		clock = NewFakeClock(epoch)
+		z     = NewZH07q(&Config{
+			RW:             bufio.NewReadWriter(bufio.NewReader(bytes.NewReader(line)), bufio.NewWriter(io.Discard)),
+			Clock:          clock,
+			WarmUp:         -1,
+			PostWriteDelay: -1,
+		})
+	)
+
+	assert.NoError(t, z.SetMode(ModeInitiative))
+	for {
+		r, err := z.Read()
+		assert.NoError(t, err)
+		if r != nil {
+			break
+		}
+	}
+
+	s := z.FrameStats()
+	assert.Equal(t, 1, s.Frames, "frames are monitored after switching to initiative upload mode")
+	assert.Equal(t, 1, s.Resyncs)
+	assert.Equal(t, 2, s.Discarded)
+}
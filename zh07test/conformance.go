@@ -0,0 +1,195 @@
+package zh07test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/padiazg/go-zh07"
+)
+
+const (
+	// maxResyncs is how many times a read returning nil and no error is
+	// retried, as ZH07i does while resynchronising
+	maxResyncs = 64
+	// goroutines and readsEach size the concurrency check
+	goroutines = 8
+	readsEach  = 10
+)
+
+// Factory creates the implementation under test, backed by a sensor playing
+// script: each successful call to Read should return the reading of the next
+// step, or fail with an error wrapping the error of the step. Decorators can
+// wrap a Sensor created from the script, drivers can use a Port playing it.
+// The suite calls Init itself.
+type Factory func(t *testing.T, script []Step) zh07.SensorInterface
+
+// RunConformance checks that the implementations created by factory honour
+// the contract of zh07.SensorInterface:
+//
+//   - Init succeeds and can be called again
+//   - Read returns the readings in order and IsReadingValid reports them
+//     as valid
+//   - errors wrap the zh07 errors, so that errors.Is works, and the next
+//     read recovers
+//   - Read can be called from several goroutines at once, each reading being
+//     returned once; run the tests with -race for this check to be thorough
+//   - implementations of zh07.Sensor fail with zh07.ErrClosed once closed
+//
+// Reading.Flags is not compared, as implementations may set quality flags.
+func RunConformance(t *testing.T, factory Factory) {
+	t.Helper()
+
+	t.Run("Init", func(t *testing.T) {
+		s := factory(t, readings(1))
+		if err := s.Init(); err != nil {
+			t.Fatalf("Init() = %v, want nil", err)
+		}
+		if err := s.Init(); err != nil {
+			t.Errorf("Init() again = %v, want nil", err)
+		}
+	})
+
+	t.Run("Read", func(t *testing.T) {
+		script := readings(5)
+		s := initialized(t, factory, script)
+
+		for i, step := range script {
+			r, err := read(s)
+			if err != nil {
+				t.Fatalf("Read() #%d = %v", i+1, err)
+			}
+			checkReading(t, i+1, r, step.Reading)
+			if !s.IsReadingValid() {
+				t.Errorf("IsReadingValid() after read #%d = false, want true", i+1)
+			}
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		script := readings(2)
+		script = []Step{script[0], {Err: zh07.ErrSensorCommunication}, script[1]}
+		s := initialized(t, factory, script)
+
+		if _, err := read(s); err != nil {
+			t.Fatalf("Read() #1 = %v", err)
+		}
+
+		r, err := read(s)
+		if !errors.Is(err, zh07.ErrSensorCommunication) {
+			t.Errorf("Read() #2 = %v, want an error wrapping %q", err, zh07.ErrSensorCommunication)
+		}
+		if r != nil {
+			t.Errorf("Read() #2 = %+v along with the error, want nil", r)
+		}
+
+		r, err = read(s)
+		if err != nil {
+			t.Fatalf("Read() #3 = %v, want the next reading", err)
+		}
+		checkReading(t, 3, r, script[2].Reading)
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		var (
+			script = readings(goroutines * readsEach)
+			s      = initialized(t, factory, script)
+			mu     sync.Mutex
+			seen   = map[int]int{} // times each reading, told by its PM1, was returned
+			wg     sync.WaitGroup
+		)
+
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				for i := 0; i < readsEach; i++ {
+					r, err := read(s)
+					s.IsReadingValid() // another read may be under way, only races matter
+					if err != nil {
+						t.Errorf("concurrent Read() = %v", err)
+						return
+					}
+
+					mu.Lock()
+					seen[r.PM1]++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		for _, step := range script {
+			if n := seen[step.Reading.PM1]; n != 1 {
+				t.Errorf("reading %+v returned %d times, want once", *step.Reading, n)
+			}
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		s := initialized(t, factory, readings(2))
+		c, ok := s.(zh07.Sensor)
+		if !ok {
+			t.Skip("not a zh07.Sensor")
+		}
+
+		if _, err := read(s); err != nil {
+			t.Fatalf("Read() = %v", err)
+		}
+		if err := c.Close(context.Background()); err != nil {
+			t.Fatalf("Close() = %v", err)
+		}
+		if _, err := s.Read(); !errors.Is(err, zh07.ErrClosed) {
+			t.Errorf("Read() after Close() = %v, want %q", err, zh07.ErrClosed)
+		}
+	})
+}
+
+// readings returns a script of n distinct readings, told apart by PM1.
+func readings(n int) []Step {
+	s := make([]Step, n)
+	for i := range s {
+		s[i] = Step{Reading: &zh07.Reading{PM1: 10 + i, PM25: 20 + 2*i, PM10: 30 + 3*i}}
+	}
+	return s
+}
+
+// initialized creates a sensor playing script and initializes it.
+func initialized(t *testing.T, factory Factory, script []Step) zh07.SensorInterface {
+	t.Helper()
+
+	s := factory(t, script)
+	if err := s.Init(); err != nil {
+		t.Fatalf("Init() = %v", err)
+	}
+	return s
+}
+
+// read reads from s, retrying while it returns nil and no error.
+func read(s zh07.SensorInterface) (*zh07.Reading, error) {
+	for i := 0; i < maxResyncs; i++ {
+		if r, err := s.Read(); r != nil || err != nil {
+			return r, err
+		}
+	}
+	return nil, fmt.Errorf("no reading after %d attempts", maxResyncs)
+}
+
+// checkReading compares the reading returned by read #n with want, flags
+// aside.
+func checkReading(t *testing.T, n int, got, want *zh07.Reading) {
+	t.Helper()
+
+	if got == nil {
+		t.Errorf("Read() #%d = nil, want %+v", n, *want)
+		return
+	}
+	g := *got
+	g.Flags = want.Flags
+	if g != *want {
+		t.Errorf("Read() #%d = %+v, want %+v", n, g, *want)
+	}
+}
@@ -0,0 +1,41 @@
+package zh07test
+
+import (
+	"bufio"
+	"testing"
+	"time"
+
+	"github.com/padiazg/go-zh07"
+)
+
+// config returns the configuration of a driver talking to a Port playing
+// script, with no delays.
+func config(script []Step) *zh07.Config {
+	p := NewPort(script)
+	return &zh07.Config{
+		RW:             bufio.NewReadWriter(bufio.NewReader(p), bufio.NewWriter(p)),
+		WarmUp:         -1,
+		Clock:          zh07.NewFakeClock(time.Now()),
+		PostWriteDelay: -1,
+	}
+}
+
+func TestRunConformance(t *testing.T) {
+	factories := map[string]Factory{
+		"Sensor": func(_ *testing.T, script []Step) zh07.SensorInterface {
+			return New(&Config{Steps: script})
+		},
+		"ZH07i": func(_ *testing.T, script []Step) zh07.SensorInterface {
+			return zh07.NewZH07i(config(script))
+		},
+		"ZH07q": func(_ *testing.T, script []Step) zh07.SensorInterface {
+			return zh07.NewZH07q(config(script))
+		},
+	}
+
+	for name, factory := range factories {
+		t.Run(name, func(t *testing.T) {
+			RunConformance(t, factory)
+		})
+	}
+}
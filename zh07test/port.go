@@ -0,0 +1,159 @@
+package zh07test
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"github.com/padiazg/go-zh07"
+)
+
+var _ io.ReadWriter = (*Port)(nil)
+
+const (
+	commandLength = 9  // length of a command
+	frameLength   = 32 // length of an initiative upload frame
+)
+
+// Port emulates a ZH07 on a serial port whose reads time out with io.EOF,
+// playing a script. In initiative upload mode, the mode the sensor powers up
+// in, every read with no bytes pending sends the next step as a frame. In
+// question and answer mode every query is answered with the next step.
+//
+// A step with an error leaves the line silent, so that the read fails with
+// io.EOF; an invalid step is sent with a bad checksum. Delays are ignored.
+// Once every step was played the line stays silent.
+type Port struct {
+	mu      sync.Mutex
+	steps   []Step
+	next    int // next step
+	qa      bool
+	dormant bool
+	cmd     []byte // command being received
+	rx      bytes.Buffer
+	tx      bytes.Buffer
+}
+
+// NewPort creates a new Port playing steps.
+func NewPort(steps []Step) *Port {
+	return &Port{steps: steps}
+}
+
+// Read returns the bytes sent by the sensor.
+func (p *Port) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.rx.Len() == 0 && !p.qa && !p.dormant {
+		p.send(frame)
+	}
+	return p.rx.Read(b)
+}
+
+// Write receives commands, which may be split across writes.
+func (p *Port) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.tx.Write(b)
+	for _, c := range b {
+		if len(p.cmd) == 0 && c != 0xFF {
+			continue // not the start of a command
+		}
+		if p.cmd = append(p.cmd, c); len(p.cmd) == commandLength {
+			p.execute(p.cmd)
+			p.cmd = nil
+		}
+	}
+
+	return len(b), nil
+}
+
+// Written returns every byte written so far.
+func (p *Port) Written() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return bytes.Clone(p.tx.Bytes())
+}
+
+// Left returns the number of steps not played yet.
+func (p *Port) Left() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.steps) - p.next
+}
+
+// execute runs command c, ignoring the unknown ones.
+func (p *Port) execute(c []byte) {
+	switch {
+	case c[2] == 0x78 && c[3] == 0x40:
+		p.qa = false
+	case c[2] == 0x78 && c[3] == 0x41:
+		p.qa = true
+	case c[2] == 0xA7:
+		p.dormant = c[3] == 0x01
+	case c[2] == 0x86 && p.qa && !p.dormant:
+		p.send(answer)
+	}
+}
+
+// send plays the next step, encoded with encode.
+func (p *Port) send(encode func(r zh07.Reading) []byte) {
+	if p.next >= len(p.steps) {
+		return
+	}
+	s := p.steps[p.next]
+	p.next++
+
+	if s.Err != nil || s.Reading == nil {
+		return
+	}
+	d := encode(*s.Reading)
+	if s.Invalid {
+		d[len(d)-1]++
+	}
+	p.rx.Write(d)
+}
+
+// answer encodes r as a question and answer mode answer.
+func answer(r zh07.Reading) []byte {
+	a := []byte{0xFF, 0x86, 0, 0, 0, 0, 0, 0, 0}
+	put(a[2:], r.PM25)
+	put(a[4:], r.PM10)
+	put(a[6:], r.PM1)
+
+	var sum byte
+	for _, c := range a[1:8] {
+		sum += c
+	}
+	a[8] = ^sum + 1
+
+	return a
+}
+
+// frame encodes r as an initiative upload frame.
+func frame(r zh07.Reading) []byte {
+	f := make([]byte, frameLength)
+	f[0], f[1] = 0x42, 0x4D
+	put(f[2:], frameLength-4)
+	for _, o := range []int{4, 10} { // standard particles, then atmospheric environment
+		put(f[o:], r.PM1)
+		put(f[o+2:], r.PM25)
+		put(f[o+4:], r.PM10)
+	}
+
+	var sum int
+	for _, c := range f[:frameLength-2] {
+		sum += int(c)
+	}
+	put(f[frameLength-2:], sum)
+
+	return f
+}
+
+// put writes v big-endian into the first 2 bytes of b.
+func put(b []byte, v int) {
+	b[0], b[1] = byte(v>>8), byte(v)
+}
@@ -0,0 +1,78 @@
+package zh07test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/padiazg/go-zh07"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	commandSetQAMode = []byte{0xFF, 0x01, 0x78, 0x41, 0x00, 0x00, 0x00, 0x00, 0x46}
+	commandQuery     = []byte{0xFF, 0x01, 0x86, 0x00, 0x00, 0x00, 0x00, 0x00, 0x79}
+	commandSleep     = []byte{0xFF, 0x01, 0xA7, 0x01, 0x00, 0x00, 0x00, 0x00, 0x57}
+)
+
+func TestPort_Initiative(t *testing.T) {
+	p := NewPort([]Step{
+		{Reading: &zh07.Reading{PM1: 0x54, PM25: 0x6E, PM10: 0x7C}},
+		{Err: zh07.ErrSensorCommunication},
+		{Reading: &zh07.Reading{PM1: 0x54, PM25: 0x6E, PM10: 0x7C}, Invalid: true},
+	})
+	b := make([]byte, 64)
+
+	n, err := p.Read(b)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x42, 0x4D, 0x00, 0x1C,
+		0x00, 0x54, 0x00, 0x6E, 0x00, 0x7C,
+		0x00, 0x54, 0x00, 0x6E, 0x00, 0x7C,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x03, 0x27,
+	}, b[:n], "the frame sent by a ZH07")
+
+	_, err = p.Read(b)
+	assert.Equal(t, io.EOF, err, "silent")
+
+	n, err = p.Read(b)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x03, 0x28}, b[n-2:n], "bad checksum")
+
+	_, err = p.Read(b)
+	assert.Equal(t, io.EOF, err, "the script is over")
+	assert.Zero(t, p.Left())
+}
+
+func TestPort_QA(t *testing.T) {
+	p := NewPort([]Step{
+		{Reading: &zh07.Reading{PM1: 0x65, PM25: 0x85, PM10: 0x96}},
+		{Err: zh07.ErrSensorCommunication},
+		{Reading: &zh07.Reading{PM1: 1}},
+	})
+	b := make([]byte, 64)
+
+	_, err := p.Write(commandSetQAMode)
+	assert.NoError(t, err)
+	_, err = p.Read(b)
+	assert.Equal(t, io.EOF, err, "nothing sent until queried")
+
+	p.Write(commandQuery[:4]) // split across writes
+	p.Write(commandQuery[4:])
+	n, err := p.Read(b)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xFF, 0x86, 0x00, 0x85, 0x00, 0x96, 0x00, 0x65, 0xFA}, b[:n])
+
+	p.Write(commandQuery)
+	_, err = p.Read(b)
+	assert.Equal(t, io.EOF, err, "left unanswered")
+
+	p.Write(commandSleep)
+	p.Write(commandQuery)
+	_, err = p.Read(b)
+	assert.Equal(t, io.EOF, err, "dormant")
+	assert.Equal(t, 1, p.Left())
+
+	assert.Equal(t, bytes.Join([][]byte{commandSetQAMode, commandQuery, commandQuery, commandSleep, commandQuery}, nil), p.Written())
+}
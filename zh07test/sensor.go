@@ -0,0 +1,187 @@
+// Package zh07test provides test doubles and a conformance suite for code
+// built on the zh07 package.
+//
+// Sensor is a scriptable mock implementing zh07.SensorInterface and
+// zh07.Sensor, for services consuming sensors. Port emulates a ZH07 on a
+// serial port, for drivers. RunConformance checks that an implementation of
+// zh07.SensorInterface, such as another model, a remote proxy or a decorator,
+// honours the contract of the interface.
+package zh07test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/padiazg/go-zh07"
+)
+
+var (
+	_ zh07.SensorInterface = (*Sensor)(nil)
+	_ zh07.Sensor          = (*Sensor)(nil)
+)
+
+// ErrExhausted is returned by Sensor.Read once every step was played.
+var ErrExhausted = fmt.Errorf("%w: no more steps", zh07.ErrSensorCommunication)
+
+// Step is what a sensor does on a call to Read.
+type Step struct {
+	// Reading is the reading returned. Without an error either, Read returns
+	// nil and no error, as ZH07i does while resynchronising.
+	Reading *zh07.Reading
+	// Err is the error returned, it should wrap one of the zh07 errors
+	Err error
+	// Invalid returns the reading with no error but a bad checksum, which
+	// IsReadingValid reports afterwards, as a sensor leaving validation to the
+	// caller does. Port sends it with a bad checksum, which ZH07i and ZH07q
+	// fail to read with ErrChecksumMismatch
+	Invalid bool
+	// Delay is how long the read takes
+	Delay time.Duration
+}
+
+// Config holds configuration options for a Sensor.
+type Config struct {
+	// Steps are played in order, one per call to Read
+	Steps []Step
+	// Loop plays the steps again once done, otherwise Read fails with
+	// ErrExhausted
+	Loop bool
+	// InitErr is returned by Init
+	InitErr error
+	// Info is returned by Info, a ZH07 in initiative upload mode if zero
+	Info zh07.Info
+	// Clock is used for delays, zh07.SystemClock if nil
+	Clock zh07.Clock
+}
+
+// Sensor is a mock sensor playing a script. It is safe for concurrent use.
+type Sensor struct {
+	config Config
+
+	mu     sync.Mutex
+	next   int  // next step
+	last   Step // last step played
+	inits  int
+	reads  int
+	closed bool
+}
+
+// New creates a new Sensor.
+func New(config *Config) *Sensor {
+	if config == nil {
+		config = &Config{}
+	}
+
+	if config.Info == (zh07.Info{}) {
+		config.Info = zh07.Info{Model: zh07.ModelZH07, Capabilities: zh07.ModelZH07.Capabilities()}
+	}
+
+	if config.Clock == nil {
+		config.Clock = zh07.SystemClock
+	}
+
+	return &Sensor{config: *config}
+}
+
+// Init returns Config.InitErr, or zh07.ErrClosed once the sensor is closed.
+func (s *Sensor) Init() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return zh07.ErrClosed
+	}
+	s.inits++
+
+	return s.config.InitErr
+}
+
+// Read plays the next step, or fails with zh07.ErrClosed once the sensor is
+// closed.
+func (s *Sensor) Read() (*zh07.Reading, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, zh07.ErrClosed
+	}
+	s.reads++
+
+	if s.next >= len(s.config.Steps) {
+		if !s.config.Loop || len(s.config.Steps) == 0 {
+			s.last = Step{Err: ErrExhausted}
+			return nil, ErrExhausted
+		}
+		s.next = 0
+	}
+	s.last = s.config.Steps[s.next]
+	s.next++
+
+	if s.last.Delay > 0 {
+		s.config.Clock.Sleep(s.last.Delay)
+	}
+	if s.last.Err != nil || s.last.Reading == nil {
+		return nil, s.last.Err
+	}
+
+	r := *s.last.Reading
+	return &r, nil
+}
+
+// CalculateChecksum returns the checksum of the question and answer mode
+// answer carrying the last reading, zero if there is none.
+func (s *Sensor) CalculateChecksum() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.last.Reading == nil {
+		return 0
+	}
+	a := answer(*s.last.Reading)
+	return int(a[len(a)-1])
+}
+
+// IsReadingValid reports whether the last step returned a reading with a
+// valid checksum.
+func (s *Sensor) IsReadingValid() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.last.Reading != nil && s.last.Err == nil && !s.last.Invalid
+}
+
+// Info returns Config.Info.
+func (s *Sensor) Info() zh07.Info {
+	return s.config.Info
+}
+
+// Close closes the sensor. Any later call returns zh07.ErrClosed.
+func (s *Sensor) Close(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return zh07.ErrClosed
+	}
+	s.closed = true
+
+	return nil
+}
+
+// Inits returns the number of calls to Init.
+func (s *Sensor) Inits() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.inits
+}
+
+// Reads returns the number of calls to Read.
+func (s *Sensor) Reads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.reads
+}
@@ -0,0 +1,87 @@
+package zh07test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/padiazg/go-zh07"
+	"github.com/stretchr/testify/assert"
+)
+
+var epoch = time.Date(2025, 6, 17, 10, 0, 0, 0, time.UTC)
+
+func TestSensor(t *testing.T) {
+	var (
+		clock  = zh07.NewFakeClock(epoch)
+		failed = errors.New("port unplugged")
+		s      = New(&Config{
+			Steps: []Step{
+				{Reading: &zh07.Reading{PM1: 1, PM25: 2, PM10: 3}, Delay: time.Second},
+				{Err: failed},
+				{Reading: &zh07.Reading{PM1: 4, PM25: 5, PM10: 6}, Invalid: true},
+				{},
+			},
+			Clock: clock,
+		})
+	)
+
+	assert.NoError(t, s.Init())
+	assert.Equal(t, zh07.Info{Model: zh07.ModelZH07, Capabilities: zh07.ModelZH07.Capabilities()}, s.Info())
+
+	r, err := s.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, &zh07.Reading{PM1: 1, PM25: 2, PM10: 3}, r)
+	assert.True(t, s.IsReadingValid())
+	assert.Equal(t, 0x74, s.CalculateChecksum())
+	assert.Equal(t, time.Second, clock.Slept(), "the read takes its delay")
+
+	r.PM1 = 99 // the script is left alone
+
+	r, err = s.Read()
+	assert.Equal(t, failed, err)
+	assert.Nil(t, r)
+	assert.False(t, s.IsReadingValid())
+
+	r, err = s.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, r.PM1)
+	assert.False(t, s.IsReadingValid(), "returned with a bad checksum")
+
+	r, err = s.Read()
+	assert.NoError(t, err)
+	assert.Nil(t, r, "resynchronising")
+
+	_, err = s.Read()
+	assert.ErrorIs(t, err, ErrExhausted)
+	assert.ErrorIs(t, err, zh07.ErrSensorCommunication)
+	assert.Equal(t, 5, s.Reads())
+	assert.Equal(t, 1, s.Inits())
+
+	assert.NoError(t, s.Close(context.Background()))
+	assert.ErrorIs(t, s.Close(context.Background()), zh07.ErrClosed)
+	assert.ErrorIs(t, s.Init(), zh07.ErrClosed)
+	_, err = s.Read()
+	assert.ErrorIs(t, err, zh07.ErrClosed)
+}
+
+func TestSensor_Loop(t *testing.T) {
+	s := New(&Config{
+		Steps:   []Step{{Reading: &zh07.Reading{PM1: 1}}, {Reading: &zh07.Reading{PM1: 2}}},
+		Loop:    true,
+		InitErr: zh07.ErrSensorCommunication,
+		Info:    zh07.Info{Model: zh07.ModelPMS5003, Mode: zh07.ModeQA},
+	})
+
+	assert.ErrorIs(t, s.Init(), zh07.ErrSensorCommunication)
+	assert.Equal(t, zh07.ModelPMS5003, s.Info().Model)
+	for _, want := range []int{1, 2, 1, 2, 1} {
+		r, err := s.Read()
+		assert.NoError(t, err)
+		assert.Equal(t, want, r.PM1)
+	}
+
+	_, err := New(&Config{Loop: true}).Read()
+	assert.ErrorIs(t, err, ErrExhausted, "nothing to loop over")
+}